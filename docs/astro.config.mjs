@@ -42,12 +42,23 @@ export default defineConfig({
                       { label: 'init', slug: 'commands/init' },
                       { label: 'set', slug: 'commands/set' },
                       { label: 'get', slug: 'commands/get' },
+                      { label: 'unset', slug: 'commands/unset' },
+                      { label: 'list', slug: 'commands/list' },
+                      { label: 'mv and cp', slug: 'commands/mv' },
+                      { label: 'diff', slug: 'commands/diff' },
+                      { label: 'log', slug: 'commands/log' },
+                      { label: 'setup-git', slug: 'commands/setup-git' },
                       { label: 'edit', slug: 'commands/edit' },
                       { label: 'export', slug: 'commands/export' },
                       { label: 'apply', slug: 'commands/apply' },
                       { label: 'run', slug: 'commands/run' },
                       { label: 'rekey', slug: 'commands/rekey' },
+                      { label: 'recipients', slug: 'commands/recipients' },
+                      { label: 'groups', slug: 'commands/groups' },
+                      { label: 'files', slug: 'commands/files' },
+                      { label: 'affected', slug: 'commands/affected' },
                       { label: 'info', slug: 'commands/info' },
+                      { label: 'verify', slug: 'commands/verify' },
                   ],
               },
               {
@@ -6,6 +6,7 @@ toolchain go1.24.4
 
 require (
 	filippo.io/age v1.2.1
+	filippo.io/edwards25519 v1.1.0
 	github.com/BurntSushi/toml v1.5.0
 	github.com/alecthomas/kong v1.12.0
 	github.com/joho/godotenv v1.5.1
@@ -16,7 +17,6 @@ require (
 )
 
 require (
-	filippo.io/edwards25519 v1.1.0 // indirect
 	github.com/mattn/go-colorable v0.1.14 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	golang.org/x/sys v0.34.0 // indirect
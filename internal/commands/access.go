@@ -0,0 +1,133 @@
+package commands
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/thunderbottom/kiln/internal/config"
+	"github.com/thunderbottom/kiln/internal/core"
+	kerrors "github.com/thunderbottom/kiln/internal/errors"
+)
+
+// accessUpdate describes the files re-encrypted by updateAccess
+type accessUpdate struct {
+	// Files lists every file whose resolved recipients changed, sorted
+	Files []string
+	// Variables holds the decrypted variables of each affected file that exists on disk.
+	// Values are wiped by the cleanup function returned from updateAccess.
+	Variables map[string]map[string][]byte
+}
+
+// updateAccess applies change to the configuration, saves it, and re-encrypts exactly the files
+// whose resolved recipients changed as a result. Affected files are decrypted before anything is
+// written, so a file the operator cannot read, or one left without recipients, aborts the update
+// without modifying kiln.toml or any ciphertext. Existing signatures are checked against the
+// signers allowed before the change, so files last written by a removed signer can be re-signed.
+func updateAccess(rt *Runtime, cfg *config.Config, change func() error) (*accessUpdate, func(), error) {
+	before := resolveAllAccess(cfg)
+	previous := cfg.Clone()
+
+	paths := make(map[string]string, len(cfg.Files))
+	for name, fileConfig := range cfg.Files {
+		paths[name] = fileConfig.Filename
+	}
+
+	if err := change(); err != nil {
+		return nil, nil, err
+	}
+
+	after := resolveAllAccess(cfg)
+
+	update := &accessUpdate{Variables: make(map[string]map[string][]byte)}
+
+	var cleanups []func()
+
+	cleanup := func() {
+		for _, fn := range cleanups {
+			fn()
+		}
+	}
+
+	for _, fileName := range cfg.FileNames() {
+		if slices.Equal(before[fileName], after[fileName]) {
+			continue
+		}
+
+		if len(after[fileName]) == 0 {
+			return nil, nil, kerrors.ConfigError(fmt.Sprintf("file '%s' would have no recipients left", fileName), "grant access to another recipient first")
+		}
+
+		update.Files = append(update.Files, fileName)
+	}
+
+	if len(update.Files) == 0 {
+		if err := cfg.Save(rt.ConfigPath()); err != nil {
+			return nil, nil, fmt.Errorf("save configuration: %w", err)
+		}
+
+		return update, cleanup, nil
+	}
+
+	identity, err := rt.Identity()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, fileName := range update.Files {
+		filePath, exists := paths[fileName]
+		if !exists || !core.FileExists(filePath) {
+			continue
+		}
+
+		variables, fileCleanup, err := core.DecryptSignedEnvFile(identity, previous, fileName, fileName, filePath)
+		if err != nil {
+			cleanup()
+
+			return nil, nil, err
+		}
+
+		cleanups = append(cleanups, fileCleanup)
+		update.Variables[fileName] = variables
+	}
+
+	if err := cfg.Save(rt.ConfigPath()); err != nil {
+		cleanup()
+
+		return nil, nil, fmt.Errorf("save configuration: %w", err)
+	}
+
+	for _, fileName := range update.Files {
+		variables, exists := update.Variables[fileName]
+		if !exists {
+			continue
+		}
+
+		if err := core.SaveAllEnvVars(identity, cfg, fileName, variables); err != nil {
+			cleanup()
+
+			return nil, nil, err
+		}
+
+		rt.Logger.Info().Str("file", fileName).Msg("rekeyed")
+	}
+
+	return update, cleanup, nil
+}
+
+// resolveAllAccess returns the sorted recipient keys of every configured file.
+// Files without valid recipients map to nil.
+func resolveAllAccess(cfg *config.Config) map[string][]string {
+	access := make(map[string][]string, len(cfg.Files))
+
+	for name := range cfg.Files {
+		recipients, err := cfg.ResolveFileAccess(name)
+		if err != nil {
+			continue
+		}
+
+		slices.Sort(recipients)
+		access[name] = recipients
+	}
+
+	return access
+}
@@ -0,0 +1,192 @@
+package commands
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/thunderbottom/kiln/internal/config"
+	"github.com/thunderbottom/kiln/internal/core"
+	kerrors "github.com/thunderbottom/kiln/internal/errors"
+)
+
+// AffectedCmd represents the affected command for finding files to rekey after a shared file changes.
+type AffectedCmd struct {
+	Shared string `arg:"" help:"Shared recipients file included by project configurations" type:"path"`
+	Root   string `help:"Directory to search for kiln.toml files (default: git repository of the shared file)" type:"path"`
+	Format string `help:"Output format" enum:"text,json" default:"text"`
+}
+
+// affectedFile describes an environment file whose recipients are out of date
+type affectedFile struct {
+	Config string `json:"config"`
+	File   string `json:"file"`
+	Status string `json:"status"`
+}
+
+func (c *AffectedCmd) validate() error {
+	if !core.IsValidFilePath(c.Shared) {
+		return kerrors.ValidationError("shared file", "invalid file path")
+	}
+
+	if c.Root != "" && !core.IsValidFilePath(c.Root) {
+		return kerrors.ValidationError("root", "invalid directory path")
+	}
+
+	return nil
+}
+
+// Run executes the affected command, listing files in every project including the shared file
+// that are not encrypted for the recipients they currently resolve to.
+func (c *AffectedCmd) Run(rt *Runtime) error {
+	rt.Logger.Debug().Str("command", "affected").Str("shared", c.Shared).Str("root", c.Root).Msg("validation started")
+
+	if err := c.validate(); err != nil {
+		rt.Logger.Warn().Err(err).Msg("validation failed")
+
+		return err
+	}
+
+	shared, err := filepath.Abs(c.Shared)
+	if err != nil {
+		return err
+	}
+
+	if !core.FileExists(shared) {
+		return kerrors.FileAccessError("read", shared, os.ErrNotExist)
+	}
+
+	root := c.Root
+	if root == "" {
+		if root, err = core.GitTopLevel(filepath.Dir(shared)); err != nil {
+			root = filepath.Dir(shared)
+		}
+	}
+
+	configPaths, err := findConfigs(root)
+	if err != nil {
+		return err
+	}
+
+	var (
+		affected []affectedFile
+		failed   int
+	)
+
+	for _, configPath := range configPaths {
+		cfg, err := config.Load(configPath)
+		if err != nil {
+			rt.Logger.Warn().Str("config", configPath).Err(err).Msg("cannot load configuration")
+
+			failed++
+
+			continue
+		}
+
+		if !slices.Contains(cfg.IncludedFiles(), shared) {
+			continue
+		}
+
+		rt.Logger.Debug().Str("config", configPath).Msg("configuration includes shared file")
+
+		label := configPath
+		if rel, err := filepath.Rel(root, configPath); err == nil {
+			label = rel
+		}
+
+		for _, fileName := range cfg.FileNames() {
+			if status, stale := staleStatus(cfg, fileName); stale {
+				affected = append(affected, affectedFile{Config: label, File: fileName, Status: status})
+			}
+		}
+	}
+
+	if c.Format == "json" {
+		if affected == nil {
+			affected = []affectedFile{}
+		}
+
+		if err := printJSON(affected); err != nil {
+			return err
+		}
+	} else if len(affected) > 0 {
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+		fmt.Fprintln(writer, "CONFIG\tFILE\tSTATUS")
+
+		for _, file := range affected {
+			fmt.Fprintf(writer, "%s\t%s\t%s\n", file.Config, file.File, file.Status)
+		}
+
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to load %d configurations", failed)
+	}
+
+	rt.Logger.Info().Int("files", len(affected)).Msg("run 'kiln rekey --all' in each listed project to update them")
+
+	return nil
+}
+
+// staleStatus reports whether an existing file needs rekeying, with a short status. Files without
+// a recipient manifest are always reported, as their header cannot show who they are encrypted for.
+func staleStatus(cfg *config.Config, fileName string) (string, bool) {
+	filePath, err := cfg.GetEnvFile(fileName)
+	if err != nil || !core.FileExists(filePath) {
+		return "", false
+	}
+
+	check, err := core.CheckFileManifest(cfg, fileName)
+	if err != nil {
+		return "error: " + err.Error(), true
+	}
+
+	if check.Recorded == nil {
+		return "needs rekey (cannot verify)", true
+	}
+
+	current, err := core.FileRecipientsCurrent(cfg, fileName)
+	if err != nil {
+		return "error: " + err.Error(), true
+	}
+
+	return "needs rekey", !current
+}
+
+// findConfigs returns the kiln.toml files under root, skipping hidden directories
+func findConfigs(root string) ([]string, error) {
+	var configPaths []string
+
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			if path != root && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if entry.Name() == config.DefaultConfigFile {
+			configPaths = append(configPaths, path)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, kerrors.FileAccessError("search", root, err)
+	}
+
+	return configPaths, nil
+}
@@ -0,0 +1,99 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/thunderbottom/kiln/internal/config"
+	"github.com/thunderbottom/kiln/internal/core"
+)
+
+func TestFindConfigs(t *testing.T) {
+	tmpDir := createTempDir(t)
+
+	var want []string
+
+	for _, dir := range []string{"api", "web/app", ".git/modules", ".cache"} {
+		configPath := filepath.Join(tmpDir, dir, "kiln.toml")
+
+		if err := os.MkdirAll(filepath.Dir(configPath), 0o750); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+
+		if err := os.WriteFile(configPath, []byte(""), 0o600); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+
+		if dir[0] != '.' {
+			want = append(want, configPath)
+		}
+	}
+
+	configPaths, err := findConfigs(tmpDir)
+	if err != nil {
+		t.Fatalf("findConfigs failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(configPaths, want) {
+		t.Errorf("Expected %v, got %v", want, configPaths)
+	}
+}
+
+func TestStaleStatus(t *testing.T) {
+	tmpDir := createTempDir(t)
+	configPath, keyPath := setupTestEnvironment(t, tmpDir)
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("config.Load failed: %v", err)
+	}
+
+	if status, stale := staleStatus(cfg, "default"); stale {
+		t.Errorf("Expected a file not created yet to be skipped, got %q", status)
+	}
+
+	// Files without a manifest are reported even when their stanzas fit the access list
+	recipients, err := core.ParseRecipients([]string{cfg.Recipients["test-user"]})
+	if err != nil {
+		t.Fatalf("ParseRecipients failed: %v", err)
+	}
+
+	encrypted, err := core.NewAgeManager(recipients, nil).Encrypt([]byte("KEY=value\n"))
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+
+	if err := os.WriteFile(cfg.Files["default"].Filename, encrypted, 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	if status, stale := staleStatus(cfg, "default"); !stale || status != "needs rekey (cannot verify)" {
+		t.Errorf("Expected a file without a manifest to need rekeying, got %q, %v", status, stale)
+	}
+
+	identity, err := core.NewIdentityFromKey(keyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	if err := core.SetEnvVar(identity, cfg, "default", "KEY", []byte("value")); err != nil {
+		t.Fatalf("SetEnvVar failed: %v", err)
+	}
+
+	if status, stale := staleStatus(cfg, "default"); stale {
+		t.Errorf("Expected a rewritten file to be current, got %q", status)
+	}
+
+	_, otherKey, err := core.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+
+	cfg.AddRecipient("other-user", otherKey)
+
+	if status, stale := staleStatus(cfg, "default"); !stale || status != "needs rekey" {
+		t.Errorf("Expected a new recipient to make the file stale, got %q, %v", status, stale)
+	}
+}
@@ -16,6 +16,7 @@ type ApplyCmd struct {
 	Strict         bool   `help:"Fail if template variables are not found"`
 	LeftDelimiter  string `help:"Left delimiter to use for template variables (default: ${ or $)"`
 	RightDelimiter string `help:"Right delimiter to use for template variables (default: } or empty)"`
+	NoResolve      bool   `help:"Substitute values with references to other files unresolved"`
 	Template       string `arg:"" help:"Template file path" required:""`
 }
 
@@ -59,7 +60,12 @@ func (c *ApplyCmd) Run(rt *Runtime) error {
 		return err
 	}
 
-	variables, cleanup, err := core.GetAllEnvVars(identity, cfg, c.File)
+	load := core.GetAllEnvVars
+	if c.NoResolve {
+		load = core.GetUnresolvedEnvVars
+	}
+
+	variables, cleanup, err := load(identity, cfg, c.File)
 	if err != nil {
 		return err
 	}
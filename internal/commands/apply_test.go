@@ -293,3 +293,23 @@ access = ["*"]
 
 	return configPath, keyPath
 }
+
+// appendTestConfig appends content to the configuration written by setupTestEnvironment
+func appendTestConfig(t *testing.T, configPath, content string) {
+	t.Helper()
+
+	configFile, err := os.OpenFile(configPath, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatalf("Failed to open config: %v", err)
+	}
+
+	defer func() {
+		if err := configFile.Close(); err != nil {
+			t.Fatalf("Failed to close config: %v", err)
+		}
+	}()
+
+	if _, err := configFile.WriteString(content); err != nil {
+		t.Fatalf("Failed to extend config: %v", err)
+	}
+}
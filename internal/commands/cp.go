@@ -0,0 +1,44 @@
+package commands
+
+import (
+	"github.com/thunderbottom/kiln/internal/core"
+)
+
+// CpCmd represents the cp command for copying variables within and across files.
+type CpCmd struct {
+	Source      string `arg:"" help:"Variable to copy"`
+	Destination string `arg:"" help:"New variable name (defaults to the source name)" optional:""`
+	From        string `help:"Environment file to copy from" default:"default"`
+	To          string `help:"Environment file to copy to (defaults to --from)"`
+	Force       bool   `help:"Overwrite the destination variable if it exists"`
+}
+
+// Run executes the cp command, re-encrypting the destination file for its own recipients.
+func (c *CpCmd) Run(rt *Runtime) error {
+	rt.Logger.Debug().Str("command", "cp").Str("source", c.Source).Str("from", c.From).Str("to", c.To).Msg("validation started")
+
+	toFile, dstKey, err := validateTransfer(c.Source, c.Destination, c.From, c.To)
+	if err != nil {
+		rt.Logger.Warn().Err(err).Msg("validation failed")
+
+		return err
+	}
+
+	identity, err := rt.Identity()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := rt.Config()
+	if err != nil {
+		return err
+	}
+
+	if err := core.CopyEnvVar(identity, cfg, c.From, c.Source, toFile, dstKey, c.Force); err != nil {
+		return transferError(err)
+	}
+
+	rt.Logger.Info().Str("from", c.From+":"+c.Source).Str("to", toFile+":"+dstKey).Msg("copied successfully")
+
+	return nil
+}
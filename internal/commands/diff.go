@@ -0,0 +1,181 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/thunderbottom/kiln/internal/config"
+	"github.com/thunderbottom/kiln/internal/core"
+	kerrors "github.com/thunderbottom/kiln/internal/errors"
+)
+
+// DiffCmd represents the diff command for comparing two environment files,
+// or one file against its committed content at a git revision.
+type DiffCmd struct {
+	Old    string `arg:"" help:"Environment file to compare from" optional:""`
+	New    string `arg:"" help:"Environment file to compare to" optional:""`
+	Rev    string `help:"Compare --file against its content at this git revision (e.g. HEAD~1)" placeholder:"REV"`
+	File   string `short:"f" help:"Environment file to compare with --rev" default:"default"`
+	Reveal bool   `help:"Show plaintext values instead of hashes"`
+	Format string `help:"Output format" enum:"text,json" default:"text"`
+}
+
+// diffEntry is the JSON representation of a single change
+type diffEntry struct {
+	Key    string     `json:"key"`
+	Change string     `json:"change"`
+	Old    *diffValue `json:"old,omitempty"`
+	New    *diffValue `json:"new,omitempty"`
+}
+
+// diffValue describes one side of a change, masked unless --reveal is set
+type diffValue struct {
+	Length int     `json:"length"`
+	Hash   string  `json:"hash"`
+	Value  *string `json:"value,omitempty"`
+}
+
+func (c *DiffCmd) validate() error {
+	if c.Rev != "" {
+		if c.Old != "" || c.New != "" {
+			return kerrors.ValidationError("arguments", "use --file instead of file arguments with --rev")
+		}
+
+		if !core.IsValidGitRevision(c.Rev) {
+			return kerrors.ValidationError("revision", "must be a git revision such as HEAD~1 or a commit hash")
+		}
+
+		if !core.IsValidFileName(c.File) {
+			return kerrors.ValidationError("file name", "cannot contain '..' or '/' characters")
+		}
+
+		return nil
+	}
+
+	if c.Old == "" || c.New == "" {
+		return kerrors.ValidationError("arguments", "two files are required (or use --rev to compare against git history)")
+	}
+
+	if !core.IsValidFileName(c.Old) || !core.IsValidFileName(c.New) {
+		return kerrors.ValidationError("file name", "cannot contain '..' or '/' characters")
+	}
+
+	if c.Old == c.New {
+		return kerrors.ValidationError("arguments", "cannot diff a file against itself")
+	}
+
+	return nil
+}
+
+// Run executes the diff command, reporting added, removed and changed keys.
+func (c *DiffCmd) Run(rt *Runtime) error {
+	rt.Logger.Debug().Str("command", "diff").Str("old", c.Old).Str("new", c.New).Str("rev", c.Rev).Bool("reveal", c.Reveal).Msg("validation started")
+
+	if err := c.validate(); err != nil {
+		rt.Logger.Warn().Err(err).Msg("validation failed")
+
+		return err
+	}
+
+	identity, err := rt.Identity()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := rt.Config()
+	if err != nil {
+		return err
+	}
+
+	if c.Rev != "" {
+		return c.diffRevision(identity, cfg)
+	}
+
+	oldVars, oldCleanup, err := core.GetAllEnvVars(identity, cfg, c.Old)
+	if err != nil {
+		return err
+	}
+	defer oldCleanup()
+
+	newVars, newCleanup, err := core.GetAllEnvVars(identity, cfg, c.New)
+	if err != nil {
+		return err
+	}
+	defer newCleanup()
+
+	return printChanges(core.DiffEnvVars(oldVars, newVars), c.Format, c.Reveal)
+}
+
+// diffRevision compares the committed content of a file at --rev with the working copy
+func (c *DiffCmd) diffRevision(identity *core.Identity, cfg *config.Config) error {
+	oldVars, oldCleanup, err := core.GetEnvVarsAtRevision(identity, cfg, c.File, c.Rev)
+	if err != nil {
+		return err
+	}
+	defer oldCleanup()
+
+	newVars, newCleanup, err := core.GetFileEnvVars(identity, cfg, c.File)
+	if err != nil {
+		return err
+	}
+	defer newCleanup()
+
+	return printChanges(core.DiffEnvVars(oldVars, newVars), c.Format, c.Reveal)
+}
+
+// printChanges renders key-level changes in the requested format
+func printChanges(changes []core.VarChange, format string, reveal bool) error {
+	if format == "json" {
+		entries := make([]diffEntry, 0, len(changes))
+		for _, change := range changes {
+			entries = append(entries, diffEntry{
+				Key:    change.Key,
+				Change: string(change.Type),
+				Old:    newDiffValue(change.OldValue, change.Type != core.ChangeAdded, reveal),
+				New:    newDiffValue(change.NewValue, change.Type != core.ChangeRemoved, reveal),
+			})
+		}
+
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(entries)
+	}
+
+	for _, change := range changes {
+		switch change.Type {
+		case core.ChangeAdded:
+			fmt.Printf("+ %s=%s\n", change.Key, renderValue(change.NewValue, reveal))
+		case core.ChangeRemoved:
+			fmt.Printf("- %s=%s\n", change.Key, renderValue(change.OldValue, reveal))
+		case core.ChangeModified:
+			fmt.Printf("~ %s=%s -> %s\n", change.Key, renderValue(change.OldValue, reveal), renderValue(change.NewValue, reveal))
+		}
+	}
+
+	return nil
+}
+
+func newDiffValue(value []byte, present, reveal bool) *diffValue {
+	if !present {
+		return nil
+	}
+
+	result := &diffValue{Length: len(value), Hash: core.ShortHash(value)}
+	if reveal {
+		plaintext := string(value)
+		result.Value = &plaintext
+	}
+
+	return result
+}
+
+// renderValue masks a value as its hash and length unless reveal is set
+func renderValue(value []byte, reveal bool) string {
+	if reveal {
+		return string(value)
+	}
+
+	return fmt.Sprintf("<sha256:%s len=%d>", core.ShortHash(value), len(value))
+}
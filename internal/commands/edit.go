@@ -81,7 +81,7 @@ func (c *EditCmd) Run(rt *Runtime) error {
 }
 
 func (c *EditCmd) prepareContent(identity *core.Identity, cfg *config.Config) ([]byte, error) {
-	vars, cleanup, err := core.GetAllEnvVars(identity, cfg, c.File)
+	vars, cleanup, err := core.GetFileEnvVars(identity, cfg, c.File)
 	if err != nil {
 		return nil, err
 	}
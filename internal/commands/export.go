@@ -14,8 +14,9 @@ import (
 
 // ExportCmd represents the export command for outputting environment variables.
 type ExportCmd struct {
-	File   string `short:"f" help:"Environment file from the configuration to export" default:"default"`
-	Format string `help:"Output format" enum:"shell,json,yaml" default:"shell" placeholder:"[shell|json|yaml]"`
+	File      string `short:"f" help:"Environment file from the configuration to export" default:"default"`
+	Format    string `help:"Output format" enum:"shell,json,yaml" default:"shell" placeholder:"[shell|json|yaml]"`
+	NoResolve bool   `help:"Export references to other files in values unresolved"`
 }
 
 func (c *ExportCmd) validate() error {
@@ -46,7 +47,12 @@ func (c *ExportCmd) Run(rt *Runtime) error {
 		return err
 	}
 
-	variables, cleanup, err := core.GetAllEnvVars(identity, cfg, c.File)
+	load := core.GetAllEnvVars
+	if c.NoResolve {
+		load = core.GetUnresolvedEnvVars
+	}
+
+	variables, cleanup, err := load(identity, cfg, c.File)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,489 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/thunderbottom/kiln/internal/config"
+	"github.com/thunderbottom/kiln/internal/core"
+	kerrors "github.com/thunderbottom/kiln/internal/errors"
+)
+
+// FilesCmd represents the files command for managing environment file definitions.
+type FilesCmd struct {
+	Add     *FilesAddCmd     `cmd:"" help:"Declare a new environment file"`
+	Remove  *FilesRemoveCmd  `cmd:"" help:"Remove an environment file from the configuration"`
+	Rename  *FilesRenameCmd  `cmd:"" help:"Rename an environment file"`
+	Move    *FilesMoveCmd    `cmd:"" help:"Move the encrypted file to a new path"`
+	Convert *FilesConvertCmd `cmd:"" help:"Re-encrypt a file in another storage format"`
+}
+
+// FilesAddCmd represents the add subcommand of files.
+type FilesAddCmd struct {
+	Name   string   `arg:"" help:"File name used with --file"`
+	Path   string   `help:"Path of the encrypted file, relative to kiln.toml" required:""`
+	Access []string `short:"a" help:"Recipients or groups with access" default:"*"`
+}
+
+// FilesRemoveCmd represents the remove subcommand of files.
+type FilesRemoveCmd struct {
+	Name  string `arg:"" help:"File name"`
+	Shred bool   `help:"Overwrite and delete the encrypted file"`
+}
+
+// FilesRenameCmd represents the rename subcommand of files.
+type FilesRenameCmd struct {
+	Name    string `arg:"" help:"Current file name"`
+	NewName string `arg:"" help:"New file name"`
+}
+
+// FilesMoveCmd represents the move subcommand of files.
+type FilesMoveCmd struct {
+	Name string `arg:"" help:"File name"`
+	Path string `arg:"" help:"New path of the encrypted file, relative to kiln.toml"`
+}
+
+// FilesConvertCmd represents the convert subcommand of files.
+type FilesConvertCmd struct {
+	Name   string `arg:"" help:"File name"`
+	Format string `arg:"" help:"Storage format: 'file' encrypts the whole file, 'values' encrypts each value and keeps key names readable" enum:"file,values"`
+}
+
+func (c *FilesAddCmd) validate() error {
+	if !core.IsValidFileName(c.Name) {
+		return kerrors.ValidationError("file name", "cannot contain '..' or '/' characters")
+	}
+
+	if !core.IsValidFilePath(c.Path) {
+		return kerrors.ValidationError("path", "invalid file path")
+	}
+
+	return nil
+}
+
+// Run executes the files add command.
+func (c *FilesAddCmd) Run(rt *Runtime) error {
+	rt.Logger.Debug().Str("command", "files-add").Str("file", c.Name).Str("path", c.Path).Strs("access", c.Access).Msg("validation started")
+
+	if err := c.validate(); err != nil {
+		rt.Logger.Warn().Err(err).Msg("validation failed")
+
+		return err
+	}
+
+	cfg, err := rt.Config()
+	if err != nil {
+		return err
+	}
+
+	if _, exists := cfg.Files[c.Name]; exists {
+		return kerrors.ConfigError(fmt.Sprintf("file '%s' already exists", c.Name), "use 'kiln files move' to change its path")
+	}
+
+	filePath, err := resolveFilePath(rt, cfg, c.Path)
+	if err != nil {
+		return err
+	}
+
+	if err := cfg.ValidateAccess(c.Access); err != nil {
+		return kerrors.ConfigError(fmt.Sprintf("invalid access for file '%s': %v", c.Name, err), "add recipients with 'kiln recipients add' or groups with 'kiln groups create'")
+	}
+
+	if cfg.Files == nil {
+		cfg.Files = make(map[string]config.FileConfig)
+	}
+
+	cfg.Files[c.Name] = config.FileConfig{Filename: filePath, Access: dedupe(c.Access)}
+
+	if _, err := cfg.ResolveFileAccess(c.Name); err != nil {
+		return kerrors.ConfigError(err.Error(), "grant access to a group with members or to a recipient")
+	}
+
+	if err := cfg.Save(rt.ConfigPath()); err != nil {
+		return fmt.Errorf("save configuration: %w", err)
+	}
+
+	rt.Logger.Info().Str("file", c.Name).Str("path", filePath).Msg("file added")
+
+	return nil
+}
+
+func (c *FilesRemoveCmd) validate() error {
+	if !core.IsValidFileName(c.Name) {
+		return kerrors.ValidationError("file name", "cannot contain '..' or '/' characters")
+	}
+
+	return nil
+}
+
+// Run executes the files remove command.
+func (c *FilesRemoveCmd) Run(rt *Runtime) error {
+	rt.Logger.Debug().Str("command", "files-remove").Str("file", c.Name).Bool("shred", c.Shred).Msg("validation started")
+
+	if err := c.validate(); err != nil {
+		rt.Logger.Warn().Err(err).Msg("validation failed")
+
+		return err
+	}
+
+	cfg, err := rt.Config()
+	if err != nil {
+		return err
+	}
+
+	filePath, err := cfg.GetEnvFile(c.Name)
+	if err != nil {
+		return kerrors.ConfigError(fmt.Sprintf("file '%s' not configured", c.Name), "check kiln.toml file definitions")
+	}
+
+	if extending := cfg.FilesExtending(c.Name); len(extending) > 0 {
+		return kerrors.ConfigError(fmt.Sprintf("file '%s' is extended by %s", c.Name, strings.Join(extending, ", ")),
+			"remove it from their extends lists first")
+	}
+
+	if referencing := findReferences(rt, cfg, c.Name); len(referencing) > 0 {
+		return kerrors.ConfigError(fmt.Sprintf("file '%s' is referenced by %s", c.Name, strings.Join(referencing, ", ")),
+			fmt.Sprintf("remove their ${%s:KEY} references first", c.Name))
+	}
+
+	delete(cfg.Files, c.Name)
+
+	if err := cfg.Save(rt.ConfigPath()); err != nil {
+		return fmt.Errorf("save configuration: %w", err)
+	}
+
+	switch {
+	case !core.FileExists(filePath):
+		rt.Logger.Info().Str("file", c.Name).Msg("file removed")
+	case c.Shred:
+		if err := core.ShredFile(filePath); err != nil {
+			return kerrors.FileAccessError("shred", filePath, err)
+		}
+
+		rt.Logger.Info().Str("file", c.Name).Str("path", filePath).Msg("file removed and shredded")
+	default:
+		rt.Logger.Info().Str("file", c.Name).Str("path", filePath).Msg("file removed, encrypted file left in place")
+	}
+
+	return nil
+}
+
+func (c *FilesRenameCmd) validate() error {
+	if !core.IsValidFileName(c.Name) || !core.IsValidFileName(c.NewName) {
+		return kerrors.ValidationError("file name", "cannot contain '..' or '/' characters")
+	}
+
+	if c.Name == c.NewName {
+		return kerrors.ValidationError("arguments", "current and new names are the same")
+	}
+
+	return nil
+}
+
+// Run executes the files rename command. The encrypted file is only rewritten when files are
+// signed, as signatures name the file they belong to.
+func (c *FilesRenameCmd) Run(rt *Runtime) error {
+	rt.Logger.Debug().Str("command", "files-rename").Str("file", c.Name).Str("new_name", c.NewName).Msg("validation started")
+
+	if err := c.validate(); err != nil {
+		rt.Logger.Warn().Err(err).Msg("validation failed")
+
+		return err
+	}
+
+	cfg, err := rt.Config()
+	if err != nil {
+		return err
+	}
+
+	fileConfig, exists := cfg.Files[c.Name]
+	if !exists {
+		return kerrors.ConfigError(fmt.Sprintf("file '%s' not configured", c.Name), "check kiln.toml file definitions")
+	}
+
+	if _, exists := cfg.Files[c.NewName]; exists {
+		return kerrors.ConfigError(fmt.Sprintf("file '%s' already exists", c.NewName), "choose a different name")
+	}
+
+	var (
+		identity  *core.Identity
+		variables map[string][]byte
+	)
+
+	if len(cfg.Signers) > 0 && core.FileExists(fileConfig.Filename) {
+		if identity, err = rt.Identity(); err != nil {
+			return err
+		}
+
+		envVars, cleanup, err := core.GetFileEnvVars(identity, cfg, c.Name)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+
+		variables = envVars
+	}
+
+	referencing := findReferences(rt, cfg, c.Name)
+
+	delete(cfg.Files, c.Name)
+	cfg.Files[c.NewName] = fileConfig
+
+	for _, fileName := range cfg.FilesExtending(c.Name) {
+		extending := cfg.Files[fileName]
+		extending.Extends = slices.Clone(extending.Extends)
+
+		for i, name := range extending.Extends {
+			if name == c.Name {
+				extending.Extends[i] = c.NewName
+			}
+		}
+
+		cfg.Files[fileName] = extending
+	}
+
+	if err := cfg.Save(rt.ConfigPath()); err != nil {
+		return fmt.Errorf("save configuration: %w", err)
+	}
+
+	if variables != nil {
+		if err := core.SaveAllEnvVars(identity, cfg, c.NewName, variables); err != nil {
+			return err
+		}
+
+		rt.Logger.Info().Str("file", c.NewName).Msg("re-signed")
+	}
+
+	// References are stored encrypted in the files that make them, so they are not rewritten
+	if len(referencing) > 0 {
+		fmt.Fprintf(os.Stderr, "warning: %s still reference '%s'; change ${%s:KEY} to ${%s:KEY} in them with 'kiln edit'\n",
+			strings.Join(referencing, ", "), c.Name, c.Name, c.NewName)
+	}
+
+	rt.Logger.Info().Str("file", c.Name).Str("new_name", c.NewName).Msg("file renamed")
+
+	return nil
+}
+
+func (c *FilesMoveCmd) validate() error {
+	if !core.IsValidFileName(c.Name) {
+		return kerrors.ValidationError("file name", "cannot contain '..' or '/' characters")
+	}
+
+	if !core.IsValidFilePath(c.Path) {
+		return kerrors.ValidationError("path", "invalid file path")
+	}
+
+	return nil
+}
+
+// Run executes the files move command, moving the encrypted file and updating its path.
+func (c *FilesMoveCmd) Run(rt *Runtime) error {
+	rt.Logger.Debug().Str("command", "files-move").Str("file", c.Name).Str("path", c.Path).Msg("validation started")
+
+	if err := c.validate(); err != nil {
+		rt.Logger.Warn().Err(err).Msg("validation failed")
+
+		return err
+	}
+
+	cfg, err := rt.Config()
+	if err != nil {
+		return err
+	}
+
+	fileConfig, exists := cfg.Files[c.Name]
+	if !exists {
+		return kerrors.ConfigError(fmt.Sprintf("file '%s' not configured", c.Name), "check kiln.toml file definitions")
+	}
+
+	newPath, err := resolveFilePath(rt, cfg, c.Path)
+	if err != nil {
+		return err
+	}
+
+	oldPath := fileConfig.Filename
+	moved := core.FileExists(oldPath)
+
+	if moved {
+		if core.FileExists(newPath) {
+			return kerrors.FileAccessError("move", newPath, os.ErrExist)
+		}
+
+		if err := moveFile(oldPath, newPath); err != nil {
+			return kerrors.FileAccessError("move", oldPath, err)
+		}
+	}
+
+	fileConfig.Filename = newPath
+	cfg.Files[c.Name] = fileConfig
+
+	if err := cfg.Save(rt.ConfigPath()); err != nil {
+		if moved {
+			if restoreErr := moveFile(newPath, oldPath); restoreErr != nil {
+				rt.Logger.Error().Err(restoreErr).Str("path", newPath).Msg("failed to move encrypted file back")
+			}
+		}
+
+		return fmt.Errorf("save configuration: %w", err)
+	}
+
+	rt.Logger.Info().Str("file", c.Name).Str("from", oldPath).Str("to", newPath).Msg("file moved")
+
+	return nil
+}
+
+func (c *FilesConvertCmd) validate() error {
+	if !core.IsValidFileName(c.Name) {
+		return kerrors.ValidationError("file name", "cannot contain '..' or '/' characters")
+	}
+
+	return nil
+}
+
+// Run executes the files convert command, recording the format in kiln.toml and re-encrypting
+// the file in it.
+func (c *FilesConvertCmd) Run(rt *Runtime) error {
+	rt.Logger.Debug().Str("command", "files-convert").Str("file", c.Name).Str("format", c.Format).Msg("validation started")
+
+	if err := c.validate(); err != nil {
+		rt.Logger.Warn().Err(err).Msg("validation failed")
+
+		return err
+	}
+
+	cfg, err := rt.Config()
+	if err != nil {
+		return err
+	}
+
+	fileConfig, exists := cfg.Files[c.Name]
+	if !exists {
+		return kerrors.ConfigError(fmt.Sprintf("file '%s' not configured", c.Name), "check kiln.toml file definitions")
+	}
+
+	// The default format is left implicit in kiln.toml
+	fileConfig.Format = c.Format
+	if c.Format == config.FormatFile {
+		fileConfig.Format = ""
+	}
+
+	cfg.Files[c.Name] = fileConfig
+
+	if !core.FileExists(fileConfig.Filename) {
+		if err := cfg.Save(rt.ConfigPath()); err != nil {
+			return fmt.Errorf("save configuration: %w", err)
+		}
+
+		rt.Logger.Info().Str("file", c.Name).Str("format", c.Format).Msg("format set (file will be created in it when variables are added)")
+
+		return nil
+	}
+
+	current, err := core.FileFormatCurrent(cfg, c.Name)
+	if err != nil {
+		return err
+	}
+
+	if current {
+		if err := cfg.Save(rt.ConfigPath()); err != nil {
+			return fmt.Errorf("save configuration: %w", err)
+		}
+
+		rt.Logger.Info().Str("file", c.Name).Str("format", c.Format).Msg("already in format")
+
+		return nil
+	}
+
+	identity, err := rt.Identity()
+	if err != nil {
+		return err
+	}
+
+	envVars, cleanup, err := core.GetFileEnvVars(identity, cfg, c.Name)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if err := cfg.Save(rt.ConfigPath()); err != nil {
+		return fmt.Errorf("save configuration: %w", err)
+	}
+
+	if err := core.SaveAllEnvVars(identity, cfg, c.Name, envVars); err != nil {
+		return err
+	}
+
+	rt.Logger.Info().Str("file", c.Name).Str("format", c.Format).Int("variables", len(envVars)).Msg("file converted")
+
+	return nil
+}
+
+// resolveFilePath resolves a path relative to the configuration directory, as paths in kiln.toml are,
+// and rejects paths already used by another configured file
+func resolveFilePath(rt *Runtime, cfg *config.Config, path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		configPath, err := filepath.Abs(rt.ConfigPath())
+		if err != nil {
+			return "", err
+		}
+
+		path = filepath.Join(filepath.Dir(configPath), path)
+	}
+
+	path = filepath.Clean(path)
+
+	if existing, exists := cfg.FileNameForPath(path); exists {
+		return "", kerrors.ConfigError(fmt.Sprintf("path '%s' is already used by file '%s'", path, existing), "choose a different path")
+	}
+
+	return path, nil
+}
+
+// moveFile renames src to dst, falling back to copy and remove across filesystems
+func moveFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o700); err != nil {
+		return err
+	}
+
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	data, readErr := core.ReadFile(src)
+	if readErr != nil {
+		return err
+	}
+
+	if err := core.WriteFile(dst, data); err != nil {
+		return err
+	}
+
+	return os.Remove(src)
+}
+
+// findReferences returns the files that reference variables of name, warning about the files
+// that cannot be checked because the current identity cannot decrypt them
+func findReferences(rt *Runtime, cfg *config.Config, name string) []string {
+	identity, err := rt.Identity()
+	if err != nil {
+		rt.Logger.Debug().Err(err).Msg("no identity to check references with")
+	}
+
+	referencing, unchecked := core.FilesReferencing(identity, cfg, name)
+	if len(unchecked) > 0 {
+		fmt.Fprintf(os.Stderr, "warning: cannot check %s for references to '%s'\n", strings.Join(unchecked, ", "), name)
+	}
+
+	return referencing
+}
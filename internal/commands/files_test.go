@@ -0,0 +1,312 @@
+package commands
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/thunderbottom/kiln/internal/config"
+	"github.com/thunderbottom/kiln/internal/core"
+)
+
+func TestFilesAddCmd_Run(t *testing.T) {
+	tmpDir := createTempDir(t)
+	configPath, keyPath := setupTestEnvironment(t, tmpDir)
+
+	runtime, err := NewRuntime(configPath, keyPath, false)
+	if err != nil {
+		t.Fatalf("NewRuntime failed: %v", err)
+	}
+	defer runtime.Cleanup()
+
+	invalid := &FilesAddCmd{Name: "staging", Path: "envs/staging.env", Access: []string{"mallory"}}
+	if err := invalid.Run(runtime); err == nil {
+		t.Error("Expected unknown accessor to be rejected")
+	}
+
+	cmd := &FilesAddCmd{Name: "staging", Path: "envs/staging.env", Access: []string{"test-user"}}
+	if err := cmd.Run(runtime); err != nil {
+		t.Fatalf("FilesAddCmd.Run() failed: %v", err)
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("config.Load failed: %v", err)
+	}
+
+	fileConfig, exists := cfg.Files["staging"]
+	if !exists {
+		t.Fatal("Expected staging to be configured")
+	}
+
+	if want := filepath.Join(tmpDir, "envs", "staging.env"); fileConfig.Filename != want {
+		t.Errorf("Expected path %q, got %q", want, fileConfig.Filename)
+	}
+
+	if !reflect.DeepEqual(fileConfig.Access, []string{"test-user"}) {
+		t.Errorf("Expected access [test-user], got %v", fileConfig.Access)
+	}
+}
+
+func TestFilesMoveCmd_Run(t *testing.T) {
+	tmpDir := createTempDir(t)
+	configPath, keyPath := setupTestEnvironment(t, tmpDir)
+
+	identity, err := core.NewIdentityFromKey(keyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("config.Load failed: %v", err)
+	}
+
+	if err := core.SetEnvVar(identity, cfg, "default", "KEY", []byte("value")); err != nil {
+		t.Fatalf("SetEnvVar failed: %v", err)
+	}
+
+	oldPath := cfg.Files["default"].Filename
+
+	runtime, err := NewRuntime(configPath, keyPath, false)
+	if err != nil {
+		t.Fatalf("NewRuntime failed: %v", err)
+	}
+	defer runtime.Cleanup()
+
+	cmd := &FilesMoveCmd{Name: "default", Path: "envs/default.env"}
+	if err := cmd.Run(runtime); err != nil {
+		t.Fatalf("FilesMoveCmd.Run() failed: %v", err)
+	}
+
+	newPath := filepath.Join(tmpDir, "envs", "default.env")
+	if core.FileExists(oldPath) || !core.FileExists(newPath) {
+		t.Fatalf("Expected encrypted file to move from %s to %s", oldPath, newPath)
+	}
+
+	updated, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("config.Load failed: %v", err)
+	}
+
+	value, cleanup, err := core.GetEnvVar(identity, updated, "default", "KEY")
+	if err != nil {
+		t.Fatalf("GetEnvVar failed after move: %v", err)
+	}
+	defer cleanup()
+
+	if string(value) != "value" {
+		t.Errorf("Expected value %q, got %q", "value", value)
+	}
+}
+
+func TestFilesRenameCmd_RunExtends(t *testing.T) {
+	tmpDir := createTempDir(t)
+	configPath, keyPath := setupTestEnvironment(t, tmpDir)
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("config.Load failed: %v", err)
+	}
+
+	cfg.Files["prod"] = config.FileConfig{Filename: filepath.Join(tmpDir, "prod.env"), Access: []string{"*"}, Extends: []string{"default"}}
+
+	if err := cfg.Save(configPath); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	runtime, err := NewRuntime(configPath, keyPath, false)
+	if err != nil {
+		t.Fatalf("NewRuntime failed: %v", err)
+	}
+	defer runtime.Cleanup()
+
+	if err := (&FilesRemoveCmd{Name: "default"}).Run(runtime); err == nil {
+		t.Error("Expected removing an extended file to be rejected")
+	}
+
+	if err := (&FilesRenameCmd{Name: "default", NewName: "base"}).Run(runtime); err != nil {
+		t.Fatalf("FilesRenameCmd.Run() failed: %v", err)
+	}
+
+	updated, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("config.Load failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(updated.Files["prod"].Extends, []string{"base"}) {
+		t.Errorf("Expected prod to extend [base], got %v", updated.Files["prod"].Extends)
+	}
+}
+
+func TestFilesRenameCmd_RunSigned(t *testing.T) {
+	tmpDir := createTempDir(t)
+	configPath, keyPath := setupTestEnvironment(t, tmpDir)
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("config.Load failed: %v", err)
+	}
+
+	cfg.Signers = []string{"test-user"}
+	cfg.SignaturePolicy = config.SignaturePolicyRefuse
+
+	if err := cfg.Save(configPath); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	identity, err := core.NewIdentityFromKey(keyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	if err := core.SetEnvVar(identity, cfg, "default", "KEY", []byte("value")); err != nil {
+		t.Fatalf("SetEnvVar failed: %v", err)
+	}
+
+	runtime, err := NewRuntime(configPath, keyPath, false)
+	if err != nil {
+		t.Fatalf("NewRuntime failed: %v", err)
+	}
+	defer runtime.Cleanup()
+
+	if err := (&FilesRenameCmd{Name: "default", NewName: "base"}).Run(runtime); err != nil {
+		t.Fatalf("FilesRenameCmd.Run() failed: %v", err)
+	}
+
+	updated, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("config.Load failed: %v", err)
+	}
+
+	// Signatures name the file, so the renamed file must have been signed again
+	value, cleanup, err := core.GetEnvVar(identity, updated, "base", "KEY")
+	if err != nil {
+		t.Fatalf("Expected the renamed file to be readable, got %v", err)
+	}
+	defer cleanup()
+
+	if string(value) != "value" {
+		t.Errorf("Expected 'value', got %q", value)
+	}
+}
+
+func TestFilesRemoveCmd_RunReferences(t *testing.T) {
+	tmpDir := createTempDir(t)
+	configPath, keyPath := setupTestEnvironment(t, tmpDir)
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("config.Load failed: %v", err)
+	}
+
+	cfg.Files["shared"] = config.FileConfig{Filename: filepath.Join(tmpDir, "shared.env"), Access: []string{"*"}}
+	cfg.Files["docs"] = config.FileConfig{Filename: filepath.Join(tmpDir, "docs.env"), Access: []string{"*"}, References: true}
+
+	fileConfig := cfg.Files["default"]
+	fileConfig.References = true
+	cfg.Files["default"] = fileConfig
+
+	if err := cfg.Save(configPath); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	identity, err := core.NewIdentityFromKey(keyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	variables := map[string]map[string][]byte{
+		"shared":  {"HOST": []byte("db.internal")},
+		"default": {"URL": []byte("postgres://${shared:HOST}")},
+		// Escaped, so not a reference
+		"docs": {"EXAMPLE": []byte("$${shared:HOST}")},
+	}
+
+	for fileName, vars := range variables {
+		if err := core.SaveAllEnvVars(identity, cfg, fileName, vars); err != nil {
+			t.Fatalf("SaveAllEnvVars(%s) failed: %v", fileName, err)
+		}
+	}
+
+	runtime, err := NewRuntime(configPath, keyPath, false)
+	if err != nil {
+		t.Fatalf("NewRuntime failed: %v", err)
+	}
+	defer runtime.Cleanup()
+
+	err = (&FilesRemoveCmd{Name: "shared"}).Run(runtime)
+	if err == nil || !strings.Contains(err.Error(), "referenced by default") {
+		t.Fatalf("Expected removing a referenced file to be rejected, got %v", err)
+	}
+
+	if err := core.SaveAllEnvVars(identity, cfg, "default", map[string][]byte{"URL": []byte("postgres://db.internal")}); err != nil {
+		t.Fatalf("SaveAllEnvVars failed: %v", err)
+	}
+
+	if err := (&FilesRemoveCmd{Name: "shared"}).Run(runtime); err != nil {
+		t.Fatalf("FilesRemoveCmd.Run() failed: %v", err)
+	}
+}
+
+func TestFilesConvertCmd_Run(t *testing.T) {
+	tmpDir := createTempDir(t)
+	configPath, keyPath := setupTestEnvironment(t, tmpDir)
+
+	identity, err := core.NewIdentityFromKey(keyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("config.Load failed: %v", err)
+	}
+
+	if err := core.SetEnvVar(identity, cfg, "default", "KEY", []byte("value")); err != nil {
+		t.Fatalf("SetEnvVar failed: %v", err)
+	}
+
+	runtime, err := NewRuntime(configPath, keyPath, false)
+	if err != nil {
+		t.Fatalf("NewRuntime failed: %v", err)
+	}
+	defer runtime.Cleanup()
+
+	for _, format := range []string{config.FormatValues, config.FormatFile} {
+		cmd := &FilesConvertCmd{Name: "default", Format: format}
+		if err := cmd.Run(runtime); err != nil {
+			t.Fatalf("FilesConvertCmd.Run(%s) failed: %v", format, err)
+		}
+
+		updated, err := config.Load(configPath)
+		if err != nil {
+			t.Fatalf("config.Load failed: %v", err)
+		}
+
+		if updated.FileFormat("default") != format {
+			t.Errorf("Expected format %q in kiln.toml, got %q", format, updated.FileFormat("default"))
+		}
+
+		data, err := core.ReadFile(updated.Files["default"].Filename)
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+
+		if core.IsValuesFormat(data) != (format == config.FormatValues) {
+			t.Errorf("Expected file to be stored in %s format", format)
+		}
+
+		value, cleanup, err := core.GetEnvVar(identity, updated, "default", "KEY")
+		if err != nil {
+			t.Fatalf("GetEnvVar failed after converting to %s: %v", format, err)
+		}
+
+		if string(value) != "value" {
+			t.Errorf("Expected value %q, got %q", "value", value)
+		}
+
+		cleanup()
+	}
+}
@@ -11,9 +11,10 @@ import (
 
 // GetCmd represents the get command for retrieving a single environment variable.
 type GetCmd struct {
-	Name   string `arg:"" help:"Environment variable name"`
-	File   string `short:"f" help:"Environment file to read from" default:"default"`
-	Format string `help:"Output format" enum:"value,json" default:"value"`
+	Name      string `arg:"" help:"Environment variable name"`
+	File      string `short:"f" help:"Environment file to read from" default:"default"`
+	Format    string `help:"Output format" enum:"value,json" default:"value"`
+	NoResolve bool   `help:"Print the value as stored, with references to other files unresolved"`
 }
 
 func (c *GetCmd) validate() error {
@@ -34,7 +35,7 @@ func (c *GetCmd) validate() error {
 
 // Run executes the get command, retrieving and displaying a specific variable.
 func (c *GetCmd) Run(rt *Runtime) error {
-	rt.Logger.Debug().Str("command", "get").Str("variable", c.Name).Str("file", c.File).Msg("validation started")
+	rt.Logger.Debug().Str("command", "get").Str("variable", c.Name).Str("file", c.File).Bool("no_resolve", c.NoResolve).Msg("validation started")
 
 	if err := c.validate(); err != nil {
 		rt.Logger.Warn().Err(err).Msg("validation failed")
@@ -52,7 +53,12 @@ func (c *GetCmd) Run(rt *Runtime) error {
 		return err
 	}
 
-	value, cleanup, err := core.GetEnvVar(identity, cfg, c.File, c.Name)
+	get := core.GetEnvVar
+	if c.NoResolve {
+		get = core.GetUnresolvedEnvVar
+	}
+
+	value, cleanup, err := get(identity, cfg, c.File, c.Name)
 	if err != nil {
 		return err
 	}
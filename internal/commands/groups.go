@@ -0,0 +1,354 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/thunderbottom/kiln/internal/config"
+	kerrors "github.com/thunderbottom/kiln/internal/errors"
+)
+
+// GroupsCmd represents the groups command for managing group membership.
+type GroupsCmd struct {
+	Create       *GroupsCreateCmd       `cmd:"" help:"Create a group"`
+	Delete       *GroupsDeleteCmd       `cmd:"" help:"Delete a group and re-encrypt affected files"`
+	AddMember    *GroupsAddMemberCmd    `cmd:"" help:"Add recipients to a group and re-encrypt affected files"`
+	RemoveMember *GroupsRemoveMemberCmd `cmd:"" help:"Remove recipients from a group and re-encrypt affected files"`
+	List         *GroupsListCmd         `cmd:"" help:"List groups, their members and the files that reference them"`
+}
+
+// GroupsCreateCmd represents the create subcommand of groups.
+type GroupsCreateCmd struct {
+	Name    string   `arg:"" help:"Group name"`
+	Members []string `arg:"" help:"Initial members (recipients, or groups prefixed with '@')" optional:""`
+}
+
+// GroupsDeleteCmd represents the delete subcommand of groups.
+type GroupsDeleteCmd struct {
+	Name  string `arg:"" help:"Group name"`
+	Force bool   `help:"Also remove the group from file access lists and groups that reference it"`
+}
+
+// GroupsAddMemberCmd represents the add-member subcommand of groups.
+type GroupsAddMemberCmd struct {
+	Name    string   `arg:"" help:"Group name"`
+	Members []string `arg:"" help:"Recipients, or groups prefixed with '@', to add"`
+}
+
+// GroupsRemoveMemberCmd represents the remove-member subcommand of groups.
+type GroupsRemoveMemberCmd struct {
+	Name    string   `arg:"" help:"Group name"`
+	Members []string `arg:"" help:"Recipients, or groups prefixed with '@', to remove"`
+}
+
+// GroupsListCmd represents the list subcommand of groups.
+type GroupsListCmd struct {
+	Format string `help:"Output format" enum:"text,json" default:"text"`
+}
+
+// groupInfo describes a group and the files that reference it
+type groupInfo struct {
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+	Files   []string `json:"files"`
+}
+
+func (c *GroupsCreateCmd) validate() error {
+	return validateGroupName(c.Name)
+}
+
+// Run executes the groups create command.
+func (c *GroupsCreateCmd) Run(rt *Runtime) error {
+	rt.Logger.Debug().Str("command", "groups-create").Str("group", c.Name).Strs("members", c.Members).Msg("validation started")
+
+	if err := c.validate(); err != nil {
+		rt.Logger.Warn().Err(err).Msg("validation failed")
+
+		return err
+	}
+
+	cfg, err := rt.Config()
+	if err != nil {
+		return err
+	}
+
+	if _, exists := cfg.Groups[c.Name]; exists {
+		return kerrors.ConfigError(fmt.Sprintf("group '%s' already exists", c.Name), "use 'kiln groups add-member' to change its members")
+	}
+
+	if _, exists := cfg.Recipients[c.Name]; exists {
+		return kerrors.ConfigError(fmt.Sprintf("'%s' is already a recipient name", c.Name), "use a different group name")
+	}
+
+	if err := checkMembers(cfg, c.Members); err != nil {
+		return err
+	}
+
+	// No file references a new group yet, so this only saves the configuration
+	_, cleanup, err := updateAccess(rt, cfg, func() error {
+		if cfg.Groups == nil {
+			cfg.Groups = make(map[string][]string)
+		}
+
+		cfg.Groups[c.Name] = dedupe(c.Members)
+
+		return checkGroupCycles(cfg)
+	})
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	rt.Logger.Info().Str("group", c.Name).Strs("members", c.Members).Msg("group created")
+
+	return nil
+}
+
+func (c *GroupsDeleteCmd) validate() error {
+	return validateGroupName(c.Name)
+}
+
+// Run executes the groups delete command.
+func (c *GroupsDeleteCmd) Run(rt *Runtime) error {
+	rt.Logger.Debug().Str("command", "groups-delete").Str("group", c.Name).Bool("force", c.Force).Msg("validation started")
+
+	if err := c.validate(); err != nil {
+		rt.Logger.Warn().Err(err).Msg("validation failed")
+
+		return err
+	}
+
+	cfg, err := rt.Config()
+	if err != nil {
+		return err
+	}
+
+	if err := checkGroup(cfg, c.Name); err != nil {
+		return err
+	}
+
+	if files := cfg.FilesReferencing(c.Name); len(files) > 0 && !c.Force {
+		return kerrors.ConfigError(fmt.Sprintf("group '%s' is used by files %v", c.Name, files), "use --force to remove it from their access lists")
+	}
+
+	if groups := cfg.GroupsContaining(config.GroupPrefix + c.Name); len(groups) > 0 && !c.Force {
+		return kerrors.ConfigError(fmt.Sprintf("group '%s' is included in groups %v", c.Name, groups), "use --force to remove it from those groups")
+	}
+
+	if slices.Contains(cfg.Signers, c.Name) && !c.Force {
+		return kerrors.ConfigError(fmt.Sprintf("group '%s' is listed in signers", c.Name), "use --force to remove it from signers")
+	}
+
+	update, cleanup, err := updateAccess(rt, cfg, func() error {
+		cfg.RemoveGroup(c.Name)
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	rt.Logger.Info().Str("group", c.Name).Strs("rekeyed", update.Files).Msg("group deleted")
+
+	return nil
+}
+
+func (c *GroupsAddMemberCmd) validate() error {
+	if len(c.Members) == 0 {
+		return kerrors.ValidationError("members", "at least one member is required")
+	}
+
+	return validateGroupName(c.Name)
+}
+
+// Run executes the groups add-member command.
+func (c *GroupsAddMemberCmd) Run(rt *Runtime) error {
+	rt.Logger.Debug().Str("command", "groups-add-member").Str("group", c.Name).Strs("members", c.Members).Msg("validation started")
+
+	if err := c.validate(); err != nil {
+		rt.Logger.Warn().Err(err).Msg("validation failed")
+
+		return err
+	}
+
+	cfg, err := rt.Config()
+	if err != nil {
+		return err
+	}
+
+	if err := checkGroup(cfg, c.Name); err != nil {
+		return err
+	}
+
+	if err := checkMembers(cfg, c.Members); err != nil {
+		return err
+	}
+
+	update, cleanup, err := updateAccess(rt, cfg, func() error {
+		cfg.Groups[c.Name] = dedupe(append(cfg.Groups[c.Name], c.Members...))
+
+		return checkGroupCycles(cfg)
+	})
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	rt.Logger.Info().Str("group", c.Name).Strs("members", c.Members).Strs("rekeyed", update.Files).Msg("members added")
+
+	return nil
+}
+
+func (c *GroupsRemoveMemberCmd) validate() error {
+	if len(c.Members) == 0 {
+		return kerrors.ValidationError("members", "at least one member is required")
+	}
+
+	return validateGroupName(c.Name)
+}
+
+// Run executes the groups remove-member command.
+func (c *GroupsRemoveMemberCmd) Run(rt *Runtime) error {
+	rt.Logger.Debug().Str("command", "groups-remove-member").Str("group", c.Name).Strs("members", c.Members).Msg("validation started")
+
+	if err := c.validate(); err != nil {
+		rt.Logger.Warn().Err(err).Msg("validation failed")
+
+		return err
+	}
+
+	cfg, err := rt.Config()
+	if err != nil {
+		return err
+	}
+
+	if err := checkGroup(cfg, c.Name); err != nil {
+		return err
+	}
+
+	for _, member := range c.Members {
+		if !slices.Contains(cfg.Groups[c.Name], member) {
+			return kerrors.ConfigError(fmt.Sprintf("'%s' is not a member of group '%s'", member, c.Name), "check group members with 'kiln groups list'")
+		}
+	}
+
+	update, cleanup, err := updateAccess(rt, cfg, func() error {
+		cfg.Groups[c.Name] = slices.DeleteFunc(cfg.Groups[c.Name], func(member string) bool {
+			return slices.Contains(c.Members, member)
+		})
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	rt.Logger.Info().Str("group", c.Name).Strs("members", c.Members).Strs("rekeyed", update.Files).Msg("members removed")
+
+	return nil
+}
+
+// Run executes the groups list command.
+func (c *GroupsListCmd) Run(rt *Runtime) error {
+	rt.Logger.Debug().Str("command", "groups-list").Str("format", c.Format).Msg("validation started")
+
+	cfg, err := rt.Config()
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(cfg.Groups))
+	for name := range cfg.Groups {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	infos := make([]groupInfo, 0, len(names))
+	for _, name := range names {
+		infos = append(infos, groupInfo{
+			Name:    name,
+			Members: append([]string{}, cfg.Groups[name]...),
+			Files:   append([]string{}, cfg.FilesReferencing(name)...),
+		})
+	}
+
+	if c.Format == "json" {
+		return printJSON(infos)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(writer, "GROUP\tMEMBERS\tFILES")
+
+	for _, info := range infos {
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", info.Name, joinOrDash(info.Members), joinOrDash(info.Files))
+	}
+
+	return writer.Flush()
+}
+
+// checkGroup verifies that a group exists
+func checkGroup(cfg *config.Config, name string) error {
+	if _, exists := cfg.Groups[name]; !exists {
+		return kerrors.ConfigError(fmt.Sprintf("group '%s' not found", name), "check group names with 'kiln groups list'")
+	}
+
+	return nil
+}
+
+// checkMembers verifies that every member is a configured recipient, or an existing group
+// when prefixed with config.GroupPrefix
+func checkMembers(cfg *config.Config, members []string) error {
+	for _, member := range members {
+		if group, isGroup := strings.CutPrefix(member, config.GroupPrefix); isGroup {
+			if err := checkGroup(cfg, group); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if _, exists := cfg.Recipients[member]; !exists {
+			return kerrors.ConfigError(fmt.Sprintf("recipient '%s' not found", member), "add it first with 'kiln recipients add'")
+		}
+	}
+
+	return nil
+}
+
+// checkGroupCycles rejects group changes that make nested groups refer back to themselves
+func checkGroupCycles(cfg *config.Config) error {
+	if err := cfg.ValidateGroups(); err != nil {
+		return kerrors.ConfigError(err.Error(), "remove one of the nested group references")
+	}
+
+	return nil
+}
+
+// validateGroupName rejects names that cannot be used in access lists
+func validateGroupName(name string) error {
+	if err := validateRecipientName(name); err != nil {
+		return kerrors.ValidationError("group name", "cannot be empty or '*', start with '@', or contain whitespace, ',' or '='")
+	}
+
+	return nil
+}
+
+// dedupe removes repeated entries while keeping the first occurrence of each
+func dedupe(values []string) []string {
+	result := make([]string, 0, len(values))
+
+	for _, value := range values {
+		if !slices.Contains(result, value) {
+			result = append(result, value)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,133 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/thunderbottom/kiln/internal/config"
+	"github.com/thunderbottom/kiln/internal/core"
+)
+
+func TestGroupsCmd_validate(t *testing.T) {
+	if err := (&GroupsCreateCmd{Name: "ops"}).validate(); err != nil {
+		t.Errorf("Expected valid group name, got %v", err)
+	}
+
+	if err := (&GroupsCreateCmd{Name: "*"}).validate(); err == nil {
+		t.Error("Expected wildcard group name to be rejected")
+	}
+
+	if err := (&GroupsCreateCmd{Name: "@ops"}).validate(); err == nil {
+		t.Error("Expected group name with '@' prefix to be rejected")
+	}
+
+	if err := (&GroupsAddMemberCmd{Name: "ops"}).validate(); err == nil {
+		t.Error("Expected add-member without members to be rejected")
+	}
+}
+
+func TestGroupsAddMemberCmd_Run(t *testing.T) {
+	tmpDir := createTempDir(t)
+	configPath, keyPath := setupTestEnvironment(t, tmpDir)
+
+	bobKey, bobPublicKey, err := core.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+
+	bobKeyPath := filepath.Join(tmpDir, "bob.key")
+	if err := core.SaveKeys(bobKey, bobPublicKey, bobKeyPath); err != nil {
+		t.Fatalf("SaveKeys failed: %v", err)
+	}
+
+	prodPath := filepath.Join(tmpDir, "prod.env")
+	stagingPath := filepath.Join(tmpDir, "staging.env")
+
+	publicKey, err := os.ReadFile(keyPath + ".pub")
+	if err != nil {
+		t.Fatalf("Failed to read public key: %v", err)
+	}
+
+	configContent := fmt.Sprintf(`[recipients]
+test-user = %q
+bob = %q
+
+[groups]
+ops = ["test-user"]
+
+[files.prod]
+filename = %q
+access = ["ops"]
+
+[files.staging]
+filename = %q
+access = ["test-user"]
+`, bytes.TrimSpace(publicKey), bobPublicKey, prodPath, stagingPath)
+
+	if err := os.WriteFile(configPath, []byte(configContent), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	identity, err := core.NewIdentityFromKey(keyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("config.Load failed: %v", err)
+	}
+
+	for _, fileName := range []string{"prod", "staging"} {
+		if err := core.SetEnvVar(identity, cfg, fileName, "KEY", []byte("value")); err != nil {
+			t.Fatalf("SetEnvVar failed: %v", err)
+		}
+	}
+
+	stagingBefore, err := os.ReadFile(stagingPath)
+	if err != nil {
+		t.Fatalf("Failed to read staging file: %v", err)
+	}
+
+	runtime, err := NewRuntime(configPath, keyPath, false)
+	if err != nil {
+		t.Fatalf("NewRuntime failed: %v", err)
+	}
+	defer runtime.Cleanup()
+
+	cmd := &GroupsAddMemberCmd{Name: "ops", Members: []string{"bob"}}
+	if err := cmd.Run(runtime); err != nil {
+		t.Fatalf("GroupsAddMemberCmd.Run() failed: %v", err)
+	}
+
+	updated, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("config.Load failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(updated.Groups["ops"], []string{"test-user", "bob"}) {
+		t.Errorf("Expected ops members [test-user bob], got %v", updated.Groups["ops"])
+	}
+
+	bobIdentity, err := core.NewIdentityFromKey(bobKeyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	if err := core.CheckEnvFile(bobIdentity, updated, "prod"); err != nil {
+		t.Errorf("bob should be able to decrypt prod: %v", err)
+	}
+
+	stagingAfter, err := os.ReadFile(stagingPath)
+	if err != nil {
+		t.Fatalf("Failed to read staging file: %v", err)
+	}
+
+	if !bytes.Equal(stagingBefore, stagingAfter) {
+		t.Error("staging does not use the group and should not have been re-encrypted")
+	}
+}
@@ -38,6 +38,12 @@ func (c *InfoCmd) Run(rt *Runtime) error {
 		return err
 	}
 
+	fmt.Printf("config: %s\n", rt.ConfigPath())
+
+	for _, include := range cfg.IncludedFiles() {
+		fmt.Printf("include: %s\n", include)
+	}
+
 	var filesToCheck []string
 	if c.File != "" {
 		filesToCheck = []string{c.File}
@@ -0,0 +1,117 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/thunderbottom/kiln/internal/config"
+	"github.com/thunderbottom/kiln/internal/core"
+	kerrors "github.com/thunderbottom/kiln/internal/errors"
+)
+
+// ListCmd represents the list command for showing variable names and metadata without values.
+type ListCmd struct {
+	File   string `short:"f" help:"Environment file to list (default: all accessible files)"`
+	Format string `help:"Output format" enum:"text,json" default:"text"`
+	Layers bool   `help:"Include variables inherited through extends and show the file each comes from"`
+}
+
+func (c *ListCmd) validate() error {
+	if c.File != "" && !core.IsValidFileName(c.File) {
+		return kerrors.ValidationError("file name", "cannot contain '..' or '/' characters")
+	}
+
+	return nil
+}
+
+// Run executes the list command, printing variable names, lengths and hashes.
+func (c *ListCmd) Run(rt *Runtime) error {
+	rt.Logger.Debug().Str("command", "list").Str("file", c.File).Str("format", c.Format).Msg("validation started")
+
+	if err := c.validate(); err != nil {
+		rt.Logger.Warn().Err(err).Msg("validation failed")
+
+		return err
+	}
+
+	identity, err := rt.Identity()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := rt.Config()
+	if err != nil {
+		return err
+	}
+
+	var infos []core.VarInfo
+
+	if c.File != "" {
+		infos, err = c.listFile(identity, cfg, c.File)
+		if err != nil {
+			return err
+		}
+	} else {
+		for _, fileName := range cfg.FileNames() {
+			fileInfos, listErr := c.listFile(identity, cfg, fileName)
+			if listErr != nil {
+				rt.Logger.Warn().Str("file", fileName).Err(listErr).Msg("skipping file")
+
+				continue
+			}
+
+			infos = append(infos, fileInfos...)
+		}
+	}
+
+	switch c.Format {
+	case "text":
+		return c.printText(infos)
+	case "json":
+		return c.printJSON(infos)
+	}
+
+	return nil
+}
+
+// listFile lists one file, merged with the files it extends when --layers is set
+func (c *ListCmd) listFile(identity *core.Identity, cfg *config.Config, fileName string) ([]core.VarInfo, error) {
+	if c.Layers {
+		return core.ListLayeredEnvVars(identity, cfg, fileName)
+	}
+
+	return core.ListEnvVars(identity, cfg, fileName)
+}
+
+func (c *ListCmd) printText(infos []core.VarInfo) error {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	if c.Layers {
+		fmt.Fprintln(writer, "FILE\tKEY\tLAYER\tLENGTH\tSHA256")
+	} else {
+		fmt.Fprintln(writer, "FILE\tKEY\tLENGTH\tSHA256")
+	}
+
+	for _, info := range infos {
+		if c.Layers {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%d\t%s\n", info.File, info.Key, info.Layer, info.Length, info.Hash)
+		} else {
+			fmt.Fprintf(writer, "%s\t%s\t%d\t%s\n", info.File, info.Key, info.Length, info.Hash)
+		}
+	}
+
+	return writer.Flush()
+}
+
+func (c *ListCmd) printJSON(infos []core.VarInfo) error {
+	if infos == nil {
+		infos = []core.VarInfo{}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(infos)
+}
@@ -0,0 +1,166 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/thunderbottom/kiln/internal/core"
+	kerrors "github.com/thunderbottom/kiln/internal/errors"
+)
+
+// LogCmd represents the log command for showing per-variable change history from git.
+type LogCmd struct {
+	Name   string `arg:"" help:"Variable name or glob pattern to show history for (default: all variables)" optional:""`
+	File   string `short:"f" help:"Environment file to show history for" default:"default"`
+	Format string `help:"Output format" enum:"text,json" default:"text"`
+}
+
+// logEntry is the JSON representation of a commit in the history
+type logEntry struct {
+	Commit  string      `json:"commit"`
+	Author  string      `json:"author"`
+	Date    time.Time   `json:"date"`
+	Subject string      `json:"subject"`
+	Changes []diffEntry `json:"changes,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+func (c *LogCmd) validate() error {
+	if c.Name != "" && !core.IsValidVarPattern(c.Name) {
+		return kerrors.ValidationError("variable name", "must be a variable name or a glob pattern of letters, numbers, underscores and wildcards")
+	}
+
+	if !core.IsValidFileName(c.File) {
+		return kerrors.ValidationError("file name", "cannot contain '..' or '/' characters")
+	}
+
+	return nil
+}
+
+// Run executes the log command, listing commits that added, changed or removed variables.
+func (c *LogCmd) Run(rt *Runtime) error {
+	rt.Logger.Debug().Str("command", "log").Str("variable", c.Name).Str("file", c.File).Msg("validation started")
+
+	if err := c.validate(); err != nil {
+		rt.Logger.Warn().Err(err).Msg("validation failed")
+
+		return err
+	}
+
+	identity, err := rt.Identity()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := rt.Config()
+	if err != nil {
+		return err
+	}
+
+	var entries []logEntry
+
+	err = core.WalkEnvHistory(identity, cfg, c.File, func(entry core.HistoryEntry) error {
+		if result, ok := c.buildEntry(entry); ok {
+			entries = append(entries, result)
+		}
+
+		if entry.Err != nil {
+			rt.Logger.Debug().Str("commit", entry.Commit.Abbrev()).Err(entry.Err).Msg("cannot decrypt revision")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// History is walked oldest first; show newest first like git log
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+
+	if c.Format == "json" {
+		if entries == nil {
+			entries = []logEntry{}
+		}
+
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(entries)
+	}
+
+	c.printText(entries)
+
+	return nil
+}
+
+// buildEntry masks the changes of a history entry, filtered by the requested variable.
+// Returns false when the commit has nothing to report.
+func (c *LogCmd) buildEntry(entry core.HistoryEntry) (logEntry, bool) {
+	result := logEntry{
+		Commit:  entry.Commit.Hash,
+		Author:  entry.Commit.Author,
+		Date:    entry.Commit.Date,
+		Subject: entry.Commit.Subject,
+	}
+
+	if entry.Err != nil {
+		result.Error = entry.Err.Error()
+
+		return result, true
+	}
+
+	for _, change := range entry.Changes {
+		if c.Name != "" {
+			if matched, _ := path.Match(c.Name, change.Key); !matched {
+				continue
+			}
+		}
+
+		result.Changes = append(result.Changes, diffEntry{
+			Key:    change.Key,
+			Change: string(change.Type),
+			Old:    newDiffValue(change.OldValue, change.Type != core.ChangeAdded, false),
+			New:    newDiffValue(change.NewValue, change.Type != core.ChangeRemoved, false),
+		})
+	}
+
+	return result, len(result.Changes) > 0
+}
+
+func (c *LogCmd) printText(entries []logEntry) {
+	for _, entry := range entries {
+		commit := entry.Commit
+		if len(commit) > 7 {
+			commit = commit[:7]
+		}
+
+		fmt.Printf("%s %s %s: %s\n", commit, entry.Date.Format("2006-01-02 15:04:05 -0700"), entry.Author, entry.Subject)
+
+		if entry.Error != "" {
+			fmt.Println("  (cannot decrypt this revision)")
+
+			continue
+		}
+
+		for _, change := range entry.Changes {
+			switch core.ChangeType(change.Change) {
+			case core.ChangeAdded:
+				fmt.Printf("  + %s %s\n", change.Key, maskedDiffValue(change.New))
+			case core.ChangeRemoved:
+				fmt.Printf("  - %s %s\n", change.Key, maskedDiffValue(change.Old))
+			case core.ChangeModified:
+				fmt.Printf("  ~ %s %s -> %s\n", change.Key, maskedDiffValue(change.Old), maskedDiffValue(change.New))
+			}
+		}
+	}
+}
+
+// maskedDiffValue renders a masked value in the same form as diff text output
+func maskedDiffValue(value *diffValue) string {
+	return fmt.Sprintf("<sha256:%s len=%d>", value.Hash, value.Length)
+}
@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/thunderbottom/kiln/internal/core"
+	kerrors "github.com/thunderbottom/kiln/internal/errors"
+)
+
+// MergeDriverCmd represents the git merge driver for encrypted environment files.
+// Git invokes it as 'kiln merge-driver %O %A %B %P', see 'kiln setup-git'.
+type MergeDriverCmd struct {
+	Base   string `arg:"" help:"Common ancestor version (%O)"`
+	Ours   string `arg:"" help:"Current branch version, replaced with the merge result (%A)"`
+	Theirs string `arg:"" help:"Other branch version (%B)"`
+	Path   string `arg:"" help:"Path of the file in the repository (%P), used to find its configuration" optional:""`
+	File   string `short:"f" help:"Environment file to merge when no path is given" default:"default"`
+}
+
+func (c *MergeDriverCmd) validate() error {
+	for _, path := range []string{c.Base, c.Ours, c.Theirs} {
+		if !core.IsValidFilePath(path) {
+			return kerrors.ValidationError("file path", fmt.Sprintf("invalid path '%s'", path))
+		}
+	}
+
+	if c.Path == "" && !core.IsValidFileName(c.File) {
+		return kerrors.ValidationError("file name", "cannot contain '..' or '/' characters")
+	}
+
+	return nil
+}
+
+// Run executes the merge driver, merging variables by key and re-encrypting the result.
+func (c *MergeDriverCmd) Run(rt *Runtime) error {
+	rt.Logger.Debug().Str("command", "merge-driver").Str("path", c.Path).Str("file", c.File).Msg("validation started")
+
+	if err := c.validate(); err != nil {
+		rt.Logger.Warn().Err(err).Msg("validation failed")
+
+		return err
+	}
+
+	identity, err := rt.Identity()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := rt.Config()
+	if err != nil {
+		return err
+	}
+
+	fileName := c.File
+
+	if c.Path != "" {
+		name, found := cfg.FileNameForPath(c.Path)
+		if !found {
+			return kerrors.ConfigError(fmt.Sprintf("'%s' is not a configured environment file", c.Path), "check kiln.toml file definitions")
+		}
+
+		fileName = name
+	}
+
+	conflicts, err := core.MergeEnvFiles(identity, cfg, fileName, c.Base, c.Ours, c.Theirs)
+	if err != nil {
+		return err
+	}
+
+	if len(conflicts) > 0 {
+		return fmt.Errorf("merge conflict in '%s' for %s (values from the current branch were kept; resolve with 'kiln edit --file %s')",
+			fileName, strings.Join(conflicts, ", "), fileName)
+	}
+
+	rt.Logger.Info().Str("file", fileName).Msg("merged")
+
+	return nil
+}
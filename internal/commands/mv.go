@@ -0,0 +1,88 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/thunderbottom/kiln/internal/core"
+	kerrors "github.com/thunderbottom/kiln/internal/errors"
+)
+
+// MvCmd represents the mv command for moving or renaming variables within and across files.
+type MvCmd struct {
+	Source      string `arg:"" help:"Variable to move"`
+	Destination string `arg:"" help:"New variable name (defaults to the source name)" optional:""`
+	From        string `help:"Environment file to move from" default:"default"`
+	To          string `help:"Environment file to move to (defaults to --from)"`
+	Force       bool   `help:"Overwrite the destination variable if it exists"`
+}
+
+// Run executes the mv command, re-encrypting each affected file for its own recipients.
+func (c *MvCmd) Run(rt *Runtime) error {
+	rt.Logger.Debug().Str("command", "mv").Str("source", c.Source).Str("from", c.From).Str("to", c.To).Msg("validation started")
+
+	toFile, dstKey, err := validateTransfer(c.Source, c.Destination, c.From, c.To)
+	if err != nil {
+		rt.Logger.Warn().Err(err).Msg("validation failed")
+
+		return err
+	}
+
+	identity, err := rt.Identity()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := rt.Config()
+	if err != nil {
+		return err
+	}
+
+	if err := core.MoveEnvVar(identity, cfg, c.From, c.Source, toFile, dstKey, c.Force); err != nil {
+		return transferError(err)
+	}
+
+	rt.Logger.Info().Str("from", c.From+":"+c.Source).Str("to", toFile+":"+dstKey).Msg("moved successfully")
+
+	return nil
+}
+
+// validateTransfer checks mv/cp arguments and resolves the destination file and key defaults
+func validateTransfer(source, destination, from, to string) (toFile, dstKey string, err error) {
+	toFile = to
+	if toFile == "" {
+		toFile = from
+	}
+
+	dstKey = destination
+	if dstKey == "" {
+		dstKey = source
+	}
+
+	if !core.IsValidVarName(source) {
+		return "", "", kerrors.ValidationError("source variable", "must start with letter or underscore, followed by letters, numbers, or underscores")
+	}
+
+	if !core.IsValidVarName(dstKey) {
+		return "", "", kerrors.ValidationError("destination variable", "must start with letter or underscore, followed by letters, numbers, or underscores")
+	}
+
+	if !core.IsValidFileName(from) || !core.IsValidFileName(toFile) {
+		return "", "", kerrors.ValidationError("file name", "cannot contain '..' or '/' characters")
+	}
+
+	if from == toFile && source == dstKey {
+		return "", "", kerrors.ValidationError("arguments", "source and destination are the same (specify a new name or --to)")
+	}
+
+	return toFile, dstKey, nil
+}
+
+// transferError adds a hint to destination conflicts reported by core
+func transferError(err error) error {
+	if errors.Is(err, core.ErrVarExists) {
+		return fmt.Errorf("%w (use --force to overwrite)", err)
+	}
+
+	return err
+}
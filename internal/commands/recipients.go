@@ -0,0 +1,314 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/thunderbottom/kiln/internal/config"
+	"github.com/thunderbottom/kiln/internal/core"
+	kerrors "github.com/thunderbottom/kiln/internal/errors"
+)
+
+// RecipientsCmd represents the recipients command for managing team members.
+type RecipientsCmd struct {
+	Add    *RecipientsAddCmd    `cmd:"" help:"Add a recipient and re-encrypt the files they gain access to"`
+	Remove *RecipientsRemoveCmd `cmd:"" help:"Remove recipients and re-encrypt the files they could decrypt"`
+	List   *RecipientsListCmd   `cmd:"" help:"List recipients with key type, fingerprint and accessible files"`
+	Show   *RecipientsShowCmd   `cmd:"" help:"Show details of a recipient"`
+}
+
+// RecipientsAddCmd represents the add subcommand of recipients.
+type RecipientsAddCmd struct {
+	Name  string   `arg:"" help:"Recipient name"`
+	Key   string   `arg:"" help:"Public key (age or SSH) or path to a public key file"`
+	Group []string `short:"g" help:"Add the recipient to these groups"`
+	File  []string `short:"f" help:"Grant the recipient access to these files"`
+}
+
+// RecipientsRemoveCmd represents the remove subcommand of recipients.
+type RecipientsRemoveCmd struct {
+	Names []string `arg:"" help:"Recipient names"`
+}
+
+// RecipientsListCmd represents the list subcommand of recipients.
+type RecipientsListCmd struct {
+	Format string `help:"Output format" enum:"text,json" default:"text"`
+}
+
+// RecipientsShowCmd represents the show subcommand of recipients.
+type RecipientsShowCmd struct {
+	Name   string `arg:"" help:"Recipient name"`
+	Format string `help:"Output format" enum:"text,json" default:"text"`
+}
+
+// recipientInfo describes a recipient and the files they can decrypt
+type recipientInfo struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Fingerprint string   `json:"fingerprint"`
+	PublicKey   string   `json:"public_key"`
+	Groups      []string `json:"groups"`
+	Files       []string `json:"files"`
+}
+
+func (c *RecipientsAddCmd) validate() error {
+	if err := validateRecipientName(c.Name); err != nil {
+		return err
+	}
+
+	if core.IsPrivateKey(c.Key) {
+		return kerrors.ValidationError("public key", "private key provided instead of public key")
+	}
+
+	for _, file := range c.File {
+		if !core.IsValidFileName(file) {
+			return kerrors.ValidationError("file name", "cannot contain '..' or '/' characters")
+		}
+	}
+
+	return nil
+}
+
+// Run executes the recipients add command, registering the key and granting the requested access.
+func (c *RecipientsAddCmd) Run(rt *Runtime) error {
+	rt.Logger.Debug().Str("command", "recipients-add").Str("name", c.Name).Strs("groups", c.Group).Strs("files", c.File).Msg("validation started")
+
+	if err := c.validate(); err != nil {
+		rt.Logger.Warn().Err(err).Msg("validation failed")
+
+		return err
+	}
+
+	publicKey, err := resolvePublicKey(c.Key)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := rt.Config()
+	if err != nil {
+		return err
+	}
+
+	if err := c.checkConflicts(cfg, publicKey); err != nil {
+		return err
+	}
+
+	update, cleanup, err := updateAccess(rt, cfg, func() error {
+		cfg.AddRecipient(c.Name, publicKey)
+
+		for _, group := range c.Group {
+			if !slices.Contains(cfg.Groups[group], c.Name) {
+				cfg.Groups[group] = append(cfg.Groups[group], c.Name)
+			}
+		}
+
+		for _, file := range c.File {
+			fileConfig := cfg.Files[file]
+			if !slices.Contains(fileConfig.Access, c.Name) {
+				fileConfig.Access = append(fileConfig.Access, c.Name)
+				cfg.Files[file] = fileConfig
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	rt.Logger.Info().Str("name", c.Name).Strs("files", update.Files).Msg("recipient added")
+
+	return nil
+}
+
+// checkConflicts verifies the recipient, groups and files against the existing configuration
+func (c *RecipientsAddCmd) checkConflicts(cfg *config.Config, publicKey string) error {
+	if existingKey, exists := cfg.Recipients[c.Name]; exists && existingKey != publicKey {
+		return kerrors.ConfigError(
+			fmt.Sprintf("recipient '%s' already exists with different key", c.Name),
+			"use different name or remove existing recipient first")
+	}
+
+	for name, existingKey := range cfg.Recipients {
+		if name != c.Name && existingKey == publicKey {
+			return kerrors.ConfigError(fmt.Sprintf("public key already registered as '%s'", name), "use the existing recipient name")
+		}
+	}
+
+	for _, group := range c.Group {
+		if _, exists := cfg.Groups[group]; !exists {
+			return kerrors.ConfigError(fmt.Sprintf("group '%s' not found", group), "check group names in kiln.toml")
+		}
+	}
+
+	for _, file := range c.File {
+		if _, exists := cfg.Files[file]; !exists {
+			return kerrors.ConfigError(fmt.Sprintf("file '%s' not configured", file), "check kiln.toml file definitions")
+		}
+	}
+
+	return nil
+}
+
+func (c *RecipientsRemoveCmd) validate() error {
+	for _, name := range c.Names {
+		if strings.TrimSpace(name) == "" {
+			return kerrors.ValidationError("recipient name", "name cannot be empty")
+		}
+	}
+
+	return nil
+}
+
+// Run executes the recipients remove command, revoking access and re-encrypting affected files.
+func (c *RecipientsRemoveCmd) Run(rt *Runtime) error {
+	rt.Logger.Debug().Str("command", "recipients-remove").Strs("names", c.Names).Msg("validation started")
+
+	if err := c.validate(); err != nil {
+		rt.Logger.Warn().Err(err).Msg("validation failed")
+
+		return err
+	}
+
+	cfg, err := rt.Config()
+	if err != nil {
+		return err
+	}
+
+	return removeRecipients(rt, cfg, c.Names)
+}
+
+// Run executes the recipients list command.
+func (c *RecipientsListCmd) Run(rt *Runtime) error {
+	rt.Logger.Debug().Str("command", "recipients-list").Str("format", c.Format).Msg("validation started")
+
+	cfg, err := rt.Config()
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(cfg.Recipients))
+	for name := range cfg.Recipients {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	infos := make([]recipientInfo, 0, len(names))
+	for _, name := range names {
+		infos = append(infos, describeRecipient(cfg, name))
+	}
+
+	if c.Format == "json" {
+		return printJSON(infos)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(writer, "NAME\tTYPE\tFINGERPRINT\tFILES")
+
+	for _, info := range infos {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", info.Name, info.Type, info.Fingerprint, joinOrDash(info.Files))
+	}
+
+	return writer.Flush()
+}
+
+// Run executes the recipients show command.
+func (c *RecipientsShowCmd) Run(rt *Runtime) error {
+	rt.Logger.Debug().Str("command", "recipients-show").Str("name", c.Name).Msg("validation started")
+
+	cfg, err := rt.Config()
+	if err != nil {
+		return err
+	}
+
+	if _, exists := cfg.Recipients[c.Name]; !exists {
+		return kerrors.ConfigError(fmt.Sprintf("recipient '%s' not found", c.Name), "check recipient names in kiln.toml")
+	}
+
+	info := describeRecipient(cfg, c.Name)
+
+	if c.Format == "json" {
+		return printJSON(info)
+	}
+
+	fmt.Printf("Name:        %s\n", info.Name)
+	fmt.Printf("Type:        %s\n", info.Type)
+	fmt.Printf("Fingerprint: %s\n", info.Fingerprint)
+	fmt.Printf("Public key:  %s\n", info.PublicKey)
+	fmt.Printf("Groups:      %s\n", joinOrDash(info.Groups))
+	fmt.Printf("Files:       %s\n", joinOrDash(info.Files))
+
+	return nil
+}
+
+// describeRecipient collects key details and access for a configured recipient
+func describeRecipient(cfg *config.Config, name string) recipientInfo {
+	publicKey := cfg.Recipients[name]
+
+	info := recipientInfo{
+		Name:      name,
+		PublicKey: publicKey,
+		Groups:    append([]string{}, cfg.GroupsContaining(name)...),
+		Files:     append([]string{}, cfg.FilesAccessibleBy(name)...),
+	}
+
+	keyType, fingerprint, err := core.PublicKeyInfo(publicKey)
+	if err != nil {
+		keyType, fingerprint = "invalid", "-"
+	}
+
+	info.Type = keyType
+	info.Fingerprint = fingerprint
+
+	return info
+}
+
+// resolvePublicKey accepts a public key or a path to a file containing one, and verifies
+// that it can be used as an encryption recipient
+func resolvePublicKey(keyOrPath string) (string, error) {
+	publicKey, err := core.LoadPublicKey(strings.TrimSpace(keyOrPath))
+	if err != nil {
+		return "", kerrors.ValidationError("public key", fmt.Sprintf("'%s' is not a public key or a readable key file", keyOrPath))
+	}
+
+	if _, err := core.ParseRecipients([]string{publicKey}); err != nil {
+		return "", kerrors.ValidationError("public key", err.Error())
+	}
+
+	return publicKey, nil
+}
+
+// validateRecipientName rejects names that cannot be used in access lists
+func validateRecipientName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return kerrors.ValidationError("recipient name", "name cannot be empty")
+	}
+
+	if name == "*" || strings.HasPrefix(name, config.GroupPrefix) || strings.ContainsAny(name, " \t,=") {
+		return kerrors.ValidationError("recipient name", "cannot be '*', start with '@', or contain whitespace, ',' or '='")
+	}
+
+	return nil
+}
+
+func printJSON(value any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(value)
+}
+
+func joinOrDash(values []string) string {
+	if len(values) == 0 {
+		return "-"
+	}
+
+	return strings.Join(values, ", ")
+}
@@ -0,0 +1,236 @@
+package commands
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/thunderbottom/kiln/internal/config"
+	"github.com/thunderbottom/kiln/internal/core"
+)
+
+func TestRecipientsAddCmd_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cmd     RecipientsAddCmd
+		wantErr bool
+	}{
+		{"valid", RecipientsAddCmd{Name: "alice", Key: "age1example"}, false},
+		{"empty name", RecipientsAddCmd{Name: "", Key: "age1example"}, true},
+		{"wildcard name", RecipientsAddCmd{Name: "*", Key: "age1example"}, true},
+		{"name with comma", RecipientsAddCmd{Name: "a,b", Key: "age1example"}, true},
+		{"private key", RecipientsAddCmd{Name: "alice", Key: "AGE-SECRET-KEY-1ABC"}, true},
+		{"invalid file", RecipientsAddCmd{Name: "alice", Key: "age1example", File: []string{"../prod"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cmd.validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRecipientsAddCmd_Run(t *testing.T) {
+	tmpDir := createTempDir(t)
+	configPath, keyPath := setupTestEnvironment(t, tmpDir)
+
+	// A second file that only the existing recipient can read
+	stagingPath := filepath.Join(tmpDir, "staging.env")
+
+	appendTestConfig(t, configPath, "\n[files.staging]\nfilename = \""+stagingPath+"\"\naccess = [\"test-user\"]\n")
+
+	identity, err := core.NewIdentityFromKey(keyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("config.Load failed: %v", err)
+	}
+
+	for _, fileName := range []string{"default", "staging"} {
+		if err := core.SetEnvVar(identity, cfg, fileName, "KEY", []byte("value")); err != nil {
+			t.Fatalf("SetEnvVar failed: %v", err)
+		}
+	}
+
+	stagingBefore, err := os.ReadFile(stagingPath)
+	if err != nil {
+		t.Fatalf("Failed to read staging file: %v", err)
+	}
+
+	bobKey, bobPublicKey, err := core.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+
+	bobKeyPath := filepath.Join(tmpDir, "bob.key")
+	if err := core.SaveKeys(bobKey, bobPublicKey, bobKeyPath); err != nil {
+		t.Fatalf("SaveKeys failed: %v", err)
+	}
+
+	runtime, err := NewRuntime(configPath, keyPath, false)
+	if err != nil {
+		t.Fatalf("NewRuntime failed: %v", err)
+	}
+	defer runtime.Cleanup()
+
+	cmd := &RecipientsAddCmd{Name: "bob", Key: bobPublicKey}
+	if err := cmd.Run(runtime); err != nil {
+		t.Fatalf("RecipientsAddCmd.Run() failed: %v", err)
+	}
+
+	// The wildcard file is re-encrypted for bob
+	bobIdentity, err := core.NewIdentityFromKey(bobKeyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	updated, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("config.Load failed: %v", err)
+	}
+
+	if updated.Recipients["bob"] != bobPublicKey {
+		t.Errorf("Expected bob to be saved in configuration")
+	}
+
+	value, cleanup, err := core.GetEnvVar(bobIdentity, updated, "default", "KEY")
+	if err != nil {
+		t.Fatalf("bob should be able to decrypt default: %v", err)
+	}
+	defer cleanup()
+
+	if string(value) != "value" {
+		t.Errorf("Expected 'value', got %q", value)
+	}
+
+	// Files whose recipients did not change are left untouched
+	stagingAfter, err := os.ReadFile(stagingPath)
+	if err != nil {
+		t.Fatalf("Failed to read staging file: %v", err)
+	}
+
+	if !bytes.Equal(stagingBefore, stagingAfter) {
+		t.Error("staging should not have been re-encrypted")
+	}
+}
+
+func TestRecipientsRemoveCmd_RunSigner(t *testing.T) {
+	tmpDir := createTempDir(t)
+	configPath, keyPath := setupTestEnvironment(t, tmpDir)
+
+	_, bobPublicKey, err := core.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("config.Load failed: %v", err)
+	}
+
+	cfg.AddRecipient("bob", bobPublicKey)
+	cfg.Signers = []string{"test-user", "bob"}
+
+	if err := cfg.Save(configPath); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	runtime, err := NewRuntime(configPath, keyPath, false)
+	if err != nil {
+		t.Fatalf("NewRuntime failed: %v", err)
+	}
+	defer runtime.Cleanup()
+
+	cmd := &RecipientsRemoveCmd{Names: []string{"bob"}}
+	if err := cmd.Run(runtime); err != nil {
+		t.Fatalf("RecipientsRemoveCmd.Run() failed: %v", err)
+	}
+
+	// The configuration must still load once the signer is gone
+	updated, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("config.Load failed after removing a signer: %v", err)
+	}
+
+	if len(updated.Signers) != 1 || updated.Signers[0] != "test-user" {
+		t.Errorf("Expected signers [test-user], got %v", updated.Signers)
+	}
+}
+
+func TestRecipientsRemoveCmd_RunLastWriter(t *testing.T) {
+	tmpDir := createTempDir(t)
+	configPath, keyPath := setupTestEnvironment(t, tmpDir)
+
+	bobKey, bobPublicKey, err := core.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+
+	bobKeyPath := filepath.Join(tmpDir, "bob.key")
+	if err := core.SaveKeys(bobKey, bobPublicKey, bobKeyPath); err != nil {
+		t.Fatalf("SaveKeys failed: %v", err)
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("config.Load failed: %v", err)
+	}
+
+	cfg.AddRecipient("bob", bobPublicKey)
+	cfg.Groups = map[string][]string{"team": {"test-user", "bob"}}
+	cfg.Signers = []string{"team"}
+	cfg.SignaturePolicy = config.SignaturePolicyRefuse
+
+	if err := cfg.Save(configPath); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// bob is the last to write the file, so it carries his signature
+	bobIdentity, err := core.NewIdentityFromKey(bobKeyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	if err := core.SetEnvVar(bobIdentity, cfg, "default", "KEY", []byte("value")); err != nil {
+		t.Fatalf("SetEnvVar failed: %v", err)
+	}
+
+	runtime, err := NewRuntime(configPath, keyPath, false)
+	if err != nil {
+		t.Fatalf("NewRuntime failed: %v", err)
+	}
+	defer runtime.Cleanup()
+
+	cmd := &RecipientsRemoveCmd{Names: []string{"bob"}}
+	if err := cmd.Run(runtime); err != nil {
+		t.Fatalf("Removing the last writer failed: %v", err)
+	}
+
+	updated, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("config.Load failed: %v", err)
+	}
+
+	identity, err := core.NewIdentityFromKey(keyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	// The file is re-signed by the remaining signer and reads under the refuse policy
+	value, cleanup, err := core.GetEnvVar(identity, updated, "default", "KEY")
+	if err != nil {
+		t.Fatalf("Expected the re-signed file to read, got %v", err)
+	}
+	defer cleanup()
+
+	if string(value) != "value" {
+		t.Errorf("Expected 'value', got %q", value)
+	}
+}
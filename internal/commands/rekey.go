@@ -12,18 +12,37 @@ import (
 
 // RekeyCmd represents the rekey command for rotating encryption keys.
 type RekeyCmd struct {
-	File         string   `short:"f" help:"Environment file to rekey" required:"true"`
-	AddRecipient []string `help:"Add new named recipients in format 'name=key'" placeholder:"name=age-pub-key"`
-	Force        bool     `help:"Force rekey without confirmation"`
+	File            string   `short:"f" help:"Environment file to rekey"`
+	AddRecipient    []string `help:"Add new named recipients in format 'name=key'" placeholder:"name=age-pub-key"`
+	RemoveRecipient []string `help:"Remove named recipients and re-encrypt every file they could decrypt" placeholder:"name"`
+	All             bool     `help:"Re-encrypt every file whose recipients differ from its access list, or whose format or armor setting changed"`
+	DryRun          bool     `help:"With --all, report files that would be rekeyed without modifying them"`
+	Force           bool     `help:"Force rekey without confirmation (with --all, re-encrypt every file)"`
 }
 
 func (c *RekeyCmd) validate() error {
+	if c.All {
+		return c.validateAll()
+	}
+
+	if c.DryRun {
+		return kerrors.ValidationError("arguments", "--dry-run is only supported with --all")
+	}
+
+	if len(c.RemoveRecipient) > 0 {
+		return c.validateRemove()
+	}
+
+	if c.File == "" {
+		return kerrors.ValidationError("file name", "required when adding recipients (use --file)")
+	}
+
 	if !core.IsValidFileName(c.File) {
 		return kerrors.ValidationError("file name", "cannot contain '..' or '/' characters")
 	}
 
 	if len(c.AddRecipient) == 0 {
-		return kerrors.ValidationError("recipients", "no recipients specified (use --add-recipient name=key)")
+		return kerrors.ValidationError("recipients", "no recipients specified (use --add-recipient name=key or --remove-recipient name)")
 	}
 
 	for _, recipient := range c.AddRecipient {
@@ -35,6 +54,32 @@ func (c *RekeyCmd) validate() error {
 	return nil
 }
 
+func (c *RekeyCmd) validateAll() error {
+	if c.File != "" || len(c.AddRecipient) > 0 || len(c.RemoveRecipient) > 0 {
+		return kerrors.ValidationError("arguments", "--all cannot be combined with --file, --add-recipient or --remove-recipient")
+	}
+
+	return nil
+}
+
+func (c *RekeyCmd) validateRemove() error {
+	if len(c.AddRecipient) > 0 {
+		return kerrors.ValidationError("arguments", "cannot add and remove recipients in the same run")
+	}
+
+	if c.File != "" {
+		return kerrors.ValidationError("arguments", "--file cannot be used with --remove-recipient, every file the recipient can decrypt is rekeyed")
+	}
+
+	for _, name := range c.RemoveRecipient {
+		if strings.TrimSpace(name) == "" {
+			return kerrors.ValidationError("recipient", "name cannot be empty")
+		}
+	}
+
+	return nil
+}
+
 func (c *RekeyCmd) validateRecipient(recipient string) error {
 	parts := strings.SplitN(recipient, "=", 2)
 	if len(parts) != 2 {
@@ -61,7 +106,8 @@ func (c *RekeyCmd) validateRecipient(recipient string) error {
 
 // Run executes the rekey command, re-encrypting files with updated recipients.
 func (c *RekeyCmd) Run(rt *Runtime) error {
-	rt.Logger.Debug().Str("command", "rekey").Str("file", c.File).Int("new_recipients", len(c.AddRecipient)).Msg("validation started")
+	rt.Logger.Debug().Str("command", "rekey").Str("file", c.File).Int("new_recipients", len(c.AddRecipient)).Strs("remove_recipients", c.RemoveRecipient).
+		Bool("all", c.All).Bool("dry_run", c.DryRun).Msg("validation started")
 
 	if err := c.validate(); err != nil {
 		rt.Logger.Warn().Err(err).Msg("validation failed")
@@ -74,6 +120,14 @@ func (c *RekeyCmd) Run(rt *Runtime) error {
 		return err
 	}
 
+	if c.All {
+		return c.rekeyAll(rt, cfg)
+	}
+
+	if len(c.RemoveRecipient) > 0 {
+		return removeRecipients(rt, cfg, c.RemoveRecipient)
+	}
+
 	// Check for duplicate recipients
 	if err := c.checkDuplicateRecipients(cfg); err != nil {
 		return err
@@ -159,8 +213,13 @@ func (c *RekeyCmd) hasFileAccess(cfg *config.Config, fileConfig config.FileConfi
 	}
 
 	for _, accessor := range fileConfig.Access {
-		if groupMembers, isGroup := cfg.Groups[accessor]; isGroup {
-			return slices.Contains(groupMembers, name)
+		if _, isGroup := cfg.Groups[accessor]; !isGroup {
+			continue
+		}
+
+		members, err := cfg.GroupRecipients(accessor)
+		if err == nil && slices.Contains(members, name) {
+			return true
 		}
 	}
 
@@ -185,7 +244,7 @@ func (c *RekeyCmd) rekeyFile(rt *Runtime, cfg *config.Config) error {
 		return err
 	}
 
-	envVars, cleanup, loadErr := core.GetAllEnvVars(identity, cfg, c.File)
+	envVars, cleanup, loadErr := core.GetFileEnvVars(identity, cfg, c.File)
 	if loadErr != nil {
 		return loadErr
 	}
@@ -203,3 +262,130 @@ func (c *RekeyCmd) rekeyFile(rt *Runtime, cfg *config.Config) error {
 
 	return nil
 }
+
+// removeRecipients revokes recipients from the configuration and re-encrypts every file they
+// could decrypt, then lists the variables in those files as rotation candidates.
+func removeRecipients(rt *Runtime, cfg *config.Config, names []string) error {
+	for _, name := range names {
+		if _, exists := cfg.Recipients[name]; !exists {
+			return kerrors.ConfigError(fmt.Sprintf("recipient '%s' not found", name), "check recipient names in kiln.toml")
+		}
+	}
+
+	update, cleanup, err := updateAccess(rt, cfg, func() error {
+		for _, name := range names {
+			cfg.RemoveRecipient(name)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	rt.Logger.Info().Strs("removed", names).Strs("files", update.Files).Msg("recipients removed")
+
+	printRotationCandidates(names, update)
+
+	return nil
+}
+
+// printRotationCandidates lists the variables removed recipients could read. Re-encryption does
+// not revoke copies they already hold, or their access to old revisions in version control.
+func printRotationCandidates(names []string, update *accessUpdate) {
+	var lines []string
+
+	for _, fileName := range update.Files {
+		if keys := core.SortedKeys(update.Variables[fileName]); len(keys) > 0 {
+			lines = append(lines, fmt.Sprintf("  %s: %s", fileName, strings.Join(keys, ", ")))
+		}
+	}
+
+	if len(lines) == 0 {
+		return
+	}
+
+	fmt.Printf("Variables readable by %s that should be rotated:\n", strings.Join(names, ", "))
+
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+}
+
+// rekeyAll re-encrypts every file whose ciphertext recipients differ from the recipients its
+// access list resolves to, or that is not stored in the format its configuration asks for.
+// Files that cannot be rekeyed are reported and do not stop the run.
+func (c *RekeyCmd) rekeyAll(rt *Runtime, cfg *config.Config) error {
+	failed := 0
+
+	for _, fileName := range cfg.FileNames() {
+		status, err := c.rekeyIfStale(rt, cfg, fileName)
+		if err != nil {
+			rt.Logger.Debug().Str("file", fileName).Err(err).Msg("rekey failed")
+			fmt.Printf("%s: not rekeyed: %v\n", fileName, err)
+
+			failed++
+
+			continue
+		}
+
+		fmt.Printf("%s: %s\n", fileName, status)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to rekey %d files", failed)
+	}
+
+	return nil
+}
+
+// rekeyIfStale re-encrypts a single file when its recipients or storage format are out of date,
+// returning its status
+func (c *RekeyCmd) rekeyIfStale(rt *Runtime, cfg *config.Config, fileName string) (string, error) {
+	filePath, err := cfg.GetEnvFile(fileName)
+	if err != nil {
+		return "", err
+	}
+
+	if !core.FileExists(filePath) {
+		return "not created yet", nil
+	}
+
+	current, err := core.FileRecipientsCurrent(cfg, fileName)
+	if err != nil {
+		return "", err
+	}
+
+	formatCurrent, err := core.FileFormatCurrent(cfg, fileName)
+	if err != nil {
+		return "", err
+	}
+
+	if current && formatCurrent && !c.Force {
+		return "up to date", nil
+	}
+
+	if c.DryRun {
+		return "would rekey", nil
+	}
+
+	identity, err := rt.Identity()
+	if err != nil {
+		return "", err
+	}
+
+	envVars, cleanup, err := core.GetFileEnvVars(identity, cfg, fileName)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	if err := core.SaveAllEnvVars(identity, cfg, fileName, envVars); err != nil {
+		return "", err
+	}
+
+	rt.Logger.Info().Str("file", fileName).Msg("rekeyed")
+
+	return "rekeyed", nil
+}
@@ -0,0 +1,84 @@
+package commands
+
+import (
+	"os"
+	"testing"
+
+	"github.com/thunderbottom/kiln/internal/config"
+	"github.com/thunderbottom/kiln/internal/core"
+)
+
+func TestRekeyCmd_hasFileAccess(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.Recipients["alice"] = "age1alice"
+	cfg.Recipients["bob"] = "age1bob"
+	cfg.Groups["frontend"] = []string{"alice"}
+	cfg.Groups["platform"] = []string{"bob"}
+	cfg.Groups["backend"] = []string{"@platform"}
+
+	cmd := &RekeyCmd{}
+
+	tests := []struct {
+		name   string
+		access []string
+		want   bool
+	}{
+		{"direct", []string{"bob"}, true},
+		{"wildcard", []string{"*"}, true},
+		{"second group", []string{"frontend", "platform"}, true},
+		{"nested group", []string{"frontend", "backend"}, true},
+		{"no access", []string{"frontend"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileConfig := config.FileConfig{Filename: "test.env", Access: tt.access}
+			if got := cmd.hasFileAccess(cfg, fileConfig, "bob"); got != tt.want {
+				t.Errorf("hasFileAccess() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRekeyCmd_rekeyIfStale(t *testing.T) {
+	tmpDir := createTempDir(t)
+	configPath, keyPath := setupTestEnvironment(t, tmpDir)
+
+	runtime, err := NewRuntime(configPath, keyPath, false)
+	if err != nil {
+		t.Fatalf("NewRuntime failed: %v", err)
+	}
+	defer runtime.Cleanup()
+
+	cfg, err := runtime.Config()
+	if err != nil {
+		t.Fatalf("Config failed: %v", err)
+	}
+
+	// A file without a manifest has an X25519 stanza that cannot be traced to test-user
+	recipients, err := core.ParseRecipients([]string{cfg.Recipients["test-user"]})
+	if err != nil {
+		t.Fatalf("ParseRecipients failed: %v", err)
+	}
+
+	encrypted, err := core.NewAgeManager(recipients, nil).Encrypt([]byte("KEY=value\n"))
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+
+	if err := os.WriteFile(cfg.Files["default"].Filename, encrypted, 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	if status, err := (&RekeyCmd{All: true, DryRun: true}).rekeyIfStale(runtime, cfg, "default"); err != nil || status != "would rekey" {
+		t.Errorf("Expected unverifiable file to be rekeyed, got %q, %v", status, err)
+	}
+
+	if _, err := (&RekeyCmd{All: true}).rekeyIfStale(runtime, cfg, "default"); err != nil {
+		t.Fatalf("rekeyIfStale failed: %v", err)
+	}
+
+	if status, err := (&RekeyCmd{All: true}).rekeyIfStale(runtime, cfg, "default"); err != nil || status != "up to date" {
+		t.Errorf("Expected rekeyed file to be up to date, got %q, %v", status, err)
+	}
+}
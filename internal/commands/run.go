@@ -18,12 +18,13 @@ import (
 
 // RunCmd represents the run command for executing programs with encrypted environment variables.
 type RunCmd struct {
-	File    string        `short:"f" help:"Environment file to use" default:"default"`
-	DryRun  bool          `help:"Show environment variables without running command"`
-	Timeout time.Duration `help:"Timeout for command execution" placeholder:"[10s]"`
-	WorkDir string        `help:"Working directory for command execution" placeholder:"[path]"`
-	Shell   bool          `help:"Run command through shell"`
-	Command []string      `arg:"" help:"Command and arguments to run"`
+	File      string        `short:"f" help:"Environment file to use" default:"default"`
+	DryRun    bool          `help:"Show environment variables without running command"`
+	Timeout   time.Duration `help:"Timeout for command execution" placeholder:"[10s]"`
+	WorkDir   string        `help:"Working directory for command execution" placeholder:"[path]"`
+	Shell     bool          `help:"Run command through shell"`
+	NoResolve bool          `help:"Pass references to other files in values through unresolved"`
+	Command   []string      `arg:"" help:"Command and arguments to run"`
 }
 
 // ExitError represents a command exit with a specific code.
@@ -82,7 +83,12 @@ func (c *RunCmd) Run(rt *Runtime) error {
 		return err
 	}
 
-	variables, cleanup, err := core.GetAllEnvVars(identity, cfg, c.File)
+	load := core.GetAllEnvVars
+	if c.NoResolve {
+		load = core.GetUnresolvedEnvVars
+	}
+
+	variables, cleanup, err := load(identity, cfg, c.File)
 	if err != nil {
 		return err
 	}
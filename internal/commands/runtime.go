@@ -7,6 +7,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"runtime"
 
 	"github.com/rs/zerolog"
@@ -27,7 +28,8 @@ type Runtime struct {
 	identityLoaded bool
 }
 
-// NewRuntime creates a new context with configured logger
+// NewRuntime creates a new context with configured logger. An empty configPath selects the
+// nearest kiln.toml found by searching upward from the working directory.
 func NewRuntime(configPath, keyPath string, verbose bool) (*Runtime, error) {
 	logger := setupLogger(verbose)
 
@@ -45,14 +47,16 @@ func (rt *Runtime) Config() (*config.Config, error) {
 		return rt.config, nil
 	}
 
+	configPath := rt.ConfigPath()
+
 	// Check if config file exists before attempting to load
-	if !core.FileExists(rt.configPath) {
-		return nil, fmt.Errorf("configuration file '%s' not found (use 'kiln init config' to create)", rt.configPath)
+	if !core.FileExists(configPath) {
+		return nil, fmt.Errorf("configuration file '%s' not found (use 'kiln init config' to create)", configPath)
 	}
 
-	cfg, err := config.Load(rt.configPath)
+	cfg, err := config.Load(configPath)
 	if err != nil {
-		return nil, fmt.Errorf("load configuration from '%s': %w", rt.configPath, err)
+		return nil, fmt.Errorf("load configuration from '%s': %w", configPath, err)
 	}
 
 	// Validate configuration after loading
@@ -61,7 +65,7 @@ func (rt *Runtime) Config() (*config.Config, error) {
 	}
 
 	rt.config = cfg
-	rt.Logger.Debug().Str("config", rt.configPath).Int("recipients", len(cfg.Recipients)).Msg("configuration loaded")
+	rt.Logger.Debug().Str("config", configPath).Int("recipients", len(cfg.Recipients)).Msg("configuration loaded")
 
 	return cfg, nil
 }
@@ -111,8 +115,29 @@ func (rt *Runtime) Cleanup() {
 	runtime.GC()
 }
 
-// ConfigPath returns the configuration file path
+// ConfigPath returns the configuration file path. Without an explicit path, the nearest kiln.toml
+// in the working directory or its parents is used, up to the root of the enclosing git repository;
+// if there is none, kiln.toml in the working directory.
 func (rt *Runtime) ConfigPath() string {
+	if rt.configPath != "" {
+		return rt.configPath
+	}
+
+	workDir, err := os.Getwd()
+	if err != nil {
+		rt.configPath = config.DefaultConfigFile
+
+		return rt.configPath
+	}
+
+	if found, ok := config.Find(workDir); ok {
+		rt.configPath = found
+	} else {
+		rt.configPath = filepath.Join(workDir, config.DefaultConfigFile)
+	}
+
+	rt.Logger.Debug().Str("config", rt.configPath).Msg("configuration file selected")
+
 	return rt.configPath
 }
 
@@ -93,7 +93,7 @@ func (c *SetCmd) setFromFile(rt *Runtime, identity *core.Identity, cfg *config.C
 
 	rt.Logger.Debug().Int("variable_count", len(variables)).Msg("parsed variables from JSON")
 
-	existingVars, cleanup, err := core.GetAllEnvVars(identity, cfg, c.File)
+	existingVars, cleanup, err := core.GetFileEnvVars(identity, cfg, c.File)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,105 @@
+package commands
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/thunderbottom/kiln/internal/core"
+)
+
+// gitDriverName is the name of the merge and diff drivers registered in git configuration
+const gitDriverName = "kiln"
+
+// SetupGitCmd represents the setup-git command for registering kiln's git integration.
+type SetupGitCmd struct{}
+
+// Run executes the setup-git command, writing .gitattributes entries for every configured
+// file and registering the merge and diff drivers in the repository's git configuration.
+func (c *SetupGitCmd) Run(rt *Runtime) error {
+	rt.Logger.Debug().Str("command", "setup-git").Msg("validation started")
+
+	cfg, err := rt.Config()
+	if err != nil {
+		return err
+	}
+
+	root, err := core.GitTopLevel(filepath.Dir(rt.ConfigPath()))
+	if err != nil {
+		return fmt.Errorf("find git repository: %w", err)
+	}
+
+	var lines []string
+
+	for _, name := range cfg.FileNames() {
+		pattern, err := core.GitAttributesPattern(root, cfg.Files[name].Filename)
+		if err != nil {
+			rt.Logger.Warn().Str("file", name).Err(err).Msg("skipping file")
+
+			continue
+		}
+
+		lines = append(lines,
+			fmt.Sprintf("%s merge=%s", pattern, gitDriverName),
+			fmt.Sprintf("%s diff=%s", pattern, gitDriverName),
+		)
+	}
+
+	added, err := core.EnsureGitAttributes(root, lines)
+	if err != nil {
+		return fmt.Errorf("update .gitattributes: %w", err)
+	}
+
+	driver, err := c.command(root, rt.ConfigPath(), "merge-driver %O %A %B %P")
+	if err != nil {
+		return err
+	}
+
+	textconv, err := c.command(root, rt.ConfigPath(), "textconv")
+	if err != nil {
+		return err
+	}
+
+	settings := [][2]string{
+		{"merge." + gitDriverName + ".name", "kiln encrypted environment merge"},
+		{"merge." + gitDriverName + ".driver", driver},
+		{"diff." + gitDriverName + ".textconv", textconv},
+	}
+
+	for _, setting := range settings {
+		if err := core.SetGitConfig(root, setting[0], setting[1]); err != nil {
+			return fmt.Errorf("set git config '%s': %w", setting[0], err)
+		}
+
+		fmt.Printf("git config %s %q\n", setting[0], setting[1])
+	}
+
+	for _, line := range added {
+		fmt.Printf(".gitattributes: %s\n", line)
+	}
+
+	rt.Logger.Info().Str("repository", root).Int("attributes", len(added)).Msg("git integration configured")
+
+	return nil
+}
+
+// command builds a kiln invocation for git, run from the repository root. The configuration
+// path is passed relative to the root so the setting keeps working if the repository moves.
+func (c *SetupGitCmd) command(root, configPath, args string) (string, error) {
+	absConfig, err := filepath.Abs(configPath)
+	if err != nil {
+		return "", fmt.Errorf("resolve config path: %w", err)
+	}
+
+	relConfig, err := filepath.Rel(root, absConfig)
+	if err != nil || strings.HasPrefix(relConfig, "..") {
+		return "", fmt.Errorf("configuration '%s' is outside the git repository at '%s'", configPath, root)
+	}
+
+	relConfig = filepath.ToSlash(relConfig)
+	if relConfig == "kiln.toml" {
+		return "kiln " + args, nil
+	}
+
+	return fmt.Sprintf("kiln --config '%s' %s", strings.ReplaceAll(relConfig, "'", `'\''`), args), nil
+}
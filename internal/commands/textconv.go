@@ -0,0 +1,113 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/thunderbottom/kiln/internal/config"
+	"github.com/thunderbottom/kiln/internal/core"
+	kerrors "github.com/thunderbottom/kiln/internal/errors"
+)
+
+// TextconvCmd represents the git textconv driver that renders encrypted files for git diff.
+// Git invokes it as 'kiln textconv <path>', see 'kiln setup-git'.
+type TextconvCmd struct {
+	Path   string `arg:"" help:"Encrypted file passed by git"`
+	Reveal bool   `help:"Show plaintext values instead of hashes"`
+}
+
+func (c *TextconvCmd) validate() error {
+	if !core.IsValidFilePath(c.Path) {
+		return kerrors.ValidationError("file path", fmt.Sprintf("invalid path '%s'", c.Path))
+	}
+
+	return nil
+}
+
+// Run executes the textconv command, printing a sorted rendering of the file's variables.
+func (c *TextconvCmd) Run(rt *Runtime) error {
+	rt.Logger.Debug().Str("command", "textconv").Str("path", c.Path).Bool("reveal", c.Reveal).Msg("validation started")
+
+	if err := c.validate(); err != nil {
+		rt.Logger.Warn().Err(err).Msg("validation failed")
+
+		return err
+	}
+
+	identity, err := rt.Identity()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := rt.Config()
+	if err != nil {
+		return err
+	}
+
+	label, found := textconvFileName(cfg, c.Path)
+	if !found {
+		label = filepath.Base(c.Path)
+		rt.Logger.Debug().Str("path", c.Path).Msg("file not found in configuration")
+	}
+
+	variables, cleanup, err := core.DecryptEnvFile(identity, label, c.Path)
+	if err != nil {
+		// Failing here would abort the whole 'git log -p', so render a placeholder
+		// for revisions this key cannot read
+		rt.Logger.Debug().Str("file", label).Err(err).Msg("cannot decrypt")
+		fmt.Printf("# kiln: cannot decrypt '%s'\n", label)
+
+		return nil
+	}
+	defer cleanup()
+
+	if c.Reveal {
+		content := core.FormatEnv(variables)
+		defer core.WipeData(content)
+
+		if len(content) > 0 {
+			if _, err := os.Stdout.Write(content); err != nil {
+				return fmt.Errorf("write output: %w", err)
+			}
+
+			fmt.Println()
+		}
+
+		return nil
+	}
+
+	for _, key := range core.SortedKeys(variables) {
+		fmt.Printf("%s=%s\n", key, renderValue(variables[key], false))
+	}
+
+	return nil
+}
+
+// textconvFileName finds the configured file for a path passed by git. Git passes the
+// working tree file directly, but older revisions are written to a temporary file named
+// 'XXXXXX_<basename>', so those are matched by base name when it is unambiguous.
+func textconvFileName(cfg *config.Config, path string) (string, bool) {
+	if name, found := cfg.FileNameForPath(path); found {
+		return name, true
+	}
+
+	base := filepath.Base(path)
+	if len(base) < 8 || base[6] != '_' {
+		return "", false
+	}
+
+	var matches []string
+
+	for _, name := range cfg.FileNames() {
+		if filepath.Base(cfg.Files[name].Filename) == base[7:] {
+			matches = append(matches, name)
+		}
+	}
+
+	if len(matches) != 1 {
+		return "", false
+	}
+
+	return matches[0], true
+}
@@ -0,0 +1,59 @@
+package commands
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/thunderbottom/kiln/internal/config"
+)
+
+func TestTextconvFileName(t *testing.T) {
+	root := t.TempDir()
+
+	cfg := &config.Config{
+		Files: map[string]config.FileConfig{
+			"default":    {Filename: filepath.Join(root, ".kiln.env"), Access: []string{"*"}},
+			"production": {Filename: filepath.Join(root, "envs", "prod", "app.env"), Access: []string{"*"}},
+			"staging":    {Filename: filepath.Join(root, "envs", "staging", "app.env"), Access: []string{"*"}},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		wantName  string
+		wantFound bool
+	}{
+		{
+			name:      "working tree file",
+			path:      filepath.Join(root, "envs", "prod", "app.env"),
+			wantName:  "production",
+			wantFound: true,
+		},
+		{
+			name:      "git temporary file",
+			path:      filepath.Join(t.TempDir(), "a1B2c3_.kiln.env"),
+			wantName:  "default",
+			wantFound: true,
+		},
+		{
+			name:      "ambiguous base name",
+			path:      filepath.Join(t.TempDir(), "a1B2c3_app.env"),
+			wantFound: false,
+		},
+		{
+			name:      "unconfigured file",
+			path:      filepath.Join(root, "other.env"),
+			wantFound: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, found := textconvFileName(cfg, tt.path)
+			if found != tt.wantFound || name != tt.wantName {
+				t.Errorf("textconvFileName(%q) = %q, %v; want %q, %v", tt.path, name, found, tt.wantName, tt.wantFound)
+			}
+		})
+	}
+}
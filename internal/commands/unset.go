@@ -0,0 +1,101 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/thunderbottom/kiln/internal/config"
+	"github.com/thunderbottom/kiln/internal/core"
+	kerrors "github.com/thunderbottom/kiln/internal/errors"
+)
+
+// UnsetCmd represents the unset command for removing environment variables.
+type UnsetCmd struct {
+	Names  []string `arg:"" help:"Environment variable names or glob patterns (e.g. 'LEGACY_*')"`
+	File   string   `short:"f" help:"Environment file to modify" default:"default"`
+	DryRun bool     `help:"Show variables that would be removed without modifying the file"`
+}
+
+func (c *UnsetCmd) validate() error {
+	if len(c.Names) == 0 {
+		return kerrors.ValidationError("variable name", "at least one name or pattern is required")
+	}
+
+	for _, name := range c.Names {
+		if !core.IsValidVarPattern(name) {
+			return kerrors.ValidationError("variable name",
+				fmt.Sprintf("'%s' must be a variable name or a glob pattern of letters, numbers, underscores and wildcards", name))
+		}
+	}
+
+	if !core.IsValidFileName(c.File) {
+		return kerrors.ValidationError("file name", "cannot contain '..' or '/' characters")
+	}
+
+	return nil
+}
+
+// Run executes the unset command, removing matching variables and re-encrypting the file once.
+func (c *UnsetCmd) Run(rt *Runtime) error {
+	rt.Logger.Debug().Str("command", "unset").Strs("names", c.Names).Str("file", c.File).Bool("dry_run", c.DryRun).Msg("validation started")
+
+	if err := c.validate(); err != nil {
+		rt.Logger.Warn().Err(err).Msg("validation failed")
+
+		return err
+	}
+
+	identity, err := rt.Identity()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := rt.Config()
+	if err != nil {
+		return err
+	}
+
+	if c.DryRun {
+		return c.showDryRun(rt, identity, cfg)
+	}
+
+	removed, err := core.UnsetEnvVars(identity, cfg, c.File, c.Names)
+	if err != nil {
+		return err
+	}
+
+	if len(removed) == 0 {
+		rt.Logger.Warn().Str("file", c.File).Strs("patterns", c.Names).Msg("no matching variables found")
+
+		return nil
+	}
+
+	for _, key := range removed {
+		fmt.Println(key)
+	}
+
+	rt.Logger.Info().Str("file", c.File).Int("removed", len(removed)).Msg("unset successfully")
+
+	return nil
+}
+
+// showDryRun lists the variables that would be removed without re-encrypting the file
+func (c *UnsetCmd) showDryRun(rt *Runtime, identity *core.Identity, cfg *config.Config) error {
+	variables, cleanup, err := core.GetFileEnvVars(identity, cfg, c.File)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	matched, err := core.MatchVarNames(variables, c.Names)
+	if err != nil {
+		return kerrors.ValidationError("pattern", err.Error())
+	}
+
+	for _, key := range matched {
+		fmt.Println(key)
+	}
+
+	rt.Logger.Info().Str("file", c.File).Int("count", len(matched)).Msg("Would remove")
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package commands
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/thunderbottom/kiln/internal/config"
+	"github.com/thunderbottom/kiln/internal/core"
+	kerrors "github.com/thunderbottom/kiln/internal/errors"
+)
+
+// VerifyCmd represents the verify command for checking that files are encrypted for their access lists.
+type VerifyCmd struct {
+	File      string `short:"f" help:"Verify a specific file (default: all files)"`
+	NoDecrypt bool   `help:"Only compare recipient manifests and header stanzas, without a private key"`
+}
+
+func (c *VerifyCmd) validate() error {
+	if c.File != "" && !core.IsValidFileName(c.File) {
+		return kerrors.ValidationError("file name", "cannot contain '..' or '/' characters")
+	}
+
+	return nil
+}
+
+// Run executes the verify command, reporting files whose recipients have drifted from the
+// recipients their access lists resolve to. Unless --no-decrypt is set, files the current
+// identity can read are also decrypted, which authenticates their manifest and signature.
+func (c *VerifyCmd) Run(rt *Runtime) error {
+	rt.Logger.Debug().Str("command", "verify").Str("file", c.File).Bool("no_decrypt", c.NoDecrypt).Msg("validation started")
+
+	if err := c.validate(); err != nil {
+		rt.Logger.Warn().Err(err).Msg("validation failed")
+
+		return err
+	}
+
+	cfg, err := rt.Config()
+	if err != nil {
+		return err
+	}
+
+	var identity *core.Identity
+
+	if !c.NoDecrypt {
+		if identity, err = rt.Identity(); err != nil {
+			return err
+		}
+	}
+
+	fileNames := cfg.FileNames()
+	if c.File != "" {
+		if _, exists := cfg.Files[c.File]; !exists {
+			return kerrors.ConfigError(fmt.Sprintf("file '%s' not configured", c.File), "check kiln.toml file definitions")
+		}
+
+		fileNames = []string{c.File}
+	}
+
+	names := fingerprintNames(cfg)
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	failed := 0
+
+	fmt.Fprintln(writer, "FILE\tSTATUS")
+
+	for _, fileName := range fileNames {
+		problems, status := c.verifyFile(rt, cfg, identity, names, fileName)
+		if len(problems) > 0 {
+			failed++
+			status = strings.Join(problems, "; ")
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\n", fileName, status)
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return kerrors.SecurityError(fmt.Sprintf("%d files do not match their access lists", failed), "run 'kiln rekey --all' to re-encrypt them for their current recipients")
+	}
+
+	return nil
+}
+
+// verifyFile checks a single file, returning the problems found, or its status if there are none
+func (c *VerifyCmd) verifyFile(rt *Runtime, cfg *config.Config, identity *core.Identity, names map[string][]string, fileName string) ([]string, string) {
+	filePath, err := cfg.GetEnvFile(fileName)
+	if err != nil {
+		return []string{err.Error()}, ""
+	}
+
+	if !core.FileExists(filePath) {
+		return nil, "not created yet"
+	}
+
+	check, err := core.CheckFileManifest(cfg, fileName)
+	if err != nil {
+		return []string{err.Error()}, ""
+	}
+
+	var problems []string
+
+	if check.Recorded == nil {
+		problems = append(problems, "no recipient manifest")
+	}
+
+	if missing := check.Missing(); check.Recorded != nil && len(missing) > 0 {
+		problems = append(problems, "not encrypted for "+describeFingerprints(names, missing))
+	}
+
+	if unexpected := check.Unexpected(); len(unexpected) > 0 {
+		problems = append(problems, "encrypted for "+describeFingerprints(names, unexpected)+" without access")
+	}
+
+	// A stanza mismatch is only worth reporting when the manifest does not already explain it
+	manifestDrifted := check.Recorded != nil && !slices.Equal(check.Recorded, check.Expected)
+
+	if check.Recorded != nil && check.Stanzas != len(check.Recorded) {
+		problems = append(problems, fmt.Sprintf("header has %d recipient stanzas for %d manifest entries", check.Stanzas, len(check.Recorded)))
+	} else if !check.StanzasMatch && !manifestDrifted {
+		problems = append(problems, "header stanzas do not match the access list")
+	}
+
+	if len(problems) > 0 || identity == nil {
+		return problems, "ok"
+	}
+
+	_, fingerprint, err := core.PublicKeyInfo(identity.PublicKey())
+	if err != nil || !slices.Contains(check.Expected, fingerprint) {
+		rt.Logger.Debug().Str("file", fileName).Msg("not a recipient, skipping decryption")
+
+		return nil, "ok (not decrypted, not a recipient)"
+	}
+
+	if err := core.CheckEnvFile(identity, cfg, fileName); err != nil {
+		return []string{"cannot decrypt: " + err.Error()}, ""
+	}
+
+	return nil, "ok"
+}
+
+// fingerprintNames maps the fingerprint of every configured recipient's key to its names
+func fingerprintNames(cfg *config.Config) map[string][]string {
+	names := make(map[string][]string)
+
+	for _, name := range slices.Sorted(maps.Keys(cfg.Recipients)) {
+		if _, fingerprint, err := core.PublicKeyInfo(cfg.Recipients[name]); err == nil {
+			names[fingerprint] = append(names[fingerprint], name)
+		}
+	}
+
+	return names
+}
+
+// describeFingerprints lists recipients by name where configured, and by fingerprint otherwise
+func describeFingerprints(names map[string][]string, fingerprints []string) string {
+	described := make([]string, 0, len(fingerprints))
+
+	for _, fingerprint := range fingerprints {
+		if recipientNames, exists := names[fingerprint]; exists {
+			described = append(described, strings.Join(recipientNames, "/"))
+		} else {
+			described = append(described, fingerprint)
+		}
+	}
+
+	return strings.Join(described, ", ")
+}
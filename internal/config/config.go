@@ -4,8 +4,11 @@ package config
 
 import (
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 
 	"github.com/BurntSushi/toml"
@@ -16,19 +19,77 @@ const (
 	DefaultConfigFile = "kiln.toml"
 	// DefaultEnvFile is the default name for encrypted environment files.
 	DefaultEnvFile = ".kiln.env"
+	// GroupPrefix marks a group member that refers to another group, as in "@platform".
+	GroupPrefix = "@"
+	// FormatFile stores an environment file as a single age-encrypted blob.
+	FormatFile = "file"
+	// FormatValues stores key names in plaintext and encrypts each value separately.
+	FormatValues = "values"
+	// SignaturePolicyWarn reads files without a valid signature from an allowed signer after a warning.
+	SignaturePolicyWarn = "warn"
+	// SignaturePolicyRefuse refuses to read files without a valid signature from an allowed signer.
+	SignaturePolicyRefuse = "refuse"
 )
 
 // Config represents the kiln configuration
 type Config struct {
-	Recipients map[string]string     `toml:"recipients"`
-	Groups     map[string][]string   `toml:"groups"`
-	Files      map[string]FileConfig `toml:"files"`
+	Include         []string              `toml:"include,omitempty"`
+	Armor           bool                  `toml:"armor,omitempty"`
+	Signers         []string              `toml:"signers,omitempty"`
+	SignaturePolicy string                `toml:"signature_policy,omitempty"`
+	Recipients      map[string]string     `toml:"recipients"`
+	Groups          map[string][]string   `toml:"groups"`
+	Files           map[string]FileConfig `toml:"files"`
+
+	// source is the file the configuration was read from, used by Save to edit it in place
+	source *source
+	// included holds the recipients and groups merged from included files
+	included *included
+}
+
+// source holds the contents of a configuration file and the configuration they decoded to
+type source struct {
+	path   string
+	data   []byte
+	loaded *Config
 }
 
 // FileConfig represents the configuration for an environment file
 type FileConfig struct {
 	Filename string   `toml:"filename"`
 	Access   []string `toml:"access"`
+	// Extends lists files whose variables this file inherits; later entries and the file itself win
+	Extends []string `toml:"extends,omitempty"`
+	// Interpolate expands ${NAME} references between variables of this file when it is read.
+	// Without it values are literal; versions that parsed files with godotenv expanded ${NAME}
+	// and $NAME, also from the process environment, in every file.
+	Interpolate bool `toml:"interpolate,omitempty"`
+	// References resolves ${file:KEY} references to variables of other files when this file is read
+	References bool `toml:"references,omitempty"`
+	// Armor stores the file as ASCII-armored age output; unset files follow the global armor setting
+	Armor *bool `toml:"armor,omitempty"`
+	// Format selects how the file is encrypted, FormatFile when empty
+	Format string `toml:"format,omitempty"`
+}
+
+// equal reports whether two file declarations are identical
+func (f FileConfig) equal(other FileConfig) bool {
+	return f.Filename == other.Filename &&
+		slices.Equal(f.Access, other.Access) &&
+		slices.Equal(f.Extends, other.Extends) &&
+		f.Interpolate == other.Interpolate &&
+		f.References == other.References &&
+		equalOptional(f.Armor, other.Armor) &&
+		f.Format == other.Format
+}
+
+// equalOptional reports whether two optional settings are both unset or set to the same value
+func equalOptional[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
 }
 
 // NewConfig creates a new configuration with defaults
@@ -62,36 +123,129 @@ func Load(path string) (*Config, error) {
 		return nil, err
 	}
 
+	// Resolve relative file paths relative to the configuration directory
+	config.resolvePaths(filepath.Dir(configPath))
+	config.source = &source{path: configPath, data: data, loaded: config.Clone()}
+
+	if err := config.loadIncludes(configPath); err != nil {
+		return nil, err
+	}
+
 	if len(config.Recipients) == 0 {
 		return nil, fmt.Errorf("no recipients in configuration")
 	}
 
-	// Resolve relative file paths relative to the configuration directory
+	return &config, nil
+}
+
+// Save writes the configuration to a file. When the configuration was loaded from the same
+// file, only the recipients, groups and files that changed are rewritten; comments, ordering
+// and formatting elsewhere are kept. File paths inside the configuration directory are written
+// relative to it.
+func (c *Config) Save(path string) error {
+	configPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(configPath), 0o750); err != nil {
+		return err
+	}
+
+	local, err := c.localView()
+	if err != nil {
+		return err
+	}
+
+	data, err := local.encode(c.source, configPath)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(configPath, data, 0o600); err != nil {
+		return err
+	}
+
+	c.source = &source{path: configPath, data: data, loaded: local}
+
+	return nil
+}
+
+// encode renders the configuration for the file at configPath, editing the file it was loaded
+// from in place where possible and marshalling the whole configuration otherwise. Rewriting a
+// file that exists drops its comments and formatting, so it is reported on stderr.
+func (c *Config) encode(from *source, configPath string) ([]byte, error) {
 	configDir := filepath.Dir(configPath)
 
-	for name, fileConfig := range config.Files {
+	if from != nil && from.path == configPath {
+		data, err := updateDocument(from.data, from.loaded, c, configDir)
+		if err == nil {
+			return data, nil
+		}
+
+		fmt.Fprintf(os.Stderr, "warning: cannot edit '%s' in place (%v), rewriting it without comments\n", configPath, err)
+	}
+
+	out := c.Clone()
+	for name, fileConfig := range out.Files {
+		fileConfig.Filename = relativePath(configDir, fileConfig.Filename)
+		out.Files[name] = fileConfig
+	}
+
+	return toml.Marshal(out)
+}
+
+// resolvePaths makes relative file paths absolute against configDir
+func (c *Config) resolvePaths(configDir string) {
+	for name, fileConfig := range c.Files {
 		if !filepath.IsAbs(fileConfig.Filename) {
 			fileConfig.Filename = filepath.Join(configDir, fileConfig.Filename)
-			config.Files[name] = fileConfig
+			c.Files[name] = fileConfig
 		}
 	}
-
-	return &config, nil
 }
 
-// Save writes the configuration to a file
-func (c *Config) Save(path string) error {
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0o750); err != nil {
-		return err
+// Clone returns a deep copy of the settings, recipients, groups and files. The copy is not tied
+// to the file the configuration was loaded from.
+func (c *Config) Clone() *Config {
+	clone := &Config{
+		Include:         slices.Clone(c.Include),
+		Armor:           c.Armor,
+		Signers:         slices.Clone(c.Signers),
+		SignaturePolicy: c.SignaturePolicy,
+		Recipients:      maps.Clone(c.Recipients),
+		Groups:          make(map[string][]string, len(c.Groups)),
+		Files:           make(map[string]FileConfig, len(c.Files)),
 	}
 
-	data, err := toml.Marshal(c)
-	if err != nil {
-		return err
+	for name, members := range c.Groups {
+		clone.Groups[name] = slices.Clone(members)
+	}
+
+	for name, fileConfig := range c.Files {
+		fileConfig.Access = slices.Clone(fileConfig.Access)
+		fileConfig.Extends = slices.Clone(fileConfig.Extends)
+
+		if fileConfig.Armor != nil {
+			armored := *fileConfig.Armor
+			fileConfig.Armor = &armored
+		}
+
+		clone.Files[name] = fileConfig
 	}
 
-	return os.WriteFile(path, data, 0o600)
+	return clone
+}
+
+// sameContent reports whether two configurations define the same settings, recipients, groups and files
+func (c *Config) sameContent(other *Config) bool {
+	return slices.Equal(c.Include, other.Include) &&
+		c.Armor == other.Armor &&
+		slices.Equal(c.Signers, other.Signers) &&
+		c.SignaturePolicy == other.SignaturePolicy &&
+		maps.Equal(c.Recipients, other.Recipients) &&
+		maps.EqualFunc(c.Groups, other.Groups, slices.Equal) &&
+		maps.EqualFunc(c.Files, other.Files, FileConfig.equal)
 }
 
 // Validate checks if the configuration is valid
@@ -108,6 +262,65 @@ func (c *Config) Validate() error {
 		if len(fileConfig.Access) == 0 {
 			return fmt.Errorf("no access control defined for file '%s'", name)
 		}
+
+		if fileConfig.Format != "" && fileConfig.Format != FormatFile && fileConfig.Format != FormatValues {
+			return fmt.Errorf("file '%s' has unknown format '%s' (use '%s' or '%s')", name, fileConfig.Format, FormatFile, FormatValues)
+		}
+	}
+
+	if err := c.ValidateGroups(); err != nil {
+		return err
+	}
+
+	if err := c.ValidateSigners(); err != nil {
+		return err
+	}
+
+	return c.ValidateExtends()
+}
+
+// ValidateGroups checks that nested group references do not form a cycle
+func (c *Config) ValidateGroups() error {
+	names := make([]string, 0, len(c.Groups))
+	for name := range c.Groups {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, err := c.GroupRecipients(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ValidateExtends checks that every file extends only configured files, without cycles
+func (c *Config) ValidateExtends() error {
+	for _, name := range c.FileNames() {
+		if _, err := c.FileLayers(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ValidateSigners checks that signers name only recipients and groups, and that the signature
+// policy is known
+func (c *Config) ValidateSigners() error {
+	if c.SignaturePolicy != "" && c.SignaturePolicy != SignaturePolicyWarn && c.SignaturePolicy != SignaturePolicyRefuse {
+		return fmt.Errorf("unknown signature_policy '%s' (use '%s' or '%s')", c.SignaturePolicy, SignaturePolicyWarn, SignaturePolicyRefuse)
+	}
+
+	if len(c.Signers) == 0 {
+		return nil
+	}
+
+	if err := c.ValidateAccess(c.Signers); err != nil {
+		return fmt.Errorf("invalid signers: %w", err)
 	}
 
 	return nil
@@ -122,18 +335,131 @@ func (c *Config) AddRecipient(name, publicKey string) {
 	c.Recipients[name] = publicKey
 }
 
-// RemoveRecipient removes a recipient
+// RemoveRecipient removes a recipient along with its group memberships, file access entries and
+// signer entry
 func (c *Config) RemoveRecipient(name string) bool {
 	if c.Recipients == nil {
 		return false
 	}
 
 	_, exists := c.Recipients[name]
-	if exists {
-		delete(c.Recipients, name)
+	if !exists {
+		return false
+	}
+
+	delete(c.Recipients, name)
+
+	for group, members := range c.Groups {
+		c.Groups[group] = slices.DeleteFunc(members, func(member string) bool { return member == name })
+	}
+
+	for fileName, fileConfig := range c.Files {
+		fileConfig.Access = slices.DeleteFunc(fileConfig.Access, func(accessor string) bool { return accessor == name })
+		c.Files[fileName] = fileConfig
+	}
+
+	c.Signers = slices.DeleteFunc(c.Signers, func(signer string) bool { return signer == name })
+
+	return true
+}
+
+// RemoveGroup removes a group along with its references from other groups, file access lists
+// and signers
+func (c *Config) RemoveGroup(name string) bool {
+	if _, exists := c.Groups[name]; !exists {
+		return false
+	}
+
+	delete(c.Groups, name)
+
+	for group, members := range c.Groups {
+		c.Groups[group] = slices.DeleteFunc(members, func(member string) bool { return member == GroupPrefix+name })
+	}
+
+	for fileName, fileConfig := range c.Files {
+		fileConfig.Access = slices.DeleteFunc(fileConfig.Access, func(accessor string) bool { return accessor == name })
+		c.Files[fileName] = fileConfig
+	}
+
+	c.Signers = slices.DeleteFunc(c.Signers, func(signer string) bool { return signer == name })
+
+	return true
+}
+
+// FilesReferencing returns the sorted names of files whose access list names the recipient or group directly
+func (c *Config) FilesReferencing(name string) []string {
+	var files []string
+
+	for _, fileName := range c.FileNames() {
+		if slices.Contains(c.Files[fileName].Access, name) {
+			files = append(files, fileName)
+		}
+	}
+
+	return files
+}
+
+// GroupsContaining returns the sorted names of groups that list the named recipient as a member
+func (c *Config) GroupsContaining(name string) []string {
+	var groups []string
+
+	for group, members := range c.Groups {
+		if slices.Contains(members, name) {
+			groups = append(groups, group)
+		}
+	}
+
+	slices.Sort(groups)
+
+	return groups
+}
+
+// FilesAccessibleBy returns the sorted names of files the named recipient can decrypt
+func (c *Config) FilesAccessibleBy(name string) []string {
+	publicKey, exists := c.Recipients[name]
+	if !exists {
+		return nil
+	}
+
+	var files []string
+
+	for _, fileName := range c.FileNames() {
+		recipients, err := c.ResolveFileAccess(fileName)
+		if err != nil {
+			continue
+		}
+
+		if slices.Contains(recipients, publicKey) {
+			files = append(files, fileName)
+		}
+	}
+
+	return files
+}
+
+// ValidateAccess checks that every access entry is "*", a recipient or a group
+func (c *Config) ValidateAccess(access []string) error {
+	if len(access) == 0 {
+		return fmt.Errorf("access list is empty")
+	}
+
+	for _, accessor := range access {
+		if accessor == "*" {
+			continue
+		}
+
+		if _, isRecipient := c.Recipients[accessor]; isRecipient {
+			continue
+		}
+
+		if _, isGroup := c.Groups[accessor]; isGroup {
+			continue
+		}
+
+		return fmt.Errorf("'%s' is not a recipient or group", accessor)
 	}
 
-	return exists
+	return nil
 }
 
 // ResolveFileAccess resolves the list of public keys that have access to a specific file
@@ -143,9 +469,29 @@ func (c *Config) ResolveFileAccess(fileName string) ([]string, error) {
 		return nil, fmt.Errorf("file '%s' not found in configuration", fileName)
 	}
 
+	recipients, err := c.resolveAccessors(fileConfig.Access)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("no valid recipients found for file '%s'", fileName)
+	}
+
+	return recipients, nil
+}
+
+// ResolveSigners resolves the public keys whose signatures are accepted on environment files.
+// Files are signed on write and checked on read only when Signers is set.
+func (c *Config) ResolveSigners() ([]string, error) {
+	return c.resolveAccessors(c.Signers)
+}
+
+// resolveAccessors resolves recipients, groups and "*" to the public keys they stand for
+func (c *Config) resolveAccessors(accessors []string) ([]string, error) {
 	recipientSet := make(map[string]bool)
 
-	for _, accessor := range fileConfig.Access {
+	for _, accessor := range accessors {
 		// If access is a wildcard, add all and break early
 		if accessor == "*" {
 			for _, pubKey := range c.Recipients {
@@ -156,11 +502,14 @@ func (c *Config) ResolveFileAccess(fileName string) ([]string, error) {
 		}
 
 		// Check if accessor is a group
-		if groupMembers, isGroup := c.Groups[accessor]; isGroup {
-			for _, member := range groupMembers {
-				if pubKey, exists := c.Recipients[member]; exists {
-					recipientSet[pubKey] = true
-				}
+		if _, isGroup := c.Groups[accessor]; isGroup {
+			members, err := c.GroupRecipients(accessor)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, member := range members {
+				recipientSet[c.Recipients[member]] = true
 			}
 
 			continue
@@ -177,13 +526,141 @@ func (c *Config) ResolveFileAccess(fileName string) ([]string, error) {
 		recipients = append(recipients, pubKey)
 	}
 
-	if len(recipients) == 0 {
-		return nil, fmt.Errorf("no valid recipients found for file '%s'", fileName)
+	return recipients, nil
+}
+
+// GroupRecipients returns the sorted names of the recipients in a group, expanding members that
+// refer to other groups with GroupPrefix. Unknown recipients and groups are skipped.
+// Returns an error describing the cycle path if nested groups refer back to themselves.
+func (c *Config) GroupRecipients(name string) ([]string, error) {
+	recipientSet := make(map[string]bool)
+
+	if err := c.expandGroup(name, nil, recipientSet); err != nil {
+		return nil, err
+	}
+
+	recipients := make([]string, 0, len(recipientSet))
+	for recipient := range recipientSet {
+		recipients = append(recipients, recipient)
 	}
 
+	sort.Strings(recipients)
+
 	return recipients, nil
 }
 
+// expandGroup adds the recipients of a group to recipientSet. path holds the groups
+// being expanded, outermost first, and is used to detect and report cycles.
+func (c *Config) expandGroup(name string, path []string, recipientSet map[string]bool) error {
+	if start := slices.Index(path, name); start >= 0 {
+		cycle := append(slices.Clone(path[start:]), name)
+
+		return fmt.Errorf("group cycle: %s", strings.Join(cycle, " -> "))
+	}
+
+	members, exists := c.Groups[name]
+	if !exists {
+		return nil
+	}
+
+	path = append(path, name)
+
+	for _, member := range members {
+		if nested, isGroup := strings.CutPrefix(member, GroupPrefix); isGroup {
+			if err := c.expandGroup(nested, path, recipientSet); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if _, exists := c.Recipients[member]; exists {
+			recipientSet[member] = true
+		}
+	}
+
+	return nil
+}
+
+// FileLayers returns the files whose variables make up a file, in the order they are merged:
+// the files it extends, each preceded by its own parents, then the file itself. A file
+// reached through several parents is merged once, at its first position.
+// Returns an error describing the cycle path if files extend each other.
+func (c *Config) FileLayers(fileName string) ([]string, error) {
+	var layers []string
+
+	if err := c.collectLayers(fileName, nil, &layers); err != nil {
+		return nil, err
+	}
+
+	return layers, nil
+}
+
+// collectLayers appends the layers of a file to layers. path holds the files being
+// expanded, outermost first, and is used to detect and report cycles.
+func (c *Config) collectLayers(name string, path []string, layers *[]string) error {
+	if start := slices.Index(path, name); start >= 0 {
+		cycle := append(slices.Clone(path[start:]), name)
+
+		return fmt.Errorf("extends cycle: %s", strings.Join(cycle, " -> "))
+	}
+
+	fileConfig, exists := c.Files[name]
+	if !exists {
+		if len(path) == 0 {
+			return fmt.Errorf("file '%s' not found in configuration", name)
+		}
+
+		return fmt.Errorf("file '%s' extends unknown file '%s'", path[len(path)-1], name)
+	}
+
+	path = append(path, name)
+
+	for _, parent := range fileConfig.Extends {
+		if err := c.collectLayers(parent, path, layers); err != nil {
+			return err
+		}
+	}
+
+	if !slices.Contains(*layers, name) {
+		*layers = append(*layers, name)
+	}
+
+	return nil
+}
+
+// FilesExtending returns the sorted names of files that directly extend a file
+func (c *Config) FilesExtending(name string) []string {
+	var extending []string
+
+	for _, fileName := range c.FileNames() {
+		if slices.Contains(c.Files[fileName].Extends, name) {
+			extending = append(extending, fileName)
+		}
+	}
+
+	return extending
+}
+
+// FileArmor reports whether the named file is stored ASCII-armored: its own armor setting if
+// it has one, the global setting otherwise
+func (c *Config) FileArmor(name string) bool {
+	if fileConfig, exists := c.Files[name]; exists && fileConfig.Armor != nil {
+		return *fileConfig.Armor
+	}
+
+	return c.Armor
+}
+
+// FileFormat returns how the named file is encrypted, FormatFile or FormatValues
+func (c *Config) FileFormat(name string) string {
+	if c.Files[name].Format == FormatValues {
+		return FormatValues
+	}
+
+	return FormatFile
+}
+
 // GetEnvFile returns the path for the specified environment file
 func (c *Config) GetEnvFile(name string) (string, error) {
 	if name == "" {
@@ -202,6 +679,69 @@ func (c *Config) GetEnvFile(name string) (string, error) {
 	return "", fmt.Errorf("file '%s' not found in configuration, available files: %v", name, available)
 }
 
+// FileNames returns the configured environment file names in sorted order
+func (c *Config) FileNames() []string {
+	names := make([]string, 0, len(c.Files))
+	for name := range c.Files {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// FileNameForPath returns the name of the configured file stored at path.
+// Paths are compared after resolving them to absolute form.
+func (c *Config) FileNameForPath(path string) (string, bool) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+
+	for _, name := range c.FileNames() {
+		filePath, err := filepath.Abs(c.Files[name].Filename)
+		if err != nil {
+			continue
+		}
+
+		if filePath == absPath {
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+// Find searches dir and its parents for DefaultConfigFile, the way git finds .git. The search
+// stops at the filesystem root or after the first directory containing .git, so a configuration
+// outside the enclosing repository is never picked up. Returns the path of the configuration
+// file and whether one was found.
+func Find(dir string) (string, bool) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+
+	for {
+		candidate := filepath.Join(dir, DefaultConfigFile)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, true
+		}
+
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return "", false
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+
+		dir = parent
+	}
+}
+
 // Exists checks if a config file exists
 func Exists(path string) bool {
 	if path == "" {
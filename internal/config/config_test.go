@@ -128,6 +128,200 @@ func TestConfigAddRemoveRecipient(t *testing.T) {
 	}
 }
 
+func TestRemoveRecipientPurgesReferences(t *testing.T) {
+	cfg := NewConfig()
+	cfg.AddRecipient("alice", "age1111111111")
+	cfg.AddRecipient("bob", "age2222222222")
+	cfg.Groups["ops"] = []string{"alice", "bob"}
+	cfg.Files["production"] = FileConfig{Filename: prodEnv, Access: []string{"bob", "ops"}}
+	cfg.Signers = []string{"alice", "bob"}
+
+	if !cfg.RemoveRecipient("bob") {
+		t.Fatal("RemoveRecipient should return true")
+	}
+
+	if !reflect.DeepEqual(cfg.Groups["ops"], []string{"alice"}) {
+		t.Errorf("Expected bob removed from group, got %v", cfg.Groups["ops"])
+	}
+
+	if !reflect.DeepEqual(cfg.Files["production"].Access, []string{"ops"}) {
+		t.Errorf("Expected bob removed from access list, got %v", cfg.Files["production"].Access)
+	}
+
+	if !reflect.DeepEqual(cfg.Files["default"].Access, []string{"*"}) {
+		t.Errorf("Expected wildcard access untouched, got %v", cfg.Files["default"].Access)
+	}
+
+	if !reflect.DeepEqual(cfg.Signers, []string{"alice"}) {
+		t.Errorf("Expected bob removed from signers, got %v", cfg.Signers)
+	}
+
+	if err := cfg.ValidateSigners(); err != nil {
+		t.Errorf("Expected signers to stay valid, got %v", err)
+	}
+}
+
+func TestFilesAccessibleBy(t *testing.T) {
+	cfg := NewConfig()
+	cfg.AddRecipient("alice", "age1111111111")
+	cfg.AddRecipient("bob", "age2222222222")
+	cfg.Groups["ops"] = []string{"bob"}
+	cfg.Files["production"] = FileConfig{Filename: prodEnv, Access: []string{"ops"}}
+	cfg.Files["staging"] = FileConfig{Filename: "staging.env", Access: []string{"alice"}}
+
+	if files := cfg.FilesAccessibleBy("bob"); !reflect.DeepEqual(files, []string{"default", "production"}) {
+		t.Errorf("Expected [default production], got %v", files)
+	}
+
+	if files := cfg.FilesAccessibleBy("nonexistent"); len(files) != 0 {
+		t.Errorf("Expected no files for unknown recipient, got %v", files)
+	}
+}
+
+func TestRemoveGroup(t *testing.T) {
+	cfg := NewConfig()
+	cfg.AddRecipient("alice", "age1111111111")
+	cfg.Groups["ops"] = []string{"alice"}
+	cfg.Files["production"] = FileConfig{Filename: prodEnv, Access: []string{"ops", "alice"}}
+	cfg.Signers = []string{"ops", "alice"}
+
+	if files := cfg.FilesReferencing("ops"); !reflect.DeepEqual(files, []string{"production"}) {
+		t.Errorf("Expected [production] to reference ops, got %v", files)
+	}
+
+	if !cfg.RemoveGroup("ops") {
+		t.Fatal("RemoveGroup should return true")
+	}
+
+	if _, exists := cfg.Groups["ops"]; exists {
+		t.Error("Group should be deleted")
+	}
+
+	if !reflect.DeepEqual(cfg.Files["production"].Access, []string{"alice"}) {
+		t.Errorf("Expected group removed from access list, got %v", cfg.Files["production"].Access)
+	}
+
+	if !reflect.DeepEqual(cfg.Signers, []string{"alice"}) {
+		t.Errorf("Expected group removed from signers, got %v", cfg.Signers)
+	}
+
+	if cfg.RemoveGroup("ops") {
+		t.Error("RemoveGroup should return false for non-existent group")
+	}
+}
+
+func TestGroupsContaining(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Groups["ops"] = []string{"alice", "bob"}
+	cfg.Groups["dev"] = []string{"bob"}
+	cfg.Groups["qa"] = []string{"carol"}
+
+	if groups := cfg.GroupsContaining("bob"); !reflect.DeepEqual(groups, []string{"dev", "ops"}) {
+		t.Errorf("Expected [dev ops], got %v", groups)
+	}
+}
+
+func TestGroupRecipients(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Recipients["alice"] = "age1alice"
+	cfg.Recipients["bob"] = "age1bob"
+	cfg.Recipients["carol"] = "age1carol"
+	cfg.Groups["platform"] = []string{"bob", "@sre"}
+	cfg.Groups["sre"] = []string{"carol"}
+	cfg.Groups["backend"] = []string{"@platform", "alice", "@sre", "unknown", "@missing"}
+
+	members, err := cfg.GroupRecipients("backend")
+	if err != nil {
+		t.Fatalf("GroupRecipients failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(members, []string{"alice", "bob", "carol"}) {
+		t.Errorf("Expected [alice bob carol], got %v", members)
+	}
+
+	cfg.Files["backend"] = FileConfig{Filename: "backend.env", Access: []string{"backend"}}
+
+	recipients, err := cfg.ResolveFileAccess("backend")
+	if err != nil {
+		t.Fatalf("ResolveFileAccess failed: %v", err)
+	}
+
+	if len(recipients) != 3 {
+		t.Errorf("Expected 3 recipients, got %v", recipients)
+	}
+
+	cfg.Groups["sre"] = []string{"carol", "@backend"}
+
+	if _, err := cfg.ResolveFileAccess("backend"); err == nil {
+		t.Error("Expected cycle to be reported when resolving access")
+	}
+
+	err = cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected Validate to report the group cycle")
+	}
+
+	if want := "group cycle: backend -> platform -> sre -> backend"; err.Error() != want {
+		t.Errorf("Expected %q, got %q", want, err)
+	}
+}
+
+func TestFileLayers(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Recipients["alice"] = "age1alice"
+	cfg.Files["base"] = FileConfig{Filename: "base.env", Access: []string{"*"}}
+	cfg.Files["shared"] = FileConfig{Filename: "shared.env", Access: []string{"*"}, Extends: []string{"base"}}
+	cfg.Files["prod"] = FileConfig{Filename: "prod.env", Access: []string{"*"}, Extends: []string{"base", "shared"}}
+
+	layers, err := cfg.FileLayers("prod")
+	if err != nil {
+		t.Fatalf("FileLayers failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(layers, []string{"base", "shared", "prod"}) {
+		t.Errorf("Expected [base shared prod], got %v", layers)
+	}
+
+	if extending := cfg.FilesExtending("base"); !reflect.DeepEqual(extending, []string{"prod", "shared"}) {
+		t.Errorf("Expected [prod shared], got %v", extending)
+	}
+
+	cfg.Files["base"] = FileConfig{Filename: "base.env", Access: []string{"*"}, Extends: []string{"missing"}}
+
+	if err := cfg.Validate(); err == nil || err.Error() != "file 'base' extends unknown file 'missing'" {
+		t.Errorf("Expected unknown parent error, got %v", err)
+	}
+
+	cfg.Files["base"] = FileConfig{Filename: "base.env", Access: []string{"*"}, Extends: []string{"prod"}}
+
+	_, err = cfg.FileLayers("prod")
+	if err == nil {
+		t.Fatal("Expected extends cycle to be reported")
+	}
+
+	if want := "extends cycle: prod -> base -> prod"; err.Error() != want {
+		t.Errorf("Expected %q, got %q", want, err)
+	}
+}
+
+func TestValidateAccess(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Recipients["alice"] = "age1alice"
+	cfg.Groups["ops"] = []string{"alice"}
+
+	if err := cfg.ValidateAccess([]string{"ops", "alice", "*"}); err != nil {
+		t.Errorf("Expected access list to be valid, got %v", err)
+	}
+
+	if err := cfg.ValidateAccess([]string{"ops", "mallory"}); err == nil {
+		t.Error("Expected unknown accessor to be rejected")
+	}
+
+	if err := cfg.ValidateAccess(nil); err == nil {
+		t.Error("Expected empty access list to be rejected")
+	}
+}
+
 func TestGetEnvFile(t *testing.T) {
 	cfg := NewConfig()
 	cfg.Files["production"] = FileConfig{
@@ -184,6 +378,76 @@ func TestResolveFileAccess(t *testing.T) {
 	}
 }
 
+func TestFileNames(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Files["production"] = FileConfig{Filename: prodEnv, Access: []string{"*"}}
+	cfg.Files["staging"] = FileConfig{Filename: "staging.env", Access: []string{"*"}}
+
+	expected := []string{"default", "production", "staging"}
+	if names := cfg.FileNames(); !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+}
+
+func TestFileNameForPath(t *testing.T) {
+	tmpDir := createTempDir(t)
+
+	cfg := NewConfig()
+	cfg.Files["default"] = FileConfig{Filename: filepath.Join(tmpDir, DefaultEnvFile), Access: []string{"*"}}
+	cfg.Files["production"] = FileConfig{Filename: filepath.Join(tmpDir, "envs", prodEnv), Access: []string{"*"}}
+
+	name, found := cfg.FileNameForPath(filepath.Join(tmpDir, "envs", "..", "envs", prodEnv))
+	if !found || name != "production" {
+		t.Errorf("Expected production, got %q (found=%v)", name, found)
+	}
+
+	if _, found := cfg.FileNameForPath(filepath.Join(tmpDir, "other.env")); found {
+		t.Error("Expected unconfigured path not to match")
+	}
+}
+
+func TestFind(t *testing.T) {
+	tmpDir := createTempDir(t)
+
+	repoDir := filepath.Join(tmpDir, "repo")
+	workDir := filepath.Join(repoDir, "services", "api")
+
+	if err := os.MkdirAll(workDir, 0o750); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+
+	// A configuration above the repository root must not be found
+	if err := os.WriteFile(filepath.Join(tmpDir, DefaultConfigFile), []byte(""), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	if err := os.Mkdir(filepath.Join(repoDir, ".git"), 0o750); err != nil {
+		t.Fatalf("Failed to create .git: %v", err)
+	}
+
+	if path, found := Find(workDir); found {
+		t.Errorf("Expected search to stop at the git root, found %s", path)
+	}
+
+	configPath := filepath.Join(repoDir, DefaultConfigFile)
+	if err := os.WriteFile(configPath, []byte(""), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	if path, found := Find(workDir); !found || path != configPath {
+		t.Errorf("Expected %s, got %s (found %v)", configPath, path, found)
+	}
+
+	nearest := filepath.Join(workDir, DefaultConfigFile)
+	if err := os.WriteFile(nearest, []byte(""), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	if path, found := Find(workDir); !found || path != nearest {
+		t.Errorf("Expected nearest config %s, got %s", nearest, path)
+	}
+}
+
 // Helper functions
 func createTempDir(t *testing.T) string {
 	t.Helper()
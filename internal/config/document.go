@@ -0,0 +1,1017 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/toml"
+)
+
+// errUnsupportedLayout is returned when a configuration file cannot be edited in place.
+// Save then falls back to writing the whole file.
+var errUnsupportedLayout = errors.New("unsupported configuration layout")
+
+// tomlHeader is a [table] header line in a configuration file
+type tomlHeader struct {
+	path   []string
+	indent string
+	start  int // offset of the start of the line
+	end    int // offset after the line break
+}
+
+// tomlEntry is a key/value pair in a configuration file
+type tomlEntry struct {
+	table      []string
+	key        []string
+	indent     string
+	start      int // offset of the start of the line
+	valueStart int
+	valueEnd   int
+	end        int // offset after any trailing comment and the line break
+}
+
+func (e tomlEntry) path() []string {
+	return append(slices.Clone(e.table), e.key...)
+}
+
+// document records where tables and keys are in a TOML file so they can be edited in place
+type document struct {
+	data    []byte
+	newline string
+	headers []tomlHeader
+	entries []tomlEntry
+}
+
+// edit replaces data[start:end] with text; start == end inserts. Text of an inserted line
+// is moved onto a line of its own if the preceding output does not end with a line break.
+type edit struct {
+	start, end int
+	text       string
+	line       bool
+}
+
+// documentEditor collects edits against a document and applies them in one pass
+type documentEditor struct {
+	doc       *document
+	configDir string
+	edits     []edit
+	// tables holds new top-level tables, appended after all other edits
+	tables []string
+}
+
+// updateDocument rewrites only the settings, recipients, groups and files that differ between
+// before and after in data, the file before was loaded from. Comments, ordering and formatting
+// elsewhere are kept byte-for-byte. Returns errUnsupportedLayout if the file cannot be edited safely.
+func updateDocument(data []byte, before, after *Config, configDir string) ([]byte, error) {
+	doc, err := parseDocument(data)
+	if err != nil {
+		return nil, err
+	}
+
+	editor := &documentEditor{doc: doc, configDir: configDir}
+
+	settings := []struct {
+		name    string
+		changed bool
+		unset   bool
+		render  func(current string) string
+	}{
+		{"include", !slices.Equal(before.Include, after.Include), len(after.Include) == 0, func(current string) string { return formatArray(after.Include, current) }},
+		{"armor", before.Armor != after.Armor, !after.Armor, func(string) string { return "true" }},
+		{"signers", !slices.Equal(before.Signers, after.Signers), len(after.Signers) == 0, func(current string) string { return formatArray(after.Signers, current) }},
+		{"signature_policy", before.SignaturePolicy != after.SignaturePolicy, after.SignaturePolicy == "", func(string) string { return formatString(after.SignaturePolicy) }},
+	}
+
+	var added []string
+
+	for _, setting := range settings {
+		entry, exists := doc.find([]string{setting.name})
+
+		switch {
+		case !setting.changed:
+		case setting.unset:
+			if err := editor.deleteKey([]string{setting.name}); err != nil {
+				return nil, err
+			}
+		case exists:
+			editor.replace(entry.valueStart, entry.valueEnd, setting.render(string(data[entry.valueStart:entry.valueEnd])))
+		default:
+			added = append(added, formatKeyPath([]string{setting.name})+" = "+setting.render(""))
+		}
+	}
+
+	editor.insertRootKeys(added)
+
+	for _, name := range unionKeys(before.Recipients, after.Recipients) {
+		oldKey, inBefore := before.Recipients[name]
+		newKey, inAfter := after.Recipients[name]
+
+		switch {
+		case !inAfter:
+			err = editor.deleteKey([]string{"recipients", name})
+		case !inBefore || oldKey != newKey:
+			err = editor.setKey([]string{"recipients", name}, func(string) string { return formatString(newKey) })
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, name := range unionKeys(before.Groups, after.Groups) {
+		oldMembers, inBefore := before.Groups[name]
+		newMembers, inAfter := after.Groups[name]
+
+		switch {
+		case !inAfter:
+			err = editor.deleteKey([]string{"groups", name})
+		case !inBefore || !slices.Equal(oldMembers, newMembers):
+			err = editor.setKey([]string{"groups", name}, func(current string) string { return formatArray(newMembers, current) })
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, name := range unionKeys(before.Files, after.Files) {
+		oldFile, inBefore := before.Files[name]
+		newFile, inAfter := after.Files[name]
+
+		switch {
+		case !inAfter:
+			err = editor.deleteFile(name)
+		case !inBefore:
+			err = editor.addFile(name, newFile)
+		case !oldFile.equal(newFile):
+			err = editor.updateFile(name, oldFile, newFile)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	updated, err := editor.apply()
+	if err != nil {
+		return nil, err
+	}
+
+	// Never write an edit that does not decode to the intended configuration
+	var check Config
+	if err := toml.Unmarshal(updated, &check); err != nil {
+		return nil, errUnsupportedLayout
+	}
+
+	check.resolvePaths(configDir)
+
+	if !check.sameContent(after) {
+		return nil, errUnsupportedLayout
+	}
+
+	return updated, nil
+}
+
+// setKey replaces the value of an existing key, or inserts the key into the closest enclosing table.
+// render receives the current value text, empty for a new key.
+func (e *documentEditor) setKey(path []string, render func(current string) string) error {
+	if entry, exists := e.doc.find(path); exists {
+		e.replace(entry.valueStart, entry.valueEnd, render(string(e.doc.data[entry.valueStart:entry.valueEnd])))
+
+		return nil
+	}
+
+	return e.insertKey(path, render(""))
+}
+
+// insertRootKeys adds lines as top-level keys, after the existing top-level keys or before the
+// first table if there are none
+func (e *documentEditor) insertRootKeys(lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+
+	text := strings.Join(lines, e.doc.newline) + e.doc.newline
+
+	var (
+		last  tomlEntry
+		found bool
+	)
+
+	for _, entry := range e.doc.entries {
+		if len(entry.table) == 0 {
+			last, found = entry, true
+		}
+	}
+
+	switch {
+	case found:
+		e.insert(last.end, text)
+	case len(e.doc.headers) > 0:
+		e.insert(e.doc.headers[0].start, text+e.doc.newline)
+	default:
+		e.insert(len(e.doc.data), text)
+	}
+}
+
+// insertKey adds a new key at the end of the table with the longest header matching path.
+// A missing top-level table is appended to the end of the file.
+func (e *documentEditor) insertKey(path []string, value string) error {
+	header, found := e.doc.enclosingHeader(path)
+
+	if !found {
+		// Dotted keys before the first header extend the table next to its other keys
+		if entry, exists := e.doc.lastRootEntry(path[0]); exists {
+			e.insert(entry.end, entry.indent+formatKeyPath(path)+" = "+value+e.doc.newline)
+
+			return nil
+		}
+
+		e.tables = append(e.tables, "["+formatKeyPath(path[:1])+"]"+e.doc.newline+
+			e.doc.nestedIndent()+formatKeyPath(path[1:])+" = "+value+e.doc.newline)
+
+		return nil
+	}
+
+	offset, indent := e.doc.sectionEnd(header)
+	e.insert(offset, indent+formatKeyPath(path[len(header.path):])+" = "+value+e.doc.newline)
+
+	return nil
+}
+
+// deleteKey removes the line holding a key
+func (e *documentEditor) deleteKey(path []string) error {
+	entry, exists := e.doc.find(path)
+	if !exists {
+		return errUnsupportedLayout
+	}
+
+	e.replace(entry.start, entry.end, "")
+
+	return nil
+}
+
+// addFile declares a new file in the style the existing files use: [files.name] tables
+// or inline tables under [files]
+func (e *documentEditor) addFile(name string, fileConfig FileConfig) error {
+	var last *tomlHeader
+
+	for i, header := range e.doc.headers {
+		if len(header.path) == 2 && header.path[0] == "files" {
+			last = &e.doc.headers[i]
+		}
+	}
+
+	if last == nil {
+		return e.insertKey([]string{"files", name}, e.formatInlineFile(fileConfig))
+	}
+
+	offset, indent := e.doc.sectionEnd(*last)
+	nl := e.doc.newline
+
+	text := nl + last.indent + "[" + formatKeyPath([]string{"files", name}) + "]" + nl +
+		indent + "filename = " + formatString(relativePath(e.configDir, fileConfig.Filename)) + nl +
+		indent + "access = " + formatArray(fileConfig.Access, "") + nl
+
+	if len(fileConfig.Extends) > 0 {
+		text += indent + "extends = " + formatArray(fileConfig.Extends, "") + nl
+	}
+
+	if fileConfig.Interpolate {
+		text += indent + "interpolate = true" + nl
+	}
+
+	if fileConfig.References {
+		text += indent + "references = true" + nl
+	}
+
+	if fileConfig.Armor != nil {
+		text += indent + "armor = " + strconv.FormatBool(*fileConfig.Armor) + nl
+	}
+
+	if fileConfig.Format != "" {
+		text += indent + "format = " + formatString(fileConfig.Format) + nl
+	}
+
+	e.insert(offset, text)
+
+	return nil
+}
+
+// updateFile rewrites the changed fields of a file declaration
+func (e *documentEditor) updateFile(name string, before, after FileConfig) error {
+	if entry, exists := e.doc.find([]string{"files", name}); exists {
+		if e.doc.data[entry.valueStart] != '{' {
+			return errUnsupportedLayout
+		}
+
+		e.replace(entry.valueStart, entry.valueEnd, e.formatInlineFile(after))
+
+		return nil
+	}
+
+	if before.Filename != after.Filename {
+		filename := formatString(relativePath(e.configDir, after.Filename))
+
+		if err := e.setKey([]string{"files", name, "filename"}, func(string) string { return filename }); err != nil {
+			return err
+		}
+	}
+
+	if !slices.Equal(before.Access, after.Access) {
+		if err := e.setKey([]string{"files", name, "access"}, func(current string) string { return formatArray(after.Access, current) }); err != nil {
+			return err
+		}
+	}
+
+	var err error
+
+	switch {
+	case slices.Equal(before.Extends, after.Extends):
+	case len(after.Extends) == 0:
+		err = e.deleteKey([]string{"files", name, "extends"})
+	default:
+		err = e.setKey([]string{"files", name, "extends"}, func(current string) string { return formatArray(after.Extends, current) })
+	}
+
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case before.Interpolate == after.Interpolate:
+	case !after.Interpolate:
+		err = e.deleteKey([]string{"files", name, "interpolate"})
+	default:
+		err = e.setKey([]string{"files", name, "interpolate"}, func(string) string { return "true" })
+	}
+
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case before.References == after.References:
+	case !after.References:
+		err = e.deleteKey([]string{"files", name, "references"})
+	default:
+		err = e.setKey([]string{"files", name, "references"}, func(string) string { return "true" })
+	}
+
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case equalOptional(before.Armor, after.Armor):
+	case after.Armor == nil:
+		err = e.deleteKey([]string{"files", name, "armor"})
+	default:
+		armored := strconv.FormatBool(*after.Armor)
+
+		err = e.setKey([]string{"files", name, "armor"}, func(string) string { return armored })
+	}
+
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case before.Format == after.Format:
+		return nil
+	case after.Format == "":
+		return e.deleteKey([]string{"files", name, "format"})
+	default:
+		return e.setKey([]string{"files", name, "format"}, func(string) string { return formatString(after.Format) })
+	}
+}
+
+// deleteFile removes a file declaration, whether it is a [files.name] table, an inline
+// table or a set of dotted keys
+func (e *documentEditor) deleteFile(name string) error {
+	path := []string{"files", name}
+
+	if header, exists := e.doc.header(path); exists {
+		start := header.start
+		end, _ := e.doc.sectionEnd(header)
+
+		// Drop one blank line around the table so the separation between tables is kept
+		switch {
+		case end < len(e.doc.data) && isBlank(e.doc.data[end:e.doc.lineEnd(end)]):
+			end = e.doc.lineEnd(end)
+		case start > 0 && isBlank(e.doc.data[e.doc.lineStart(start-1):start]):
+			start = e.doc.lineStart(start - 1)
+		}
+
+		e.replace(start, end, "")
+
+		return nil
+	}
+
+	if _, exists := e.doc.find(path); exists {
+		return e.deleteKey(path)
+	}
+
+	deleted := false
+
+	for _, entry := range e.doc.entries {
+		if entryPath := entry.path(); len(entryPath) > 2 && slices.Equal(entryPath[:2], path) {
+			e.replace(entry.start, entry.end, "")
+
+			deleted = true
+		}
+	}
+
+	if !deleted {
+		return errUnsupportedLayout
+	}
+
+	return nil
+}
+
+func (e *documentEditor) formatInlineFile(fileConfig FileConfig) string {
+	fields := []string{
+		"filename = " + formatString(relativePath(e.configDir, fileConfig.Filename)),
+		"access = " + formatArray(fileConfig.Access, ""),
+	}
+
+	if len(fileConfig.Extends) > 0 {
+		fields = append(fields, "extends = "+formatArray(fileConfig.Extends, ""))
+	}
+
+	if fileConfig.Interpolate {
+		fields = append(fields, "interpolate = true")
+	}
+
+	if fileConfig.References {
+		fields = append(fields, "references = true")
+	}
+
+	if fileConfig.Armor != nil {
+		fields = append(fields, "armor = "+strconv.FormatBool(*fileConfig.Armor))
+	}
+
+	if fileConfig.Format != "" {
+		fields = append(fields, "format = "+formatString(fileConfig.Format))
+	}
+
+	return "{ " + strings.Join(fields, ", ") + " }"
+}
+
+func (e *documentEditor) insert(offset int, text string) {
+	e.edits = append(e.edits, edit{start: offset, end: offset, text: text, line: true})
+}
+
+func (e *documentEditor) replace(start, end int, text string) {
+	e.edits = append(e.edits, edit{start: start, end: end, text: text})
+}
+
+// apply returns the document with all edits applied, followed by any new tables.
+// Insertions at the same offset keep the order they were made in.
+func (e *documentEditor) apply() ([]byte, error) {
+	sort.SliceStable(e.edits, func(i, j int) bool { return e.edits[i].start < e.edits[j].start })
+
+	var result bytes.Buffer
+
+	offset := 0
+
+	for _, edit := range e.edits {
+		if edit.start < offset {
+			return nil, errUnsupportedLayout
+		}
+
+		result.Write(e.doc.data[offset:edit.start])
+
+		if edit.line && result.Len() > 0 && !bytes.HasSuffix(result.Bytes(), []byte("\n")) {
+			result.WriteString(e.doc.newline)
+		}
+
+		result.WriteString(edit.text)
+
+		offset = edit.end
+	}
+
+	result.Write(e.doc.data[offset:])
+
+	for _, table := range e.tables {
+		switch {
+		case result.Len() == 0:
+		case !bytes.HasSuffix(result.Bytes(), []byte("\n")):
+			result.WriteString(e.doc.newline + e.doc.newline)
+		case !isBlank(result.Bytes()[bytes.LastIndexByte(result.Bytes()[:result.Len()-1], '\n')+1:]):
+			result.WriteString(e.doc.newline)
+		}
+
+		result.WriteString(table)
+	}
+
+	return result.Bytes(), nil
+}
+
+// find returns the entry defining the value at path
+func (d *document) find(path []string) (tomlEntry, bool) {
+	for _, entry := range d.entries {
+		if slices.Equal(entry.path(), path) {
+			return entry, true
+		}
+	}
+
+	return tomlEntry{}, false
+}
+
+// header returns the [table] header for path
+func (d *document) header(path []string) (tomlHeader, bool) {
+	for _, header := range d.headers {
+		if slices.Equal(header.path, path) {
+			return header, true
+		}
+	}
+
+	return tomlHeader{}, false
+}
+
+// enclosingHeader returns the header with the longest path that is a proper prefix of path
+func (d *document) enclosingHeader(path []string) (tomlHeader, bool) {
+	best := tomlHeader{}
+	found := false
+
+	for _, header := range d.headers {
+		if len(header.path) < len(path) && slices.Equal(path[:len(header.path)], header.path) &&
+			(!found || len(header.path) > len(best.path)) {
+			best = header
+			found = true
+		}
+	}
+
+	return best, found
+}
+
+// lastRootEntry returns the last dotted key before the first header that defines a value under table
+func (d *document) lastRootEntry(table string) (tomlEntry, bool) {
+	var last tomlEntry
+
+	found := false
+
+	for _, entry := range d.entries {
+		if len(entry.table) == 0 && entry.key[0] == table {
+			last = entry
+			found = true
+		}
+	}
+
+	return last, found
+}
+
+// sectionEnd returns the offset after the last entry of a table, or after its header if it
+// has none, and the indentation to use for a new entry in it
+func (d *document) sectionEnd(header tomlHeader) (int, string) {
+	offset := header.end
+	indent := header.indent + d.nestedIndent()
+
+	for _, entry := range d.entries {
+		if slices.Equal(entry.table, header.path) {
+			offset = entry.end
+			indent = entry.indent
+		}
+	}
+
+	return offset, indent
+}
+
+// nestedIndent returns the indentation of keys relative to their table header, as used in the file
+func (d *document) nestedIndent() string {
+	for _, header := range d.headers {
+		for _, entry := range d.entries {
+			if slices.Equal(entry.table, header.path) && strings.HasPrefix(entry.indent, header.indent) {
+				return entry.indent[len(header.indent):]
+			}
+		}
+	}
+
+	return ""
+}
+
+func (d *document) lineStart(offset int) int {
+	return bytes.LastIndexByte(d.data[:offset], '\n') + 1
+}
+
+func (d *document) lineEnd(offset int) int {
+	if i := bytes.IndexByte(d.data[offset:], '\n'); i >= 0 {
+		return offset + i + 1
+	}
+
+	return len(d.data)
+}
+
+func isBlank(line []byte) bool {
+	return len(bytes.TrimSpace(line)) == 0
+}
+
+// parseDocument scans a TOML file for table headers and key/value pairs.
+// Arrays of tables are not used by kiln and are reported as errUnsupportedLayout.
+func parseDocument(data []byte) (*document, error) {
+	doc := &document{data: data, newline: "\n"}
+	if bytes.Contains(data, []byte("\r\n")) {
+		doc.newline = "\r\n"
+	}
+
+	s := &tomlScanner{data: data}
+
+	var table []string
+
+	for s.pos < len(data) {
+		lineStart := s.pos
+		s.skipSpace()
+		indent := string(data[lineStart:s.pos])
+
+		switch s.peek() {
+		case '#', '\r', '\n', 0:
+			if err := s.finishLine(); err != nil {
+				return nil, err
+			}
+		case '[':
+			if bytes.HasPrefix(data[s.pos:], []byte("[[")) {
+				return nil, errUnsupportedLayout
+			}
+
+			s.pos++
+
+			path, err := s.parseKey()
+			if err != nil {
+				return nil, err
+			}
+
+			if s.peek() != ']' {
+				return nil, errUnsupportedLayout
+			}
+
+			s.pos++
+
+			if err := s.finishLine(); err != nil {
+				return nil, err
+			}
+
+			table = path
+			doc.headers = append(doc.headers, tomlHeader{path: path, indent: indent, start: lineStart, end: s.pos})
+		default:
+			key, err := s.parseKey()
+			if err != nil {
+				return nil, err
+			}
+
+			if s.peek() != '=' {
+				return nil, errUnsupportedLayout
+			}
+
+			s.pos++
+			s.skipSpace()
+
+			valueStart := s.pos
+			if err := s.skipValue(); err != nil {
+				return nil, err
+			}
+
+			valueEnd := s.pos
+
+			if err := s.finishLine(); err != nil {
+				return nil, err
+			}
+
+			doc.entries = append(doc.entries, tomlEntry{
+				table:      table,
+				key:        key,
+				indent:     indent,
+				start:      lineStart,
+				valueStart: valueStart,
+				valueEnd:   valueEnd,
+				end:        s.pos,
+			})
+		}
+	}
+
+	return doc, nil
+}
+
+// tomlScanner tokenizes just enough TOML to locate keys and the extent of values
+type tomlScanner struct {
+	data []byte
+	pos  int
+}
+
+func (s *tomlScanner) peek() byte {
+	if s.pos < len(s.data) {
+		return s.data[s.pos]
+	}
+
+	return 0
+}
+
+func (s *tomlScanner) skipSpace() {
+	for s.pos < len(s.data) && (s.data[s.pos] == ' ' || s.data[s.pos] == '\t') {
+		s.pos++
+	}
+}
+
+// finishLine consumes an optional comment and the line break that ends a statement
+func (s *tomlScanner) finishLine() error {
+	s.skipSpace()
+
+	if s.peek() == '#' {
+		for s.pos < len(s.data) && s.data[s.pos] != '\n' {
+			s.pos++
+		}
+
+		if s.pos < len(s.data) {
+			s.pos++
+		}
+
+		return nil
+	}
+
+	if s.peek() == '\r' {
+		s.pos++
+	}
+
+	switch s.peek() {
+	case '\n':
+		s.pos++
+	case 0:
+		if s.pos < len(s.data) {
+			return errUnsupportedLayout
+		}
+	default:
+		return errUnsupportedLayout
+	}
+
+	return nil
+}
+
+// parseKey parses a possibly dotted key and any whitespace after it
+func (s *tomlScanner) parseKey() ([]string, error) {
+	var parts []string
+
+	for {
+		s.skipSpace()
+
+		part, err := s.parseKeyPart()
+		if err != nil {
+			return nil, err
+		}
+
+		parts = append(parts, part)
+
+		s.skipSpace()
+
+		if s.peek() != '.' {
+			return parts, nil
+		}
+
+		s.pos++
+	}
+}
+
+func (s *tomlScanner) parseKeyPart() (string, error) {
+	start := s.pos
+
+	switch s.peek() {
+	case '"', '\'':
+		if err := s.skipString(); err != nil {
+			return "", err
+		}
+
+		var key struct{ K string }
+		if _, err := toml.Decode("K = "+string(s.data[start:s.pos]), &key); err != nil {
+			return "", errUnsupportedLayout
+		}
+
+		return key.K, nil
+	default:
+		for s.pos < len(s.data) && isBareKeyChar(s.data[s.pos]) {
+			s.pos++
+		}
+
+		if s.pos == start {
+			return "", errUnsupportedLayout
+		}
+
+		return string(s.data[start:s.pos]), nil
+	}
+}
+
+// skipValue moves past a value: a string, array, inline table or bare scalar
+func (s *tomlScanner) skipValue() error {
+	switch s.peek() {
+	case '"', '\'':
+		return s.skipString()
+	case '[', '{':
+		return s.skipContainer()
+	default:
+		start := s.pos
+		for s.pos < len(s.data) && !strings.ContainsRune(" \t\r\n#,]}", rune(s.data[s.pos])) {
+			s.pos++
+		}
+
+		if s.pos == start {
+			return errUnsupportedLayout
+		}
+
+		return nil
+	}
+}
+
+// skipString moves past a basic, literal or multi-line string
+func (s *tomlScanner) skipString() error {
+	quote := s.data[s.pos]
+	delimiter := []byte{quote, quote, quote}
+	multiline := bytes.HasPrefix(s.data[s.pos:], delimiter)
+
+	if multiline {
+		s.pos += 3
+	} else {
+		s.pos++
+	}
+
+	for s.pos < len(s.data) {
+		c := s.data[s.pos]
+
+		switch {
+		case c == '\\' && quote == '"':
+			s.pos += 2
+
+			continue
+		case c == '\n' && !multiline:
+			return errUnsupportedLayout
+		case c == quote && !multiline:
+			s.pos++
+
+			return nil
+		case c == quote && bytes.HasPrefix(s.data[s.pos:], delimiter):
+			s.pos += 3
+			// Up to two quotes directly before the closing delimiter belong to the string
+			for i := 0; i < 2 && s.peek() == quote; i++ {
+				s.pos++
+			}
+
+			return nil
+		}
+
+		s.pos++
+	}
+
+	return errUnsupportedLayout
+}
+
+// skipContainer moves past an array or inline table, including nested values and comments
+func (s *tomlScanner) skipContainer() error {
+	depth := 0
+
+	for s.pos < len(s.data) {
+		switch s.data[s.pos] {
+		case '[', '{':
+			depth++
+			s.pos++
+		case ']', '}':
+			depth--
+			s.pos++
+
+			if depth == 0 {
+				return nil
+			}
+		case '"', '\'':
+			if err := s.skipString(); err != nil {
+				return err
+			}
+		case '#':
+			for s.pos < len(s.data) && s.data[s.pos] != '\n' {
+				s.pos++
+			}
+		default:
+			s.pos++
+		}
+	}
+
+	return errUnsupportedLayout
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// formatKeyPath renders a dotted key, quoting parts that are not valid bare keys
+func formatKeyPath(path []string) string {
+	parts := make([]string, len(path))
+
+	for i, part := range path {
+		parts[i] = part
+
+		if part == "" || strings.IndexFunc(part, func(r rune) bool { return r >= utf8.RuneSelf || !isBareKeyChar(byte(r)) }) >= 0 {
+			parts[i] = formatString(part)
+		}
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// formatString renders a TOML basic string
+func formatString(value string) string {
+	var b strings.Builder
+
+	b.WriteByte('"')
+
+	for _, r := range value {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04X`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	b.WriteByte('"')
+
+	return b.String()
+}
+
+// formatArray renders an array of strings, one element per line if current spans several lines
+func formatArray(values []string, current string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = formatString(value)
+	}
+
+	lines := strings.Split(current, "\n")
+	if len(lines) < 3 || len(values) == 0 {
+		return "[" + strings.Join(quoted, ", ") + "]"
+	}
+
+	newline := "\n"
+	if strings.HasSuffix(lines[0], "\r") {
+		newline = "\r\n"
+	}
+
+	elementIndent := leadingSpace(lines[1])
+	closingIndent := leadingSpace(lines[len(lines)-1])
+
+	var b strings.Builder
+
+	b.WriteString("[" + newline)
+
+	for _, value := range quoted {
+		b.WriteString(elementIndent + value + "," + newline)
+	}
+
+	b.WriteString(closingIndent + "]")
+
+	return b.String()
+}
+
+func leadingSpace(line string) string {
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
+
+// relativePath returns filename relative to configDir when it lies inside it,
+// so saved configurations stay portable across checkouts
+func relativePath(configDir, filename string) string {
+	if !filepath.IsAbs(filename) {
+		return filename
+	}
+
+	rel, err := filepath.Rel(configDir, filename)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filename
+	}
+
+	return rel
+}
+
+// unionKeys returns the sorted keys present in either map
+func unionKeys[V any](a, b map[string]V) []string {
+	keys := slices.Collect(maps.Keys(a))
+
+	for key := range b {
+		if _, exists := a[key]; !exists {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
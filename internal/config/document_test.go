@@ -0,0 +1,368 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSavePreservesFormatting(t *testing.T) {
+	tests := []struct {
+		name     string
+		original string
+		change   func(cfg *Config, dir string)
+		want     string
+	}{
+		{
+			name: "unchanged",
+			original: `# Team keys
+[recipients]
+bob   = "age1bob"   # laptop
+alice = "age1alice"
+
+[files]
+default = { filename = ".kiln.env", access = ["*"] }
+`,
+			change: func(*Config, string) {},
+			want: `# Team keys
+[recipients]
+bob   = "age1bob"   # laptop
+alice = "age1alice"
+
+[files]
+default = { filename = ".kiln.env", access = ["*"] }
+`,
+		},
+		{
+			name: "add recipient and group",
+			original: `# Team keys
+[recipients]
+bob   = "age1bob"   # laptop
+alice = "age1alice"
+
+[files]
+default = { filename = ".kiln.env", access = ["*"] }
+`,
+			change: func(cfg *Config, _ string) {
+				cfg.AddRecipient("carol", "age1carol")
+				cfg.Groups = map[string][]string{"ops": {"alice", "carol"}}
+			},
+			want: `# Team keys
+[recipients]
+bob   = "age1bob"   # laptop
+alice = "age1alice"
+carol = "age1carol"
+
+[files]
+default = { filename = ".kiln.env", access = ["*"] }
+
+[groups]
+ops = ["alice", "carol"]
+`,
+		},
+		{
+			name: "remove recipient and update inline file",
+			original: `[recipients]
+  bob = "age1bob"
+  alice = "age1alice" # remove me
+
+[groups]
+  ops = [
+    "alice",
+    "bob",
+  ]
+
+[files]
+  # Production secrets
+  prod = { filename = "prod.env", access = ["ops", "alice"] }
+  default = { filename = ".kiln.env", access = ["*"] }
+`,
+			change: func(cfg *Config, _ string) {
+				cfg.RemoveRecipient("alice")
+			},
+			want: `[recipients]
+  bob = "age1bob"
+
+[groups]
+  ops = [
+    "bob",
+  ]
+
+[files]
+  # Production secrets
+  prod = { filename = "prod.env", access = ["ops"] }
+  default = { filename = ".kiln.env", access = ["*"] }
+`,
+		},
+		{
+			name: "file tables",
+			original: `[recipients]
+alice = "age1alice"
+
+[files.default]
+filename = ".kiln.env"
+access = ["*"]
+
+# Staging is shared with contractors
+[files.staging]
+filename = "staging.env" # moved later
+access = ["alice"]
+
+[files.legacy]
+filename = "legacy.env"
+access = ["*"]
+`,
+			change: func(cfg *Config, dir string) {
+				delete(cfg.Files, "legacy")
+
+				staging := cfg.Files["staging"]
+				staging.Filename = filepath.Join(dir, "envs", "staging.env")
+				cfg.Files["staging"] = staging
+
+				cfg.Files["prod"] = FileConfig{Filename: filepath.Join(dir, "prod.env"), Access: []string{"alice"}}
+			},
+			want: `[recipients]
+alice = "age1alice"
+
+[files.default]
+filename = ".kiln.env"
+access = ["*"]
+
+# Staging is shared with contractors
+[files.staging]
+filename = "envs/staging.env" # moved later
+access = ["alice"]
+
+[files.prod]
+filename = "prod.env"
+access = ["alice"]
+`,
+		},
+		{
+			name: "file extends",
+			original: `[recipients]
+alice = "age1alice"
+
+[files]
+base = { filename = "base.env", access = ["*"] }
+staging = { filename = "staging.env", access = ["*"] }
+
+[files.prod]
+filename = "prod.env"
+access = ["alice"]
+extends = ["base"]
+`,
+			change: func(cfg *Config, _ string) {
+				staging := cfg.Files["staging"]
+				staging.Extends = []string{"base"}
+				staging.References = true
+				cfg.Files["staging"] = staging
+
+				prod := cfg.Files["prod"]
+				prod.Extends = nil
+				prod.Interpolate = true
+				prod.References = true
+				cfg.Files["prod"] = prod
+			},
+			want: `[recipients]
+alice = "age1alice"
+
+[files]
+base = { filename = "base.env", access = ["*"] }
+staging = { filename = "staging.env", access = ["*"], extends = ["base"], references = true }
+
+[files.prod]
+filename = "prod.env"
+access = ["alice"]
+interpolate = true
+references = true
+`,
+		},
+		{
+			name: "file armor",
+			original: `armor = true
+
+[recipients]
+alice = "age1alice"
+
+[files]
+default = { filename = ".kiln.env", access = ["*"] }
+
+[files.prod]
+filename = "prod.env"
+access = ["alice"]
+armor = true
+`,
+			change: func(cfg *Config, _ string) {
+				binary := false
+
+				defaults := cfg.Files["default"]
+				defaults.Armor = &binary
+				cfg.Files["default"] = defaults
+
+				prod := cfg.Files["prod"]
+				prod.Armor = nil
+				cfg.Files["prod"] = prod
+			},
+			want: `armor = true
+
+[recipients]
+alice = "age1alice"
+
+[files]
+default = { filename = ".kiln.env", access = ["*"], armor = false }
+
+[files.prod]
+filename = "prod.env"
+access = ["alice"]
+`,
+		},
+		{
+			name: "dotted keys",
+			original: `recipients.alice = "age1alice" # admin
+files.default = { filename = ".kiln.env", access = ["*"] }
+
+# Reviewed quarterly
+[groups]
+`,
+			change: func(cfg *Config, _ string) {
+				cfg.AddRecipient("bob", "age1bob")
+				cfg.Groups["ops"] = []string{"bob"}
+			},
+			want: `recipients.alice = "age1alice" # admin
+recipients.bob = "age1bob"
+files.default = { filename = ".kiln.env", access = ["*"] }
+
+# Reviewed quarterly
+[groups]
+ops = ["bob"]
+`,
+		},
+		{
+			name: "add settings",
+			original: `# Team keys
+[recipients]
+alice = "age1alice"
+
+[files]
+default = { filename = ".kiln.env", access = ["*"] }
+`,
+			change: func(cfg *Config, _ string) {
+				cfg.Signers = []string{"alice"}
+				cfg.SignaturePolicy = "refuse"
+			},
+			want: `# Team keys
+signers = ["alice"]
+signature_policy = "refuse"
+
+[recipients]
+alice = "age1alice"
+
+[files]
+default = { filename = ".kiln.env", access = ["*"] }
+`,
+		},
+		{
+			name: "update and remove settings",
+			original: `# Only alice signs releases
+signers = ["alice"] # see SECURITY.md
+signature_policy = "refuse"
+
+[recipients]
+alice = "age1alice"
+bob = "age1bob"
+
+[files]
+default = { filename = ".kiln.env", access = ["*"] }
+`,
+			change: func(cfg *Config, _ string) {
+				cfg.Signers = []string{"alice", "bob"}
+				cfg.SignaturePolicy = ""
+				cfg.Armor = true
+			},
+			want: `# Only alice signs releases
+signers = ["alice", "bob"] # see SECURITY.md
+armor = true
+
+[recipients]
+alice = "age1alice"
+bob = "age1bob"
+
+[files]
+default = { filename = ".kiln.env", access = ["*"] }
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := createTempDir(t)
+			configPath := filepath.Join(tmpDir, "kiln.toml")
+
+			if err := os.WriteFile(configPath, []byte(tt.original), 0o600); err != nil {
+				t.Fatalf("Failed to write config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+
+			tt.change(cfg, tmpDir)
+
+			if err := cfg.Save(configPath); err != nil {
+				t.Fatalf("Save failed: %v", err)
+			}
+
+			got, err := os.ReadFile(configPath)
+			if err != nil {
+				t.Fatalf("Failed to read config: %v", err)
+			}
+
+			if string(got) != tt.want {
+				t.Errorf("Saved config mismatch:\n--- got ---\n%s\n--- want ---\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveFallsBackToMarshal(t *testing.T) {
+	tmpDir := createTempDir(t)
+	configPath := filepath.Join(tmpDir, "kiln.toml")
+
+	// Arrays of tables are not edited in place
+	original := "[recipients]\nalice = \"age1alice\"\n\n[files]\ndefault = { filename = \".kiln.env\", access = [\"*\"] }\n\n[[notes]]\ntext = \"ignored\"\n"
+	if err := os.WriteFile(configPath, []byte(original), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	cfg.AddRecipient("bob", "age1bob")
+
+	if err := cfg.Save(configPath); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if !loaded.sameContent(cfg) {
+		t.Errorf("Saved config does not match: got %+v, want %+v", loaded, cfg)
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+
+	if strings.Contains(string(data), tmpDir) {
+		t.Errorf("Saved config should use relative paths, got:\n%s", data)
+	}
+}
@@ -0,0 +1,198 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/BurntSushi/toml"
+)
+
+// includeFile is the content of a file listed in include. Only recipients, groups and further
+// includes are read; environment files are always declared in the project configuration.
+type includeFile struct {
+	Include    []string            `toml:"include"`
+	Recipients map[string]string   `toml:"recipients"`
+	Groups     map[string][]string `toml:"groups"`
+}
+
+// included records the recipients and groups merged from included files and where each came from
+type included struct {
+	configPath string
+	files      []string
+	recipients map[string]string
+	groups     map[string][]string
+	// origins maps "recipient:name" and "group:name" to the included file that first defines them
+	origins map[string]string
+}
+
+// origin returns the file defining a recipient or group key, the project configuration if
+// no included file does
+func (inc *included) origin(key string) string {
+	if origin, exists := inc.origins[key]; exists {
+		return origin
+	}
+
+	return inc.configPath
+}
+
+// IncludedFiles returns the absolute paths of every file included by the configuration,
+// directly or through other included files, in the order they were loaded
+func (c *Config) IncludedFiles() []string {
+	if c.included == nil {
+		return nil
+	}
+
+	return slices.Clone(c.included.files)
+}
+
+// IncludeOrigin returns the included file that defines a recipient or group, if any
+func (c *Config) IncludeOrigin(name string) (string, bool) {
+	if c.included == nil {
+		return "", false
+	}
+
+	if origin, exists := c.included.origins["recipient:"+name]; exists {
+		return origin, true
+	}
+
+	origin, exists := c.included.origins["group:"+name]
+
+	return origin, exists
+}
+
+// loadIncludes merges the recipients and groups of included files into the configuration.
+// Include paths are relative to the file listing them. A name defined differently in two
+// places is an error; identical definitions are merged.
+func (c *Config) loadIncludes(configPath string) error {
+	if len(c.Include) == 0 {
+		return nil
+	}
+
+	inc := &included{
+		configPath: configPath,
+		recipients: make(map[string]string),
+		groups:     make(map[string][]string),
+		origins:    make(map[string]string),
+	}
+
+	if c.Recipients == nil {
+		c.Recipients = make(map[string]string)
+	}
+
+	if c.Groups == nil {
+		c.Groups = make(map[string][]string)
+	}
+
+	visited := map[string]bool{configPath: true}
+
+	if err := c.mergeIncludes(inc, configPath, c.Include, visited); err != nil {
+		return err
+	}
+
+	c.included = inc
+
+	return nil
+}
+
+func (c *Config) mergeIncludes(inc *included, from string, paths []string, visited map[string]bool) error {
+	for _, path := range paths {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(from), path)
+		}
+
+		path = filepath.Clean(path)
+
+		if visited[path] {
+			continue
+		}
+
+		visited[path] = true
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("include '%s' from '%s': %w", path, from, err)
+		}
+
+		var file includeFile
+		if err := toml.Unmarshal(data, &file); err != nil {
+			return fmt.Errorf("include '%s': %w", path, err)
+		}
+
+		inc.files = append(inc.files, path)
+
+		for _, name := range slices.Sorted(maps.Keys(file.Recipients)) {
+			publicKey := file.Recipients[name]
+
+			if existing, exists := c.Recipients[name]; exists && existing != publicKey {
+				return fmt.Errorf("recipient '%s' is defined with different keys in '%s' and '%s'", name, inc.origin("recipient:"+name), path)
+			}
+
+			if _, exists := inc.origins["recipient:"+name]; !exists {
+				inc.origins["recipient:"+name] = path
+			}
+
+			c.Recipients[name] = publicKey
+			inc.recipients[name] = publicKey
+		}
+
+		for _, name := range slices.Sorted(maps.Keys(file.Groups)) {
+			members := file.Groups[name]
+
+			if existing, exists := c.Groups[name]; exists && !slices.Equal(existing, members) {
+				return fmt.Errorf("group '%s' is defined with different members in '%s' and '%s'", name, inc.origin("group:"+name), path)
+			}
+
+			if _, exists := inc.origins["group:"+name]; !exists {
+				inc.origins["group:"+name] = path
+			}
+
+			c.Groups[name] = slices.Clone(members)
+			inc.groups[name] = slices.Clone(members)
+		}
+
+		if err := c.mergeIncludes(inc, path, file.Include, visited); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// localView returns the configuration without the recipients and groups that come from
+// included files, as it is written to the project configuration. Changing or removing an
+// included definition is an error, since it has to be made in the included file.
+func (c *Config) localView() (*Config, error) {
+	local := c.Clone()
+
+	if c.included == nil {
+		return local, nil
+	}
+
+	// Definitions the project file itself had when it was loaded or last saved stay in it
+	loaded := c.source.loaded
+
+	for name, publicKey := range c.included.recipients {
+		if current, exists := c.Recipients[name]; !exists || current != publicKey {
+			return nil, fmt.Errorf("recipient '%s' is defined in included file '%s' (change it there)", name, c.included.origins["recipient:"+name])
+		}
+
+		if _, isLocal := loaded.Recipients[name]; !isLocal {
+			delete(local.Recipients, name)
+		}
+	}
+
+	for name, members := range c.included.groups {
+		if current, exists := c.Groups[name]; !exists || !slices.Equal(current, members) {
+			return nil, fmt.Errorf("group '%s' is defined in included file '%s' (change it there)", name, c.included.origins["group:"+name])
+		}
+
+		if _, isLocal := loaded.Groups[name]; !isLocal {
+			delete(local.Groups, name)
+		}
+	}
+
+	return local, nil
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadIncludes(t *testing.T) {
+	tmpDir := createTempDir(t)
+
+	writeFile := func(path, content string) {
+		t.Helper()
+
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	teamPath := filepath.Join(tmpDir, "team", "recipients.toml")
+	basePath := filepath.Join(tmpDir, "team", "base.toml")
+	configPath := filepath.Join(tmpDir, "api", DefaultConfigFile)
+
+	writeFile(basePath, `[recipients]
+alice = "age1alice"
+`)
+	writeFile(teamPath, `include = ["base.toml"]
+
+[recipients]
+bob = "age1bob"
+
+[groups]
+ops = ["alice", "bob"]
+`)
+	writeFile(configPath, `include = ["../team/recipients.toml"]
+
+[recipients]
+carol = "age1carol"
+
+[files]
+prod = { filename = "prod.env", access = ["ops", "carol"] }
+`)
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if want := []string{teamPath, basePath}; !reflect.DeepEqual(cfg.IncludedFiles(), want) {
+		t.Errorf("Expected included files %v, got %v", want, cfg.IncludedFiles())
+	}
+
+	recipients, err := cfg.ResolveFileAccess("prod")
+	if err != nil {
+		t.Fatalf("ResolveFileAccess failed: %v", err)
+	}
+
+	if len(recipients) != 3 {
+		t.Errorf("Expected 3 recipients, got %v", recipients)
+	}
+
+	if origin, found := cfg.IncludeOrigin("alice"); !found || origin != basePath {
+		t.Errorf("Expected alice to come from %s, got %q", basePath, origin)
+	}
+
+	if _, found := cfg.IncludeOrigin("carol"); found {
+		t.Error("Expected carol to be a local recipient")
+	}
+
+	// Included definitions are not copied into the project configuration
+	cfg.AddRecipient("dave", "age1dave")
+
+	if err := cfg.Save(configPath); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+
+	if content := string(data); strings.Contains(content, "alice") || strings.Contains(content, "[groups]") || !strings.Contains(content, "dave") {
+		t.Errorf("Expected only local recipients to be saved, got:\n%s", content)
+	}
+
+	cfg.RemoveRecipient("bob")
+
+	if err := cfg.Save(configPath); err == nil || !strings.Contains(err.Error(), teamPath) {
+		t.Errorf("Expected removing an included recipient to point at %s, got %v", teamPath, err)
+	}
+
+	writeFile(configPath, `include = ["../team/recipients.toml"]
+
+[recipients]
+bob = "age1other"
+`)
+
+	if _, err := Load(configPath); err == nil || !strings.Contains(err.Error(), "different keys") {
+		t.Errorf("Expected conflicting recipient error, got %v", err)
+	}
+
+	writeFile(configPath, `include = ["../team/missing.toml"]
+
+[recipients]
+carol = "age1carol"
+`)
+
+	if _, err := Load(configPath); err == nil {
+		t.Error("Expected missing include to fail")
+	}
+}
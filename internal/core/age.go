@@ -2,6 +2,8 @@ package core
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
 	"io"
 	"reflect"
@@ -9,7 +11,10 @@ import (
 
 	"filippo.io/age"
 	"filippo.io/age/agessh"
+	"filippo.io/age/armor"
+	"filippo.io/age/plugin"
 	"github.com/alecthomas/kong"
+	"golang.org/x/crypto/ssh"
 )
 
 // AgeManager handles all Age encryption/decryption operations
@@ -28,6 +33,15 @@ func NewAgeManager(recipients []age.Recipient, identities []age.Identity) *AgeMa
 
 // Encrypt encrypts data using all configured recipients
 func (am *AgeManager) Encrypt(data []byte) ([]byte, error) {
+	return am.encrypt(data, false)
+}
+
+// EncryptArmored encrypts data like Encrypt and wraps the result in PEM-style ASCII armor
+func (am *AgeManager) EncryptArmored(data []byte) ([]byte, error) {
+	return am.encrypt(data, true)
+}
+
+func (am *AgeManager) encrypt(data []byte, armored bool) ([]byte, error) {
 	if len(am.recipients) == 0 {
 		return nil, fmt.Errorf("no recipients configured")
 	}
@@ -37,12 +51,21 @@ func (am *AgeManager) Encrypt(data []byte) ([]byte, error) {
 	}
 
 	estimatedSize := len(data) + 200 + (len(am.recipients) * 50)
+	if armored {
+		// Base64 grows the payload by a third, plus line breaks and the armor lines
+		estimatedSize = estimatedSize*4/3 + estimatedSize/64 + 64
+	}
 
 	var buf bytes.Buffer
 
 	buf.Grow(estimatedSize)
 
-	w, err := age.Encrypt(&buf, am.recipients...)
+	var out io.WriteCloser = nopWriteCloser{&buf}
+	if armored {
+		out = armor.NewWriter(&buf)
+	}
+
+	w, err := age.Encrypt(out, am.recipients...)
 	if err != nil {
 		return nil, fmt.Errorf("encrypt: %w", err)
 	}
@@ -55,10 +78,24 @@ func (am *AgeManager) Encrypt(data []byte) ([]byte, error) {
 		return nil, fmt.Errorf("encrypt: %w", err)
 	}
 
+	if err := out.Close(); err != nil {
+		return nil, fmt.Errorf("encrypt: %w", err)
+	}
+
 	return buf.Bytes(), nil
 }
 
-// Decrypt decrypts data using configured identities
+// nopWriteCloser adds a no-op Close to an io.Writer
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// Decrypt decrypts data using configured identities. Binary and ASCII-armored ciphertext
+// are both accepted.
 func (am *AgeManager) Decrypt(data []byte) ([]byte, error) {
 	if len(am.identities) == 0 {
 		return nil, fmt.Errorf("no identities configured")
@@ -68,7 +105,12 @@ func (am *AgeManager) Decrypt(data []byte) ([]byte, error) {
 		return nil, fmt.Errorf("no data to decrypt")
 	}
 
-	r, err := age.Decrypt(bytes.NewReader(data), am.identities...)
+	var in io.Reader = bytes.NewReader(data)
+	if IsArmored(data) {
+		in = armor.NewReader(in)
+	}
+
+	r, err := age.Decrypt(in, am.identities...)
 	if err != nil {
 		return nil, fmt.Errorf("decrypt: %w", err)
 	}
@@ -121,9 +163,12 @@ func ParseRecipients(publicKeys []string) ([]age.Recipient, error) {
 
 		var err error
 
-		if strings.HasPrefix(key, "age1") {
+		switch {
+		case isPluginRecipient(key):
+			recipient, err = plugin.NewRecipient(key, pluginUI)
+		case strings.HasPrefix(key, "age1"):
 			recipient, err = age.ParseX25519Recipient(key)
-		} else {
+		default:
 			recipient, err = agessh.ParseRecipient(key)
 		}
 
@@ -148,7 +193,7 @@ func ValidatePublicKey(key string) error {
 	}
 
 	// Check for common mistakes
-	if strings.HasPrefix(key, "AGE-SECRET-KEY-") {
+	if strings.HasPrefix(key, "AGE-SECRET-KEY-") || strings.HasPrefix(key, pluginIdentityPrefix) {
 		return fmt.Errorf("private key provided instead of public key - use the corresponding public key")
 	}
 
@@ -156,6 +201,10 @@ func ValidatePublicKey(key string) error {
 		return fmt.Errorf("private key provided instead of public key - use the corresponding public key")
 	}
 
+	if isPluginRecipient(key) {
+		return nil
+	}
+
 	if strings.HasPrefix(key, "age1") {
 		if len(key) < 60 || len(key) > 70 {
 			return fmt.Errorf("invalid age public key format")
@@ -176,11 +225,42 @@ func ValidatePublicKey(key string) error {
 	return fmt.Errorf("unsupported key format - must start with 'age1' or 'ssh-'")
 }
 
+// PublicKeyInfo returns the type of a public key ("age", "age-plugin-<name>", "ssh-ed25519" or
+// "ssh-rsa") and a SHA-256 fingerprint. SSH fingerprints match 'ssh-keygen -l'; age fingerprints
+// hash the encoded key, since age defines no fingerprint format of its own.
+func PublicKeyInfo(publicKey string) (keyType, fingerprint string, err error) {
+	publicKey = strings.TrimSpace(publicKey)
+
+	if name, _, err := plugin.ParseRecipient(publicKey); err == nil {
+		hash := sha256.Sum256([]byte(publicKey))
+
+		return "age-plugin-" + name, "SHA256:" + base64.RawStdEncoding.EncodeToString(hash[:]), nil
+	}
+
+	if strings.HasPrefix(publicKey, "age1") {
+		if _, err := age.ParseX25519Recipient(publicKey); err != nil {
+			return "", "", fmt.Errorf("invalid age public key: %w", err)
+		}
+
+		hash := sha256.Sum256([]byte(publicKey))
+
+		return "age", "SHA256:" + base64.RawStdEncoding.EncodeToString(hash[:]), nil
+	}
+
+	sshKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKey))
+	if err != nil {
+		return "", "", fmt.Errorf("invalid SSH public key: %w", err)
+	}
+
+	return sshKey.Type(), ssh.FingerprintSHA256(sshKey), nil
+}
+
 // IsPrivateKey checks if a string looks like an age private key
 func IsPrivateKey(key string) bool {
 	key = strings.TrimSpace(key)
 
 	return strings.HasPrefix(key, "AGE-SECRET-KEY-") ||
+		strings.Contains(key, pluginIdentityPrefix) ||
 		strings.Contains(key, "PRIVATE KEY") ||
 		strings.Contains(key, "-----BEGIN") ||
 		strings.Contains(key, "-----END")
@@ -3,6 +3,7 @@ package core
 import (
 	"bytes"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"filippo.io/age"
@@ -267,6 +268,35 @@ func TestValidatePublicKey(t *testing.T) {
 	}
 }
 
+func TestPublicKeyInfo(t *testing.T) {
+	_, agePublicKey, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+
+	keyType, fingerprint, err := PublicKeyInfo(agePublicKey)
+	if err != nil {
+		t.Fatalf("PublicKeyInfo failed for age key: %v", err)
+	}
+
+	if keyType != "age" || !strings.HasPrefix(fingerprint, "SHA256:") {
+		t.Errorf("Unexpected age key info: %s %s", keyType, fingerprint)
+	}
+
+	keyType, fingerprint, err = PublicKeyInfo(generateTestSSHPublicKey(t))
+	if err != nil {
+		t.Fatalf("PublicKeyInfo failed for SSH key: %v", err)
+	}
+
+	if keyType != "ssh-ed25519" || !strings.HasPrefix(fingerprint, "SHA256:") {
+		t.Errorf("Unexpected SSH key info: %s %s", keyType, fingerprint)
+	}
+
+	if _, _, err := PublicKeyInfo("not-a-key"); err == nil {
+		t.Error("Expected error for invalid key")
+	}
+}
+
 func TestIsPrivateKey(t *testing.T) {
 	privateKey, publicKey := generateTestKeyPair(t)
 	defer WipeData(privateKey)
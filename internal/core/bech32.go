@@ -0,0 +1,111 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// bech32Charset maps 5-bit values to the characters of the bech32 alphabet
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// bech32Decode decodes an age key such as "age1..." or "AGE-SECRET-KEY-1..." into its
+// human-readable part and data, verifying the checksum. age keys may exceed the 90 character
+// limit of BIP 173, so no length limit is applied.
+func bech32Decode(encoded string) (string, []byte, error) {
+	if strings.ToLower(encoded) != encoded && strings.ToUpper(encoded) != encoded {
+		return "", nil, fmt.Errorf("mixed case")
+	}
+
+	encoded = strings.ToLower(encoded)
+
+	separator := strings.LastIndexByte(encoded, '1')
+	if separator < 1 || separator+7 > len(encoded) {
+		return "", nil, fmt.Errorf("invalid separator position")
+	}
+
+	hrp := encoded[:separator]
+
+	values := make([]byte, 0, len(encoded)-separator-1)
+
+	for i := separator + 1; i < len(encoded); i++ {
+		value := strings.IndexByte(bech32Charset, encoded[i])
+		if value < 0 {
+			return "", nil, fmt.Errorf("invalid character '%c'", encoded[i])
+		}
+
+		values = append(values, byte(value))
+	}
+
+	if bech32Polymod(append(bech32ExpandHRP(hrp), values...)) != 1 {
+		return "", nil, fmt.Errorf("invalid checksum")
+	}
+
+	data, err := convertBits(values[:len(values)-6], 5, 8)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return hrp, data, nil
+}
+
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+	checksum := uint32(1)
+
+	for _, value := range values {
+		top := checksum >> 25
+		checksum = (checksum&0x1ffffff)<<5 ^ uint32(value)
+
+		for i := range generator {
+			if (top>>i)&1 == 1 {
+				checksum ^= generator[i]
+			}
+		}
+	}
+
+	return checksum
+}
+
+func bech32ExpandHRP(hrp string) []byte {
+	expanded := make([]byte, 0, len(hrp)*2+1)
+
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+
+	expanded = append(expanded, 0)
+
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]&31)
+	}
+
+	return expanded
+}
+
+// convertBits regroups bits from fromBits to toBits wide values, rejecting non-zero padding
+func convertBits(data []byte, fromBits, toBits uint) ([]byte, error) {
+	var (
+		accumulator uint
+		bits        uint
+		out         []byte
+	)
+
+	maxValue := uint(1)<<toBits - 1
+
+	for _, value := range data {
+		accumulator = accumulator<<fromBits | uint(value)
+		bits += fromBits
+
+		for bits >= toBits {
+			bits -= toBits
+			out = append(out, byte(accumulator>>bits&maxValue))
+		}
+	}
+
+	if bits >= fromBits || accumulator<<(toBits-bits)&maxValue != 0 {
+		return nil, fmt.Errorf("invalid padding")
+	}
+
+	return out, nil
+}
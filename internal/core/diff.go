@@ -0,0 +1,57 @@
+package core
+
+import (
+	"bytes"
+	"sort"
+)
+
+// ChangeType describes how a variable differs between two sets of variables
+type ChangeType string
+
+const (
+	// ChangeAdded indicates a variable that only exists in the new set
+	ChangeAdded ChangeType = "added"
+	// ChangeRemoved indicates a variable that only exists in the old set
+	ChangeRemoved ChangeType = "removed"
+	// ChangeModified indicates a variable whose value differs between the sets
+	ChangeModified ChangeType = "changed"
+)
+
+// VarChange describes a single key-level difference. OldValue and NewValue reference
+// the compared maps and are wiped together with them.
+type VarChange struct {
+	Key      string
+	Type     ChangeType
+	OldValue []byte
+	NewValue []byte
+}
+
+// DiffEnvVars compares two sets of variables and returns the key-level changes sorted by key
+func DiffEnvVars(oldVars, newVars map[string][]byte) []VarChange {
+	keys := SortedKeys(oldVars)
+	for key := range newVars {
+		if _, exists := oldVars[key]; !exists {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	var changes []VarChange
+
+	for _, key := range keys {
+		oldValue, inOld := oldVars[key]
+		newValue, inNew := newVars[key]
+
+		switch {
+		case inOld && !inNew:
+			changes = append(changes, VarChange{Key: key, Type: ChangeRemoved, OldValue: oldValue})
+		case !inOld && inNew:
+			changes = append(changes, VarChange{Key: key, Type: ChangeAdded, NewValue: newValue})
+		case !bytes.Equal(oldValue, newValue):
+			changes = append(changes, VarChange{Key: key, Type: ChangeModified, OldValue: oldValue, NewValue: newValue})
+		}
+	}
+
+	return changes
+}
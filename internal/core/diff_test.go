@@ -0,0 +1,40 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffEnvVars(t *testing.T) {
+	oldVars := map[string][]byte{
+		"UNCHANGED": []byte("same"),
+		"REMOVED":   []byte("gone"),
+		"MODIFIED":  []byte("before"),
+	}
+
+	newVars := map[string][]byte{
+		"UNCHANGED": []byte("same"),
+		"MODIFIED":  []byte("after"),
+		"ADDED":     []byte("new"),
+	}
+
+	changes := DiffEnvVars(oldVars, newVars)
+
+	expected := []VarChange{
+		{Key: "ADDED", Type: ChangeAdded, NewValue: []byte("new")},
+		{Key: "MODIFIED", Type: ChangeModified, OldValue: []byte("before"), NewValue: []byte("after")},
+		{Key: "REMOVED", Type: ChangeRemoved, OldValue: []byte("gone")},
+	}
+
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("DiffEnvVars mismatch:\nexpected %+v\ngot      %+v", expected, changes)
+	}
+
+	if changes := DiffEnvVars(oldVars, oldVars); len(changes) != 0 {
+		t.Errorf("Expected no changes for identical sets, got %+v", changes)
+	}
+
+	if changes := DiffEnvVars(nil, map[string][]byte{"A": []byte("1")}); len(changes) != 1 || changes[0].Type != ChangeAdded {
+		t.Errorf("Expected single addition against nil set, got %+v", changes)
+	}
+}
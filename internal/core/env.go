@@ -1,25 +1,193 @@
 package core
 
-import "github.com/joho/godotenv"
+import (
+	"bytes"
+	"fmt"
 
-// ParseEnv parses environment file content
+	"github.com/joho/godotenv"
+)
+
+// envParser reads dotenv content: KEY=value lines with optional export prefixes, comments,
+// and single- or double-quoted values that may span lines
+type envParser struct {
+	src  []byte
+	pos  int
+	line int
+}
+
+// ParseEnv parses environment file content. Values are taken literally: no variable expansion
+// is performed, so ${NAME} references are kept as written. Double-quoted values support \n and
+// \r and backslash escapes; single-quoted values are not unescaped.
 func ParseEnv(data []byte) (map[string][]byte, error) {
-	stringVars, err := godotenv.Unmarshal(string(data))
-	if err != nil {
-		return nil, err
-	}
+	src := bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	defer WipeData(src)
+
+	parser := &envParser{src: src, line: 1}
+	vars := make(map[string][]byte)
+
+	for parser.skipBlank() {
+		key, err := parser.parseKey()
+		if err != nil {
+			return nil, err
+		}
 
-	// Convert to []byte for kiln's secure handling
-	vars := make(map[string][]byte, len(stringVars))
+		value, err := parser.parseValue()
+		if err != nil {
+			return nil, err
+		}
 
-	for key, value := range stringVars {
-		valueBytes := []byte(value)
-		vars[key] = valueBytes
+		vars[key] = value
 	}
 
 	return vars, nil
 }
 
+// skipBlank moves past blank lines and comments, reporting whether a statement follows
+func (p *envParser) skipBlank() bool {
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case '\n':
+			p.line++
+			p.pos++
+		case ' ', '\t', '\r':
+			p.pos++
+		case '#':
+			p.skipLine()
+		default:
+			return true
+		}
+	}
+
+	return false
+}
+
+// skipLine moves to the line break ending the current line
+func (p *envParser) skipLine() {
+	if end := bytes.IndexByte(p.src[p.pos:], '\n'); end >= 0 {
+		p.pos += end
+	} else {
+		p.pos = len(p.src)
+	}
+}
+
+func (p *envParser) skipSpace() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// parseKey reads an optionally exported key and the '=' or ':' following it
+func (p *envParser) parseKey() (string, error) {
+	if rest := p.src[p.pos:]; bytes.HasPrefix(rest, []byte("export")) && len(rest) > 6 && (rest[6] == ' ' || rest[6] == '\t') {
+		p.pos += 6
+		p.skipSpace()
+	}
+
+	start := p.pos
+	for p.pos < len(p.src) && isEnvKeyChar(p.src[p.pos]) {
+		p.pos++
+	}
+
+	key := string(p.src[start:p.pos])
+	p.skipSpace()
+
+	if key == "" || p.pos >= len(p.src) || (p.src[p.pos] != '=' && p.src[p.pos] != ':') {
+		return "", fmt.Errorf("line %d: expected KEY=value", p.line)
+	}
+
+	p.pos++
+	p.skipSpace()
+
+	return key, nil
+}
+
+// parseValue reads a quoted or unquoted value and the rest of its line
+func (p *envParser) parseValue() ([]byte, error) {
+	if p.pos >= len(p.src) || (p.src[p.pos] != '"' && p.src[p.pos] != '\'') {
+		start := p.pos
+		p.skipLine()
+
+		value := p.src[start:p.pos]
+		for i := 1; i < len(value); i++ {
+			if value[i] == '#' && (value[i-1] == ' ' || value[i-1] == '\t') {
+				value = value[:i]
+
+				break
+			}
+		}
+
+		return bytes.Clone(bytes.TrimRight(value, " \t\r")), nil
+	}
+
+	quote := p.src[p.pos]
+	startLine := p.line
+	start := p.pos + 1
+	end := start
+
+	for ; end < len(p.src) && p.src[end] != quote; end++ {
+		switch {
+		case p.src[end] == '\n':
+			p.line++
+		case p.src[end] == '\\' && quote == '"':
+			if end++; end < len(p.src) && p.src[end] == '\n' {
+				p.line++
+			}
+		}
+	}
+
+	if end >= len(p.src) {
+		return nil, fmt.Errorf("line %d: unterminated quoted value", startLine)
+	}
+
+	value := bytes.Clone(p.src[start:end])
+	if quote == '"' {
+		value = unescapeDoubleQuoted(value)
+	}
+
+	p.pos = end + 1
+	p.skipSpace()
+
+	if p.pos < len(p.src) && p.src[p.pos] != '\n' && p.src[p.pos] != '\r' && p.src[p.pos] != '#' {
+		WipeData(value)
+
+		return nil, fmt.Errorf("line %d: unexpected text after quoted value", p.line)
+	}
+
+	p.skipLine()
+
+	return value, nil
+}
+
+// unescapeDoubleQuoted resolves backslash escapes in place: \n and \r become line breaks
+// and any other escaped character stands for itself
+func unescapeDoubleQuoted(value []byte) []byte {
+	out := value[:0]
+
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c == '\\' && i+1 < len(value) {
+			i++
+
+			switch c = value[i]; c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			}
+		}
+
+		out = append(out, c)
+	}
+
+	WipeData(value[len(out):])
+
+	return out
+}
+
+func isEnvKeyChar(c byte) bool {
+	return c == '_' || c == '.' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
 // FormatEnv formats environment variables
 func FormatEnv(vars map[string][]byte) []byte {
 	if len(vars) == 0 {
@@ -41,6 +41,30 @@ func TestParseEnv(t *testing.T) {
 				"SPACE_KEY": []byte("value with spaces"),
 			},
 		},
+		{
+			name:  "references are not expanded",
+			input: "USER=app\nURL=\"postgres://${USER}@db\"\nRAW=$USER\n",
+			expected: map[string][]byte{
+				"USER": []byte("app"),
+				"URL":  []byte("postgres://${USER}@db"),
+				"RAW":  []byte("$USER"),
+			},
+		},
+		{
+			name:  "export prefix, comments and quoting",
+			input: "# comment\nexport A=plain # trailing\nB='single \\n kept'\nC=\"line\\nbreak \\\"quoted\\\"\"\nD=\"multi\nline\"\n",
+			expected: map[string][]byte{
+				"A": []byte("plain"),
+				"B": []byte(`single \n kept`),
+				"C": []byte("line\nbreak \"quoted\""),
+				"D": []byte("multi\nline"),
+			},
+		},
+		{
+			name:        "unterminated quote",
+			input:       "KEY=\"open\n",
+			expectError: true,
+		},
 		{
 			name:        "invalid format",
 			input:       "INVALID_LINE_NO_EQUALS\n",
@@ -91,6 +115,54 @@ func TestParseEnv(t *testing.T) {
 	}
 }
 
+func TestParseEnvNoExpansion(t *testing.T) {
+	// Earlier versions parsed files with godotenv, which expanded ${NAME} and $NAME from the
+	// file and the process environment in unquoted and double-quoted values
+	input := "DB_USER=app\nURL=postgres://${DB_USER}@db\nQUOTED=\"$DB_USER@db\"\nHOME_DIR=${HOME}/data\n"
+
+	t.Setenv("HOME", "/home/kiln")
+
+	parsed, err := ParseEnv([]byte(input))
+	if err != nil {
+		t.Fatalf("ParseEnv failed: %v", err)
+	}
+
+	// They are now read as written
+	literal := map[string]string{
+		"URL":      "postgres://${DB_USER}@db",
+		"QUOTED":   "$DB_USER@db",
+		"HOME_DIR": "${HOME}/data",
+	}
+
+	for key, value := range literal {
+		if got := string(parsed[key]); got != value {
+			t.Errorf("%s: expected %q, got %q", key, value, got)
+		}
+	}
+
+	// With interpolate = true, ${NAME} expands from the file only; $NAME and the process
+	// environment are not used
+	parsed["HOME_DIR"] = []byte("${HOME:-/srv}/data")
+
+	expanded, cleanup, err := InterpolateEnvVars(parsed)
+	if err != nil {
+		t.Fatalf("InterpolateEnvVars failed: %v", err)
+	}
+	defer cleanup()
+
+	interpolated := map[string]string{
+		"URL":      "postgres://app@db",
+		"QUOTED":   "$DB_USER@db",
+		"HOME_DIR": "/srv/data",
+	}
+
+	for key, value := range interpolated {
+		if got := string(expanded[key]); got != value {
+			t.Errorf("%s: expected %q, got %q", key, value, got)
+		}
+	}
+}
+
 func TestFormatEnv(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -121,6 +193,13 @@ func TestFormatEnv(t *testing.T) {
 				"SPECIAL": []byte("value with spaces and symbols!@#"),
 			},
 		},
+		{
+			name: "unexpanded references",
+			input: map[string][]byte{
+				"URL":   []byte("postgres://${DB_USER}:$$pass@${DB_HOST:-localhost}"),
+				"QUOTE": []byte(`it's "quoted" \ and multi` + "\nline"),
+			},
+		},
 	}
 
 	for _, tt := range tests {
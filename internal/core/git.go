@@ -0,0 +1,255 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GitCommit describes a commit that touched a file, along with the file's repository path at that commit
+type GitCommit struct {
+	Hash    string
+	Author  string
+	Date    time.Time
+	Subject string
+	Path    string
+}
+
+// runGit runs the local git binary in dir and returns its standard output.
+// Standard error is folded into the returned error.
+func runGit(dir string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %s", args[0], msg)
+		}
+
+		return nil, fmt.Errorf("git %s: %w", args[0], err)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// Abbrev returns the abbreviated commit hash for display
+func (c GitCommit) Abbrev() string {
+	if len(c.Hash) > 7 {
+		return c.Hash[:7]
+	}
+
+	return c.Hash
+}
+
+// gitCheck verifies that git is available and returns the absolute directory and base name of path
+func gitCheck(path string) (dir, base string, err error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return "", "", fmt.Errorf("git not found in PATH")
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", "", err
+	}
+
+	return filepath.Dir(absPath), filepath.Base(absPath), nil
+}
+
+// ReadFileAtRevision returns the raw content of a file as stored at a git revision.
+// The blob is read into memory and never written to disk. Returns nil data without
+// error when the revision exists but the file does not exist in it.
+func ReadFileAtRevision(path, rev string) ([]byte, error) {
+	dir, base, err := gitCheck(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := runGit(dir, "rev-parse", "--verify", "--quiet", rev+"^{commit}"); err != nil {
+		return nil, fmt.Errorf("unknown git revision '%s'", rev)
+	}
+
+	// Resolve relative to the file's directory so the config can live anywhere in the repository
+	return readBlob(dir, rev+":./"+base)
+}
+
+// ReadFileAtCommit returns the raw content of a repository-relative path at a commit, as reported by
+// FileHistory. Returns nil data without error when the file does not exist at that commit.
+func ReadFileAtCommit(path string, commit GitCommit) ([]byte, error) {
+	dir, _, err := gitCheck(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return readBlob(dir, commit.Hash+":"+commit.Path)
+}
+
+// readBlob reads a git object such as 'HEAD:path', returning nil when it does not exist
+func readBlob(dir, object string) ([]byte, error) {
+	if _, err := runGit(dir, "cat-file", "-e", object); err != nil {
+		return nil, nil
+	}
+
+	return runGit(dir, "cat-file", "blob", object)
+}
+
+// FileHistory returns the commits that touched a file, newest first, following renames
+func FileHistory(path string) ([]GitCommit, error) {
+	dir, base, err := gitCheck(path)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix, err := runGit(dir, "rev-parse", "--show-prefix")
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := runGit(dir, "-c", "core.quotepath=off", "log", "--follow", "--name-only",
+		"--format=%x1e%H%x1f%an%x1f%aI%x1f%s", "--", "./"+base)
+	if err != nil {
+		return nil, err
+	}
+
+	// Merge commits list no paths; they inherit the path of the next newer commit
+	currentPath := strings.TrimSpace(string(prefix)) + base
+
+	var commits []GitCommit
+
+	for _, record := range strings.Split(string(output), "\x1e") {
+		lines := strings.Split(strings.TrimSpace(record), "\n")
+
+		fields := strings.Split(lines[0], "\x1f")
+		if len(fields) != 4 {
+			continue
+		}
+
+		date, err := time.Parse(time.RFC3339, fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("parse commit date '%s': %w", fields[2], err)
+		}
+
+		for _, line := range lines[1:] {
+			if line = strings.TrimSpace(line); line != "" {
+				currentPath = line
+			}
+		}
+
+		commits = append(commits, GitCommit{
+			Hash:    fields[0],
+			Author:  fields[1],
+			Date:    date,
+			Subject: fields[3],
+			Path:    currentPath,
+		})
+	}
+
+	return commits, nil
+}
+
+// GitTopLevel returns the root directory of the git work tree containing path
+func GitTopLevel(path string) (string, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return "", fmt.Errorf("git not found in PATH")
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	output, err := runGit(absPath, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.FromSlash(strings.TrimSpace(string(output))), nil
+}
+
+// SetGitConfig sets a key in the repository-local git configuration of the work tree at root
+func SetGitConfig(root, key, value string) error {
+	_, err := runGit(root, "config", "--local", key, value)
+
+	return err
+}
+
+// EnsureGitAttributes appends lines to the .gitattributes file at root unless an identical
+// line is already present. Returns the lines that were added.
+func EnsureGitAttributes(root string, lines []string) ([]string, error) {
+	attributesPath := filepath.Join(root, ".gitattributes")
+
+	var existing []byte
+
+	if FileExists(attributesPath) {
+		data, err := ReadFile(attributesPath)
+		if err != nil {
+			return nil, err
+		}
+
+		existing = data
+	}
+
+	present := make(map[string]bool)
+	for _, line := range strings.Split(string(existing), "\n") {
+		present[strings.TrimSpace(line)] = true
+	}
+
+	var added []string
+
+	content := bytes.NewBuffer(existing)
+	if len(existing) > 0 && !bytes.HasSuffix(existing, []byte("\n")) {
+		content.WriteByte('\n')
+	}
+
+	for _, line := range lines {
+		if present[line] {
+			continue
+		}
+
+		present[line] = true
+		added = append(added, line)
+
+		content.WriteString(line + "\n")
+	}
+
+	if len(added) == 0 {
+		return nil, nil
+	}
+
+	// .gitattributes is committed and read by everyone, so keep regular permissions
+	//nolint:gosec
+	if err := os.WriteFile(attributesPath, content.Bytes(), 0o644); err != nil {
+		return nil, err
+	}
+
+	return added, nil
+}
+
+// GitAttributesPattern returns a .gitattributes pattern matching exactly the file at path,
+// which must be inside the work tree at root
+func GitAttributesPattern(root, path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	relPath, err := filepath.Rel(root, absPath)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("'%s' is outside the git repository at '%s'", path, root)
+	}
+
+	// A leading slash anchors the pattern to the repository root
+	pattern := "/" + filepath.ToSlash(relPath)
+	if strings.ContainsAny(pattern, " \t\"\\") {
+		pattern = strconv.Quote(pattern)
+	}
+
+	return pattern, nil
+}
@@ -0,0 +1,236 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGetEnvVarsAtRevision(t *testing.T) {
+	tmpDir := createTestDir(t)
+	initTestGitRepo(t, tmpDir)
+
+	keyPath, cfg := setupTestConfig(t, tmpDir)
+
+	identity, err := NewIdentityFromKey(keyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	// File not yet committed at the first revision
+	commitTestGitRepo(t, tmpDir, "initial")
+
+	if err := SaveAllEnvVars(identity, cfg, "default", map[string][]byte{"API_KEY": []byte("v1")}); err != nil {
+		t.Fatalf("SaveAllEnvVars failed: %v", err)
+	}
+
+	commitTestGitRepo(t, tmpDir, "add env")
+
+	if err := SaveAllEnvVars(identity, cfg, "default", map[string][]byte{"API_KEY": []byte("v2")}); err != nil {
+		t.Fatalf("SaveAllEnvVars failed: %v", err)
+	}
+
+	vars, cleanup, err := GetEnvVarsAtRevision(identity, cfg, "default", "HEAD")
+	if err != nil {
+		t.Fatalf("GetEnvVarsAtRevision failed: %v", err)
+	}
+	defer cleanup()
+
+	if string(vars["API_KEY"]) != "v1" {
+		t.Errorf("Expected committed value 'v1', got %q", vars["API_KEY"])
+	}
+
+	vars, cleanup, err = GetEnvVarsAtRevision(identity, cfg, "default", "HEAD~1")
+	if err != nil {
+		t.Fatalf("GetEnvVarsAtRevision for missing file failed: %v", err)
+	}
+	defer cleanup()
+
+	if len(vars) != 0 {
+		t.Errorf("Expected no variables before the file existed, got %d", len(vars))
+	}
+
+	if _, _, err := GetEnvVarsAtRevision(identity, cfg, "default", "does-not-exist"); err == nil {
+		t.Error("GetEnvVarsAtRevision should fail for unknown revision")
+	}
+}
+
+func TestWalkEnvHistory(t *testing.T) {
+	tmpDir := createTestDir(t)
+	initTestGitRepo(t, tmpDir)
+
+	keyPath, cfg := setupTestConfig(t, tmpDir)
+
+	identity, err := NewIdentityFromKey(keyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	revisions := []map[string][]byte{
+		{"API_KEY": []byte("v1"), "DEBUG": []byte("true")},
+		{"API_KEY": []byte("v2"), "DEBUG": []byte("true")},
+		{"API_KEY": []byte("v2")},
+	}
+
+	for i, vars := range revisions {
+		if err := SaveAllEnvVars(identity, cfg, "default", vars); err != nil {
+			t.Fatalf("SaveAllEnvVars failed: %v", err)
+		}
+
+		commitTestGitRepo(t, tmpDir, fmt.Sprintf("revision %d", i))
+	}
+
+	var subjects []string
+
+	var changes [][]VarChange
+
+	err = WalkEnvHistory(identity, cfg, "default", func(entry HistoryEntry) error {
+		if entry.Err != nil {
+			t.Errorf("Unexpected decryption error at %s: %v", entry.Commit.Abbrev(), entry.Err)
+		}
+
+		subjects = append(subjects, entry.Commit.Subject)
+		changes = append(changes, entry.Changes)
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkEnvHistory failed: %v", err)
+	}
+
+	expectedSubjects := []string{"revision 0", "revision 1", "revision 2"}
+	if !reflect.DeepEqual(subjects, expectedSubjects) {
+		t.Fatalf("Expected commits %v, got %v", expectedSubjects, subjects)
+	}
+
+	if len(changes[0]) != 2 || changes[0][0].Type != ChangeAdded {
+		t.Errorf("First revision should add two variables, got %+v", changes[0])
+	}
+
+	if len(changes[1]) != 1 || changes[1][0].Key != "API_KEY" || changes[1][0].Type != ChangeModified {
+		t.Errorf("Second revision should change API_KEY, got %+v", changes[1])
+	}
+
+	if len(changes[2]) != 1 || changes[2][0].Key != "DEBUG" || changes[2][0].Type != ChangeRemoved {
+		t.Errorf("Third revision should remove DEBUG, got %+v", changes[2])
+	}
+}
+
+func TestEnsureGitAttributes(t *testing.T) {
+	tmpDir := createTestDir(t)
+	writeTestFile(t, tmpDir, ".gitattributes", []byte("*.png binary"))
+
+	lines := []string{"/.kiln.env merge=kiln", "/envs/prod.env merge=kiln"}
+
+	added, err := EnsureGitAttributes(tmpDir, lines)
+	if err != nil {
+		t.Fatalf("EnsureGitAttributes failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(added, lines) {
+		t.Errorf("Expected %v to be added, got %v", lines, added)
+	}
+
+	// Running again is a no-op
+	added, err = EnsureGitAttributes(tmpDir, lines)
+	if err != nil {
+		t.Fatalf("EnsureGitAttributes failed: %v", err)
+	}
+
+	if len(added) != 0 {
+		t.Errorf("Expected nothing to be added on second run, got %v", added)
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, ".gitattributes"))
+	if err != nil {
+		t.Fatalf("Failed to read .gitattributes: %v", err)
+	}
+
+	expected := "*.png binary\n/.kiln.env merge=kiln\n/envs/prod.env merge=kiln\n"
+	if string(content) != expected {
+		t.Errorf("Expected .gitattributes %q, got %q", expected, content)
+	}
+}
+
+func TestGitAttributesPattern(t *testing.T) {
+	root := createTestDir(t)
+
+	tests := []struct {
+		path     string
+		expected string
+		wantErr  bool
+	}{
+		{filepath.Join(root, ".kiln.env"), "/.kiln.env", false},
+		{filepath.Join(root, "envs", "prod.env"), "/envs/prod.env", false},
+		{filepath.Join(root, "my envs", "prod.env"), `"/my envs/prod.env"`, false},
+		{filepath.Join(filepath.Dir(root), "outside.env"), "", true},
+	}
+
+	for _, tt := range tests {
+		pattern, err := GitAttributesPattern(root, tt.path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("GitAttributesPattern(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+
+			continue
+		}
+
+		if pattern != tt.expected {
+			t.Errorf("GitAttributesPattern(%q) = %q, expected %q", tt.path, pattern, tt.expected)
+		}
+	}
+}
+
+func TestIsValidGitRevision(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"HEAD", true},
+		{"HEAD~1", true},
+		{"origin/main", true},
+		{"a1b2c3d", true},
+		{"", false},
+		{"--output=/tmp/x", false},
+		{"HEAD 1", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsValidGitRevision(tt.input); got != tt.want {
+			t.Errorf("IsValidGitRevision(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+// initTestGitRepo creates a git repository in dir, skipping the test when git is unavailable
+func initTestGitRepo(t *testing.T, dir string) {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	runTestGit(t, dir, "init", "-q")
+	runTestGit(t, dir, "config", "user.email", "test@example.com")
+	runTestGit(t, dir, "config", "user.name", "test")
+	runTestGit(t, dir, "config", "commit.gpgsign", "false")
+}
+
+// commitTestGitRepo stages everything in dir and commits it
+func commitTestGitRepo(t *testing.T, dir, message string) {
+	t.Helper()
+
+	runTestGit(t, dir, "add", "-A")
+	runTestGit(t, dir, "commit", "-q", "--allow-empty", "-m", message)
+}
+
+func runTestGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+
+	cmd := exec.Command("git", append([]string{"-C", filepath.Clean(dir)}, args...)...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v failed: %v\n%s", args, err, output)
+	}
+}
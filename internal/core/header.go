@@ -0,0 +1,210 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"filippo.io/age/armor"
+	"golang.org/x/crypto/ssh"
+)
+
+// ageHeaderVersion is the first line of every binary age file
+const ageHeaderVersion = "age-encryption.org/v1"
+
+// pluginStanza stands for the stanza of a plugin recipient in ExpectedHeaderRecipients. Plugins
+// choose their own stanza types, so it matches any one stanza not claimed by another recipient.
+const pluginStanza = "*"
+
+// HeaderRecipients lists the recipient stanzas in the header of an age file without decrypting it.
+// SSH stanzas carry a tag derived from the recipient's public key and are reported as
+// "ssh-ed25519 <tag>"; X25519 stanzas do not identify their recipient and are reported by type only.
+// The recipient manifest is not a recipient and is left out. The result is sorted.
+func HeaderRecipients(encryptedData []byte) ([]string, error) {
+	stanzas, _, err := readHeader(encryptedData)
+
+	return stanzas, err
+}
+
+// HeaderManifest returns the recipient fingerprints recorded in the manifest stanza of an age
+// file, sorted, or nil if the file was written without one.
+func HeaderManifest(encryptedData []byte) ([]string, error) {
+	_, manifest, err := readHeader(encryptedData)
+
+	return manifest, err
+}
+
+// readHeader reads the recipient stanzas and the manifest from the header of an age file
+func readHeader(encryptedData []byte) ([]string, []string, error) {
+	reader := bufio.NewReader(bytes.NewReader(encryptedData))
+
+	if IsArmored(encryptedData) {
+		reader = bufio.NewReader(armor.NewReader(bytes.NewReader(encryptedData)))
+	}
+
+	version, err := reader.ReadString('\n')
+	if err != nil || strings.TrimSuffix(version, "\n") != ageHeaderVersion {
+		return nil, nil, fmt.Errorf("not an age encrypted file")
+	}
+
+	var stanzas, manifest []string
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				return nil, nil, fmt.Errorf("truncated age header")
+			}
+
+			return nil, nil, err
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+
+		if strings.HasPrefix(line, "--- ") {
+			break
+		}
+
+		if !strings.HasPrefix(line, "-> ") {
+			// Stanza body line
+			continue
+		}
+
+		fields := strings.Fields(strings.TrimPrefix(line, "-> "))
+		if len(fields) == 0 {
+			return nil, nil, fmt.Errorf("malformed age header stanza")
+		}
+
+		if fields[0] == manifestStanzaType {
+			if manifest != nil {
+				return nil, nil, fmt.Errorf("duplicate recipient manifest")
+			}
+
+			manifest = slices.Sorted(slices.Values(fields[1:]))
+
+			continue
+		}
+
+		stanzas = append(stanzas, stanzaIdentifier(fields[0], fields[1:]))
+	}
+
+	slices.Sort(stanzas)
+
+	return stanzas, manifest, nil
+}
+
+// ExpectedHeaderRecipients returns the header identifiers that encrypting to publicKeys would
+// produce, in the same form and order as HeaderRecipients.
+func ExpectedHeaderRecipients(publicKeys []string) ([]string, error) {
+	stanzas := make([]string, 0, len(publicKeys))
+
+	for _, key := range publicKeys {
+		key = strings.TrimSpace(key)
+
+		switch {
+		case key == "":
+			continue
+		case isPluginRecipient(key):
+			stanzas = append(stanzas, pluginStanza)
+		case strings.HasPrefix(key, "age1"):
+			stanzas = append(stanzas, "X25519")
+		default:
+			publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key))
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse key %s: %w", key, err)
+			}
+
+			stanzas = append(stanzas, stanzaIdentifier(publicKey.Type(), []string{sshKeyTag(publicKey)}))
+		}
+	}
+
+	slices.Sort(stanzas)
+
+	return stanzas, nil
+}
+
+// IsArmored reports whether encrypted data is ASCII-armored rather than binary age output.
+// Leading whitespace is ignored, as it is when decrypting.
+func IsArmored(encryptedData []byte) bool {
+	return bytes.HasPrefix(bytes.TrimLeft(encryptedData, " \t\r\n"), []byte(armor.Header))
+}
+
+// RecipientsMatch reports whether the header of encrypted data shows it is encrypted for exactly
+// publicKeys. SSH stanzas are matched by key tag. X25519 and plugin stanzas do not identify their
+// recipient, so they only match when the file has a recipient manifest listing publicKeys;
+// without one, a file with such recipients is reported as not matching.
+func RecipientsMatch(encryptedData []byte, publicKeys []string) (bool, error) {
+	actual, manifest, err := readHeader(encryptedData)
+	if err != nil {
+		return false, err
+	}
+
+	expected, err := ExpectedHeaderRecipients(publicKeys)
+	if err != nil {
+		return false, err
+	}
+
+	if !stanzasMatch(actual, expected) {
+		return false, nil
+	}
+
+	if manifest == nil {
+		// Only SSH stanzas, which carry a key tag, can be told apart without a manifest
+		return !slices.ContainsFunc(expected, func(stanza string) bool {
+			return stanza == "X25519" || stanza == pluginStanza
+		}), nil
+	}
+
+	fingerprints, err := RecipientFingerprints(publicKeys)
+	if err != nil {
+		return false, err
+	}
+
+	return slices.Equal(manifest, fingerprints), nil
+}
+
+// stanzasMatch reports whether the header identifiers actual fit the identifiers expected, both
+// sorted, counting each plugin stanza expected as a match for any one remaining stanza
+func stanzasMatch(actual, expected []string) bool {
+	actual = slices.Clone(actual)
+	plugins := 0
+
+	for _, stanza := range expected {
+		if stanza == pluginStanza {
+			plugins++
+
+			continue
+		}
+
+		index := slices.Index(actual, stanza)
+		if index < 0 {
+			return false
+		}
+
+		actual = slices.Delete(actual, index, index+1)
+	}
+
+	return len(actual) == plugins
+}
+
+// stanzaIdentifier describes a recipient stanza by type, plus the key tag for SSH stanzas
+func stanzaIdentifier(stanzaType string, args []string) string {
+	if (stanzaType == "ssh-ed25519" || stanzaType == "ssh-rsa") && len(args) > 0 {
+		return stanzaType + " " + args[0]
+	}
+
+	return stanzaType
+}
+
+// sshKeyTag computes the tag age writes in SSH stanzas: the first four bytes of the
+// SHA-256 of the public key in wire format
+func sshKeyTag(publicKey ssh.PublicKey) string {
+	hash := sha256.Sum256(publicKey.Marshal())
+
+	return base64.RawStdEncoding.EncodeToString(hash[:4])
+}
@@ -0,0 +1,124 @@
+package core
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestRecipientsMatch(t *testing.T) {
+	_, ageKey1, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+
+	_, ageKey2, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+
+	sshKey1 := generateTestSSHPublicKey(t)
+	sshKey2 := generateTestSSHPublicKey(t)
+
+	encrypted := encryptForTest(t, []string{ageKey1, sshKey1})
+
+	stanzas, err := HeaderRecipients(encrypted)
+	if err != nil {
+		t.Fatalf("HeaderRecipients failed: %v", err)
+	}
+
+	if len(stanzas) != 2 || stanzas[0] != "X25519" || !strings.HasPrefix(stanzas[1], "ssh-ed25519 ") {
+		t.Errorf("Unexpected header recipients: %v", stanzas)
+	}
+
+	expected, err := ExpectedHeaderRecipients([]string{sshKey1, ageKey1})
+	if err != nil {
+		t.Fatalf("ExpectedHeaderRecipients failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(stanzas, expected) {
+		t.Errorf("Expected %v, got %v", expected, stanzas)
+	}
+
+	recipients, err := parseManifestRecipients([]string{ageKey1, sshKey1})
+	if err != nil {
+		t.Fatalf("parseManifestRecipients failed: %v", err)
+	}
+
+	withManifest, err := NewAgeManager(recipients, nil).Encrypt([]byte("KEY=value"))
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+
+	sshOnly := encryptForTest(t, []string{sshKey1})
+
+	tests := []struct {
+		name      string
+		encrypted []byte
+		keys      []string
+		expected  bool
+	}{
+		{"same recipients", withManifest, []string{ageKey1, sshKey1}, true},
+		{"different ssh key", withManifest, []string{ageKey1, sshKey2}, false},
+		{"recipient added", withManifest, []string{ageKey1, ageKey2, sshKey1}, false},
+		{"recipient removed", withManifest, []string{sshKey1}, false},
+		{"swapped age key", withManifest, []string{ageKey2, sshKey1}, false},
+		// Without a manifest, X25519 stanzas do not identify their recipient, so they never match
+		{"same recipients without manifest", encrypted, []string{ageKey1, sshKey1}, false},
+		{"ssh recipients without manifest", sshOnly, []string{sshKey1}, true},
+		{"different ssh key without manifest", sshOnly, []string{sshKey2}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, err := RecipientsMatch(tt.encrypted, tt.keys)
+			if err != nil {
+				t.Fatalf("RecipientsMatch failed: %v", err)
+			}
+
+			if match != tt.expected {
+				t.Errorf("RecipientsMatch() = %v, expected %v", match, tt.expected)
+			}
+		})
+	}
+
+	if _, err := HeaderRecipients([]byte("KEY=value\n")); err == nil {
+		t.Error("Expected error for data that is not age encrypted")
+	}
+}
+
+func encryptForTest(t *testing.T, publicKeys []string) []byte {
+	t.Helper()
+
+	recipients, err := ParseRecipients(publicKeys)
+	if err != nil {
+		t.Fatalf("ParseRecipients failed: %v", err)
+	}
+
+	encrypted, err := NewAgeManager(recipients, nil).Encrypt([]byte("KEY=value"))
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+
+	return encrypted
+}
+
+func generateTestSSHPublicKey(t *testing.T) string {
+	t.Helper()
+
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ed25519 key: %v", err)
+	}
+
+	sshKey, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		t.Fatalf("Failed to convert SSH public key: %v", err)
+	}
+
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshKey)))
+}
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/thunderbottom/kiln/internal/config"
+	kerrors "github.com/thunderbottom/kiln/internal/errors"
+)
+
+// HistoryEntry describes the key-level changes a commit made to an environment file.
+// Err is set when the revision could not be decrypted; its changes are then unknown and
+// the next readable revision is compared against the last readable one.
+type HistoryEntry struct {
+	Commit  GitCommit
+	Changes []VarChange
+	Err     error
+}
+
+// WalkEnvHistory walks the git history of an environment file from oldest to newest commit,
+// decrypting each revision with the given identity and calling fn with the changes relative to
+// the previous readable revision. Change values are only valid for the duration of the call.
+func WalkEnvHistory(identity *Identity, cfg *config.Config, fileName string, fn func(HistoryEntry) error) error {
+	filePath, err := cfg.GetEnvFile(fileName)
+	if err != nil {
+		return kerrors.ConfigError(fmt.Sprintf("file '%s' not configured", fileName), "check kiln.toml file definitions")
+	}
+
+	commits, err := FileHistory(filePath)
+	if err != nil {
+		return kerrors.OperationError("read history of", fmt.Sprintf("'%s'", fileName), err)
+	}
+
+	previous := make(map[string][]byte)
+	previousCleanup := func() {}
+
+	defer func() { previousCleanup() }()
+
+	for i := len(commits) - 1; i >= 0; i-- {
+		commit := commits[i]
+
+		current, cleanup, err := readEnvVarsAtCommit(identity, filePath, commit)
+		if err != nil {
+			if err := fn(HistoryEntry{Commit: commit, Err: err}); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err := fn(HistoryEntry{Commit: commit, Changes: DiffEnvVars(previous, current)}); err != nil {
+			cleanup()
+
+			return err
+		}
+
+		previousCleanup()
+		previous, previousCleanup = current, cleanup
+	}
+
+	return nil
+}
+
+// readEnvVarsAtCommit decrypts a file's content at a commit, treating a missing file as empty
+func readEnvVarsAtCommit(identity *Identity, filePath string, commit GitCommit) (map[string][]byte, func(), error) {
+	encryptedData, err := ReadFileAtCommit(filePath, commit)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if encryptedData == nil {
+		return make(map[string][]byte), func() {}, nil
+	}
+
+	variables, cleanup, _, err := decryptEnvVars(identity, commit.Path+"@"+commit.Abbrev(), encryptedData)
+
+	return variables, cleanup, err
+}
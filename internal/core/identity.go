@@ -1,6 +1,9 @@
 package core
 
 import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rsa"
 	"errors"
 	"fmt"
 	"os"
@@ -9,6 +12,7 @@ import (
 
 	"filippo.io/age"
 	"filippo.io/age/agessh"
+	"filippo.io/age/plugin"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/term"
 )
@@ -18,6 +22,8 @@ type Identity struct {
 	ageIdentity age.Identity
 	publicKey   string
 	keyType     string
+	// signer signs files written with this identity; nil for keys that cannot sign
+	signer messageSigner
 }
 
 // NewIdentityFromKey creates an identity from a private key file path
@@ -35,6 +41,11 @@ func NewIdentityFromKey(keyPath string) (*Identity, error) {
 		return newAgeIdentity(keyContent)
 	}
 
+	// Try age plugin identity, such as a hardware key
+	if line, found := pluginIdentityLine(keyContent); found {
+		return newPluginIdentity(line, keyContent)
+	}
+
 	// Try SSH key
 	if isSSHKey(keyContent) {
 		return newSSHIdentity(keyPath, privateKey)
@@ -60,11 +71,20 @@ func (i *Identity) KeyType() string {
 	return i.keyType
 }
 
+// CanSign reports whether files written with this identity can be signed
+func (i *Identity) CanSign() bool {
+	return i.signer != nil
+}
+
 // Cleanup securely wipes sensitive data if needed
 func (i *Identity) Cleanup() {
 	if wrapper, ok := i.ageIdentity.(*encryptedSSHIdentityWrapper); ok {
 		wrapper.Cleanup()
 	}
+
+	if key, ok := i.signer.(*xeddsaKey); ok {
+		key.wipe()
+	}
 }
 
 // newAgeIdentity creates identity from age private key
@@ -74,10 +94,36 @@ func newAgeIdentity(keyContent string) (*Identity, error) {
 		return nil, fmt.Errorf("parse age identity: %w", err)
 	}
 
+	signer, err := newXEdDSAKey(keyContent)
+	if err != nil {
+		return nil, fmt.Errorf("parse age identity: %w", err)
+	}
+
 	return &Identity{
 		ageIdentity: identity,
 		publicKey:   identity.Recipient().String(),
 		keyType:     "age",
+		signer:      signer,
+	}, nil
+}
+
+// newPluginIdentity creates identity from an age plugin identity line. Decryption runs the
+// age-plugin-<name> binary from PATH, which may prompt through pluginUI.
+func newPluginIdentity(line, keyContent string) (*Identity, error) {
+	identity, err := plugin.NewIdentity(line, pluginUI)
+	if err != nil {
+		return nil, fmt.Errorf("parse plugin identity: %w", err)
+	}
+
+	publicKey, err := pluginIdentityRecipient(keyContent)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Identity{
+		ageIdentity: identity,
+		publicKey:   publicKey,
+		keyType:     "age-plugin-" + identity.Name(),
 	}, nil
 }
 
@@ -91,10 +137,16 @@ func newSSHIdentity(keyPath string, privateKey []byte) (*Identity, error) {
 			return nil, fmt.Errorf("load SSH public key: %w", pubErr)
 		}
 
+		signer, signerErr := ssh.ParsePrivateKey(privateKey)
+		if signerErr != nil {
+			return nil, fmt.Errorf("parse SSH identity: %w", signerErr)
+		}
+
 		return &Identity{
 			ageIdentity: identity,
 			publicKey:   publicKey,
 			keyType:     "ssh",
+			signer:      &sshsigSigner{signer: signer},
 		}, nil
 	}
 
@@ -112,6 +164,7 @@ func newSSHIdentity(keyPath string, privateKey []byte) (*Identity, error) {
 			ageIdentity: wrapper,
 			publicKey:   publicKey,
 			keyType:     "encrypted-ssh",
+			signer:      wrapper,
 		}, nil
 	}
 
@@ -141,42 +194,91 @@ func isSSHKey(content string) bool {
 			strings.Contains(content, "OPENSSH PRIVATE KEY-----"))
 }
 
-// encryptedSSHIdentityWrapper handles encrypted SSH keys with deferred decryption
+// encryptedSSHIdentityWrapper handles encrypted SSH keys with deferred decryption. The
+// passphrase is asked for once, the first time the key decrypts or signs.
 type encryptedSSHIdentityWrapper struct {
 	keyData  []byte
 	pubKey   ssh.PublicKey
 	identity age.Identity
+	signer   ssh.Signer
 }
 
 // Unwrap implements age.Identity interface for encrypted SSH keys
 func (w *encryptedSSHIdentityWrapper) Unwrap(stanzas []*age.Stanza) ([]byte, error) {
-	if w.identity == nil {
-		passphraseFunc := func() ([]byte, error) {
-			fmt.Print("Enter passphrase for SSH private key: ")
+	if err := w.unlock(); err != nil {
+		return nil, err
+	}
+
+	result, err := w.identity.Unwrap(stanzas)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap SSH identity: %w", err)
+	}
 
-			// Convert to int since syscall.Stdin is not int on Windows
-			//nolint:unconvert
-			passphrase, err := term.ReadPassword(int(syscall.Stdin))
+	return result, nil
+}
 
-			fmt.Println()
+// sign implements messageSigner for encrypted SSH keys
+func (w *encryptedSSHIdentityWrapper) sign(message []byte) ([]byte, error) {
+	if err := w.unlock(); err != nil {
+		return nil, err
+	}
 
-			return passphrase, err
-		}
+	return sshsigSign(w.signer, message)
+}
 
-		identity, err := agessh.NewEncryptedSSHIdentity(w.pubKey, w.keyData, passphraseFunc)
-		if err != nil {
-			return nil, fmt.Errorf("create encrypted SSH identity: %w", err)
-		}
+// unlock decrypts the private key with a passphrase read from the terminal
+func (w *encryptedSSHIdentityWrapper) unlock() error {
+	if w.identity != nil {
+		return nil
+	}
+
+	fmt.Print("Enter passphrase for SSH private key: ")
+
+	// Convert to int since syscall.Stdin is not int on Windows
+	//nolint:unconvert
+	passphrase, err := term.ReadPassword(int(syscall.Stdin))
 
-		w.identity = identity
+	fmt.Println()
+
+	if err != nil {
+		return fmt.Errorf("read passphrase: %w", err)
 	}
+	defer WipeData(passphrase)
 
-	result, err := w.identity.Unwrap(stanzas)
+	key, err := ssh.ParseRawPrivateKeyWithPassphrase(w.keyData, passphrase)
 	if err != nil {
-		return nil, fmt.Errorf("unwrap SSH identity: %w", err)
+		return fmt.Errorf("create encrypted SSH identity: %w", err)
 	}
 
-	return result, nil
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return fmt.Errorf("create encrypted SSH identity: %w", err)
+	}
+
+	if !bytes.Equal(signer.PublicKey().Marshal(), w.pubKey.Marshal()) {
+		return fmt.Errorf("create encrypted SSH identity: decrypted key does not match public key")
+	}
+
+	var identity age.Identity
+
+	switch k := key.(type) {
+	case *ed25519.PrivateKey:
+		identity, err = agessh.NewEd25519Identity(*k)
+	case ed25519.PrivateKey:
+		identity, err = agessh.NewEd25519Identity(k)
+	case *rsa.PrivateKey:
+		identity, err = agessh.NewRSAIdentity(k)
+	default:
+		err = fmt.Errorf("unsupported SSH key type %T", key)
+	}
+
+	if err != nil {
+		return fmt.Errorf("create encrypted SSH identity: %w", err)
+	}
+
+	w.identity, w.signer = identity, signer
+
+	return nil
 }
 
 // Cleanup wipes sensitive key data from memory
@@ -187,4 +289,5 @@ func (w *encryptedSSHIdentityWrapper) Cleanup() {
 	}
 
 	w.identity = nil
+	w.signer = nil
 }
@@ -0,0 +1,156 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// interpolationPattern matches $$, ${NAME} and ${NAME:-default} in a value, and ${file:KEY}
+// references, which are left for resolveReferences
+var interpolationPattern = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-[^}]*)?\}|` + referencePattern.String())
+
+// interpolator expands values, caching each expanded variable so it is built once
+type interpolator struct {
+	variables map[string][]byte
+	expanded  map[string][]byte
+	created   [][]byte
+	// keepEscapes writes every literal $ in the result as $$, so that references are the only
+	// other use of $ and can be told apart from escaped text when they are resolved
+	keepEscapes bool
+}
+
+// InterpolateEnvVars expands ${NAME} in values with the value of NAME from the same variables,
+// and ${NAME:-default} with default when NAME is unset or empty; $$ stands for a literal $.
+// ${file:KEY} references to other files are kept as written.
+// The process environment is never consulted, so the result depends only on the input.
+// Returns an error for a reference to an unset variable without a default, or for references
+// that form a cycle. The input map is not modified; the returned cleanup wipes the values
+// created by expansion.
+func InterpolateEnvVars(variables map[string][]byte) (map[string][]byte, func(), error) {
+	return interpolateEnvVars(variables, false)
+}
+
+// interpolateEnvVars expands variables as InterpolateEnvVars does. With keepEscapes, literal $
+// in the results stay escaped as $$ so ${file:KEY} references, which are kept as written, can
+// be resolved in one pass with the escapes, and $${file:KEY} stays literal.
+func interpolateEnvVars(variables map[string][]byte, keepEscapes bool) (map[string][]byte, func(), error) {
+	interp := &interpolator{
+		variables:   variables,
+		expanded:    make(map[string][]byte, len(variables)),
+		keepEscapes: keepEscapes,
+	}
+
+	for _, key := range SortedKeys(variables) {
+		if _, err := interp.expand(key, nil); err != nil {
+			interp.cleanup()
+
+			return nil, nil, err
+		}
+	}
+
+	return interp.expanded, interp.cleanup, nil
+}
+
+// expand returns the expanded value of key. path holds the variables being expanded,
+// outermost first, and is used to detect and report cycles.
+func (i *interpolator) expand(key string, path []string) ([]byte, error) {
+	if expanded, exists := i.expanded[key]; exists {
+		return expanded, nil
+	}
+
+	if start := slices.Index(path, key); start >= 0 {
+		cycle := append(slices.Clone(path[start:]), key)
+
+		return nil, fmt.Errorf("interpolation cycle: %s", strings.Join(cycle, " -> "))
+	}
+
+	value := i.variables[key]
+
+	matches := interpolationPattern.FindAllSubmatchIndex(value, -1)
+	if len(matches) == 0 && (!i.keepEscapes || !slices.Contains(value, '$')) {
+		i.expanded[key] = value
+
+		return value, nil
+	}
+
+	path = append(path, key)
+	result := make([]byte, 0, len(value))
+	last := 0
+
+	for _, match := range matches {
+		result = i.appendLiteral(result, value[last:match[0]])
+		last = match[1]
+
+		switch {
+		case match[6] >= 0:
+			result = append(result, value[match[0]:match[1]]...)
+
+			continue
+		case match[2] < 0:
+			result = i.appendLiteral(result, []byte("$"))
+
+			continue
+		}
+
+		name := string(value[match[2]:match[3]])
+		hasDefault := match[4] >= 0
+
+		if _, exists := i.variables[name]; !exists {
+			if !hasDefault {
+				WipeData(result)
+
+				return nil, fmt.Errorf("'%s' references '%s', which is not set", key, name)
+			}
+
+			result = i.appendLiteral(result, value[match[4]+2:match[5]])
+
+			continue
+		}
+
+		expanded, err := i.expand(name, path)
+		if err != nil {
+			WipeData(result)
+
+			return nil, err
+		}
+
+		if len(expanded) == 0 && hasDefault {
+			result = i.appendLiteral(result, value[match[4]+2:match[5]])
+
+			continue
+		}
+
+		result = append(result, expanded...)
+	}
+
+	result = i.appendLiteral(result, value[last:])
+	i.expanded[key] = result
+	i.created = append(i.created, result)
+
+	return result, nil
+}
+
+// appendLiteral appends text taken as written, escaping each $ in it when escapes are kept
+func (i *interpolator) appendLiteral(result, text []byte) []byte {
+	if !i.keepEscapes {
+		return append(result, text...)
+	}
+
+	for _, c := range text {
+		if c == '$' {
+			result = append(result, '$')
+		}
+
+		result = append(result, c)
+	}
+
+	return result
+}
+
+func (i *interpolator) cleanup() {
+	for _, value := range i.created {
+		WipeData(value)
+	}
+}
@@ -127,6 +127,10 @@ func extractFromEncryptedPrivateKey(content string) (string, error) {
 
 // extractFromUnencryptedPrivateKey handles unencrypted private keys
 func extractFromUnencryptedPrivateKey(content string) (string, error) {
+	if _, found := pluginIdentityLine(content); found {
+		return pluginIdentityRecipient(content)
+	}
+
 	identity, err := age.ParseX25519Identity(content)
 	if err != nil {
 		return "", fmt.Errorf("invalid private key format: %w", err)
@@ -324,6 +328,12 @@ func checkAgeKeyMatch(keyPath string, publicKeys []string) bool {
 	}
 	defer WipeData(privateKey)
 
+	if _, found := pluginIdentityLine(string(privateKey)); found {
+		recipient, err := pluginIdentityRecipient(string(privateKey))
+
+		return err == nil && slices.Contains(publicKeys, recipient)
+	}
+
 	if !strings.HasPrefix(strings.TrimSpace(string(privateKey)), "AGE-SECRET-KEY-") {
 		return false
 	}
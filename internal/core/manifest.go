@@ -0,0 +1,166 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+
+	"filippo.io/age"
+
+	"github.com/thunderbottom/kiln/internal/config"
+	kerrors "github.com/thunderbottom/kiln/internal/errors"
+)
+
+// manifestStanzaType is the type of the age header stanza that lists the fingerprints of the
+// recipients a file was encrypted for. Identities skip stanza types they do not know, and the
+// header MAC covers it like any other stanza, so it cannot be changed without the file key.
+const manifestStanzaType = "kiln-manifest"
+
+// manifestRecipient records the recipient manifest in the header of the files it encrypts.
+// It wraps nothing, so it grants no access.
+type manifestRecipient struct {
+	fingerprints []string
+}
+
+func (r *manifestRecipient) Wrap([]byte) ([]*age.Stanza, error) {
+	return []*age.Stanza{{Type: manifestStanzaType, Args: slices.Clone(r.fingerprints)}}, nil
+}
+
+// parseManifestRecipients parses publicKeys like ParseRecipients and adds a recipient that
+// records their manifest
+func parseManifestRecipients(publicKeys []string) ([]age.Recipient, error) {
+	recipients, err := ParseRecipients(publicKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprints, err := RecipientFingerprints(publicKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(recipients, &manifestRecipient{fingerprints: fingerprints}), nil
+}
+
+// RecipientFingerprints returns the fingerprints of publicKeys as reported by PublicKeyInfo,
+// sorted. Duplicates are kept, as each key gets its own stanza.
+func RecipientFingerprints(publicKeys []string) ([]string, error) {
+	fingerprints := make([]string, 0, len(publicKeys))
+
+	for _, key := range publicKeys {
+		if key == "" {
+			continue
+		}
+
+		_, fingerprint, err := PublicKeyInfo(key)
+		if err != nil {
+			return nil, err
+		}
+
+		fingerprints = append(fingerprints, fingerprint)
+	}
+
+	slices.Sort(fingerprints)
+
+	return fingerprints, nil
+}
+
+// ManifestCheck compares the recipients an encrypted file records in its manifest and header
+// with the recipients its access list resolves to
+type ManifestCheck struct {
+	// Recorded lists the fingerprints in the file's manifest, nil if it has none
+	Recorded []string
+	// Expected lists the fingerprints of the recipients the configuration resolves to
+	Expected []string
+	// Stanzas is the number of recipient stanzas in the file's age header
+	Stanzas int
+	// StanzasMatch reports whether the header stanzas fit the expected recipients, as far as
+	// RecipientsMatch can tell
+	StanzasMatch bool
+}
+
+// Missing returns the expected fingerprints the manifest does not record
+func (m *ManifestCheck) Missing() []string {
+	return subtractFingerprints(m.Expected, m.Recorded)
+}
+
+// Unexpected returns the recorded fingerprints the configuration does not expect
+func (m *ManifestCheck) Unexpected() []string {
+	return subtractFingerprints(m.Recorded, m.Expected)
+}
+
+// Current reports whether the file has a manifest naming exactly the expected recipients, and a
+// header consistent with it
+func (m *ManifestCheck) Current() bool {
+	return m.Recorded != nil && slices.Equal(m.Recorded, m.Expected) && m.Stanzas == len(m.Recorded) && m.StanzasMatch
+}
+
+// subtractFingerprints returns the entries of a not matched by an entry of b
+func subtractFingerprints(a, b []string) []string {
+	b = slices.Clone(b)
+
+	var difference []string
+
+	for _, fingerprint := range a {
+		if index := slices.Index(b, fingerprint); index >= 0 {
+			b = slices.Delete(b, index, index+1)
+
+			continue
+		}
+
+		difference = append(difference, fingerprint)
+	}
+
+	return difference
+}
+
+// CheckFileManifest compares an existing file's recipient manifest and header stanzas with the
+// recipients it resolves to in the configuration, without decrypting it. For values files, the
+// header of the wrapped data key is read and the plaintext recipient list is compared as well.
+func CheckFileManifest(cfg *config.Config, fileName string) (*ManifestCheck, error) {
+	filePath, err := cfg.GetEnvFile(fileName)
+	if err != nil {
+		return nil, kerrors.ConfigError(fmt.Sprintf("file '%s' not configured", fileName), "check kiln.toml file definitions")
+	}
+
+	recipientKeys, err := cfg.ResolveFileAccess(fileName)
+	if err != nil {
+		return nil, kerrors.SecurityError(fmt.Sprintf("access denied for '%s'", fileName), "check file permissions in kiln.toml")
+	}
+
+	encryptedData, err := ReadFile(filePath)
+	if err != nil {
+		return nil, kerrors.FileAccessError("read", fileName, err)
+	}
+
+	check := &ManifestCheck{StanzasMatch: true}
+
+	if IsValuesFormat(encryptedData) {
+		file, err := parseValuesFile(encryptedData)
+		if err != nil {
+			return nil, fmt.Errorf("inspect '%s': %w", fileName, err)
+		}
+
+		check.StanzasMatch = slices.Equal(file.recipients, normalizeRecipients(recipientKeys))
+		encryptedData = file.wrappedKey
+	}
+
+	stanzas, manifest, err := readHeader(encryptedData)
+	if err != nil {
+		return nil, fmt.Errorf("inspect '%s': %w", fileName, err)
+	}
+
+	expectedStanzas, err := ExpectedHeaderRecipients(recipientKeys)
+	if err != nil {
+		return nil, fmt.Errorf("inspect '%s': %w", fileName, err)
+	}
+
+	if check.Expected, err = RecipientFingerprints(recipientKeys); err != nil {
+		return nil, fmt.Errorf("inspect '%s': %w", fileName, err)
+	}
+
+	check.Recorded = manifest
+	check.Stanzas = len(stanzas)
+	check.StanzasMatch = check.StanzasMatch && stanzasMatch(stanzas, expectedStanzas)
+
+	return check, nil
+}
@@ -0,0 +1,147 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/thunderbottom/kiln/internal/config"
+)
+
+func TestCheckFileManifest(t *testing.T) {
+	tmpDir := createTestDir(t)
+	keyPath, cfg := setupTestConfig(t, tmpDir)
+
+	identity, err := NewIdentityFromKey(keyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	cfg.Files["values"] = config.FileConfig{Filename: filepath.Join(tmpDir, "values.env"), Access: []string{"*"}, Format: config.FormatValues}
+
+	for _, fileName := range []string{"default", "values"} {
+		if err := SetEnvVar(identity, cfg, fileName, "KEY", []byte("value")); err != nil {
+			t.Fatalf("SetEnvVar(%s) failed: %v", fileName, err)
+		}
+
+		check, err := CheckFileManifest(cfg, fileName)
+		if err != nil {
+			t.Fatalf("CheckFileManifest(%s) failed: %v", fileName, err)
+		}
+
+		if !check.Current() || len(check.Recorded) != 1 || check.Stanzas != 1 {
+			t.Errorf("Expected freshly written %s to be current, got %+v", fileName, check)
+		}
+	}
+
+	_, otherKey, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+
+	otherFingerprints, err := RecipientFingerprints([]string{otherKey})
+	if err != nil {
+		t.Fatalf("RecipientFingerprints failed: %v", err)
+	}
+
+	// Granting access to another recipient is reported as missing from the manifest
+	cfg.AddRecipient("other-user", otherKey)
+
+	check, err := CheckFileManifest(cfg, "default")
+	if err != nil {
+		t.Fatalf("CheckFileManifest failed: %v", err)
+	}
+
+	if check.Current() || !slices.Equal(check.Missing(), otherFingerprints) || len(check.Unexpected()) != 0 {
+		t.Errorf("Expected other-user to be missing, got %+v", check)
+	}
+
+	// Replacing an age key with another is invisible in the stanzas, but not in the manifest
+	delete(cfg.Recipients, "other-user")
+	cfg.Recipients["test-user"] = otherKey
+
+	check, err = CheckFileManifest(cfg, "default")
+	if err != nil {
+		t.Fatalf("CheckFileManifest failed: %v", err)
+	}
+
+	if check.Current() || !check.StanzasMatch || !slices.Equal(check.Missing(), otherFingerprints) || len(check.Unexpected()) != 1 {
+		t.Errorf("Expected swapped key to be reported, got %+v", check)
+	}
+
+	if current, err := FileRecipientsCurrent(cfg, "default"); err != nil || current {
+		t.Errorf("Expected swapped key to make the file stale, got %v, %v", current, err)
+	}
+}
+
+func TestManifestAuthenticated(t *testing.T) {
+	tmpDir := createTestDir(t)
+	keyPath, cfg := setupTestConfig(t, tmpDir)
+
+	identity, err := NewIdentityFromKey(keyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	if err := SetEnvVar(identity, cfg, "default", "KEY", []byte("value")); err != nil {
+		t.Fatalf("SetEnvVar failed: %v", err)
+	}
+
+	filePath := cfg.Files["default"].Filename
+
+	encrypted, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	manifest, err := HeaderManifest(encrypted)
+	if err != nil || len(manifest) != 1 {
+		t.Fatalf("Expected a manifest with one fingerprint, got %v, %v", manifest, err)
+	}
+
+	_, otherKey, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+
+	otherFingerprints, err := RecipientFingerprints([]string{otherKey})
+	if err != nil {
+		t.Fatalf("RecipientFingerprints failed: %v", err)
+	}
+
+	// Rewriting the manifest without the file key breaks the header MAC
+	tampered := bytes.Replace(encrypted, []byte(manifest[0]), []byte(otherFingerprints[0]), 1)
+	if err := os.WriteFile(filePath, tampered, 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	if _, _, err := GetEnvVar(identity, cfg, "default", "KEY"); err == nil {
+		t.Error("Expected a file with a rewritten manifest to fail decryption")
+	}
+
+	// Files written without a manifest still decrypt, but need rewriting
+	if err := os.WriteFile(filePath, encryptForTest(t, []string{cfg.Recipients["test-user"]}), 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	check, err := CheckFileManifest(cfg, "default")
+	if err != nil {
+		t.Fatalf("CheckFileManifest failed: %v", err)
+	}
+
+	if check.Recorded != nil || check.Current() || !check.StanzasMatch {
+		t.Errorf("Expected a file without a manifest, got %+v", check)
+	}
+
+	if current, err := FileFormatCurrent(cfg, "default"); err != nil || current {
+		t.Errorf("Expected a file without a manifest to need rewriting, got %v, %v", current, err)
+	}
+
+	if _, cleanup, err := GetEnvVar(identity, cfg, "default", "KEY"); err != nil {
+		t.Errorf("Expected a file without a manifest to decrypt, got %v", err)
+	} else {
+		cleanup()
+	}
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/thunderbottom/kiln/internal/config"
+	kerrors "github.com/thunderbottom/kiln/internal/errors"
+)
+
+// MergeEnvVars performs a key-level three-way merge. A key changed on only one side takes
+// that side's value; a key changed identically on both sides is accepted. Keys changed
+// differently on both sides are returned as sorted conflicts and keep the value from ours.
+// Values in the merged map reference the input maps and are wiped together with them.
+func MergeEnvVars(base, ours, theirs map[string][]byte) (map[string][]byte, []string) {
+	keys := make(map[string]bool)
+	for _, variables := range []map[string][]byte{base, ours, theirs} {
+		for key := range variables {
+			keys[key] = true
+		}
+	}
+
+	merged := make(map[string][]byte)
+
+	var conflicts []string
+
+	for key := range keys {
+		baseValue, inBase := base[key]
+		ourValue, inOurs := ours[key]
+		theirValue, inTheirs := theirs[key]
+
+		switch {
+		case sameValue(ourValue, inOurs, theirValue, inTheirs), sameValue(baseValue, inBase, theirValue, inTheirs):
+			if inOurs {
+				merged[key] = ourValue
+			}
+		case sameValue(baseValue, inBase, ourValue, inOurs):
+			if inTheirs {
+				merged[key] = theirValue
+			}
+		default:
+			conflicts = append(conflicts, key)
+
+			if inOurs {
+				merged[key] = ourValue
+			}
+		}
+	}
+
+	sort.Strings(conflicts)
+
+	return merged, conflicts
+}
+
+// MergeEnvFiles merges the encrypted base, ours and theirs versions of a file as handed to
+// a git merge driver. The merged variables are encrypted for the current recipients of
+// fileName and written over oursPath. Returns the conflicting keys, if any; conflicting
+// keys keep the value from ours.
+func MergeEnvFiles(identity *Identity, cfg *config.Config, fileName, basePath, oursPath, theirsPath string) ([]string, error) {
+	if _, err := cfg.GetEnvFile(fileName); err != nil {
+		return nil, kerrors.ConfigError(fmt.Sprintf("file '%s' not configured", fileName), "check kiln.toml file definitions")
+	}
+
+	versions := make([]map[string][]byte, 0, 3)
+
+	for _, version := range []struct{ label, path string }{
+		{"base", basePath},
+		{"ours", oursPath},
+		{"theirs", theirsPath},
+	} {
+		variables, cleanup, err := DecryptSignedEnvFile(identity, cfg, fileName, fmt.Sprintf("%s (%s)", fileName, version.label), version.path)
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+
+		versions = append(versions, variables)
+	}
+
+	merged, conflicts := MergeEnvVars(versions[0], versions[1], versions[2])
+
+	// Ours is the version the merged file replaces, so its ciphertext is kept where it can be
+	ours, err := ReadFile(oursPath)
+	if err != nil {
+		return nil, kerrors.FileAccessError("read", oursPath, err)
+	}
+
+	encryptedData, err := encryptEnvVars(identity, cfg, fileName, merged, ours)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := WriteFile(oursPath, encryptedData); err != nil {
+		return nil, kerrors.FileAccessError("write", oursPath, err)
+	}
+
+	return conflicts, nil
+}
+
+// sameValue reports whether two optional values are both absent or both present and equal
+func sameValue(a []byte, inA bool, b []byte, inB bool) bool {
+	if inA != inB {
+		return false
+	}
+
+	return !inA || bytes.Equal(a, b)
+}
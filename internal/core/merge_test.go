@@ -0,0 +1,184 @@
+package core
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/thunderbottom/kiln/internal/config"
+)
+
+func TestMergeEnvVars(t *testing.T) {
+	base := map[string][]byte{
+		"SHARED":   []byte("base"),
+		"OURS":     []byte("base"),
+		"THEIRS":   []byte("base"),
+		"BOTH":     []byte("base"),
+		"CONFLICT": []byte("base"),
+		"DROPPED":  []byte("base"),
+	}
+	ours := map[string][]byte{
+		"SHARED":   []byte("base"),
+		"OURS":     []byte("ours"),
+		"THEIRS":   []byte("base"),
+		"BOTH":     []byte("same"),
+		"CONFLICT": []byte("ours"),
+		"DROPPED":  []byte("base"),
+		"NEW_OURS": []byte("ours"),
+	}
+	theirs := map[string][]byte{
+		"SHARED":     []byte("base"),
+		"OURS":       []byte("base"),
+		"THEIRS":     []byte("theirs"),
+		"BOTH":       []byte("same"),
+		"CONFLICT":   []byte("theirs"),
+		"NEW_THEIRS": []byte("theirs"),
+	}
+
+	merged, conflicts := MergeEnvVars(base, ours, theirs)
+
+	if !reflect.DeepEqual(conflicts, []string{"CONFLICT"}) {
+		t.Errorf("Expected conflicts [CONFLICT], got %v", conflicts)
+	}
+
+	expected := map[string]string{
+		"SHARED":     "base",
+		"OURS":       "ours",
+		"THEIRS":     "theirs",
+		"BOTH":       "same",
+		"CONFLICT":   "ours",
+		"NEW_OURS":   "ours",
+		"NEW_THEIRS": "theirs",
+	}
+
+	if len(merged) != len(expected) {
+		t.Errorf("Expected keys %v, got %v", len(expected), SortedKeys(merged))
+	}
+
+	for key, value := range expected {
+		if string(merged[key]) != value {
+			t.Errorf("Key %s: expected %q, got %q", key, value, merged[key])
+		}
+	}
+
+	// Removed on one side while changed on the other is a conflict
+	_, conflicts = MergeEnvVars(
+		map[string][]byte{"KEY": []byte("base")},
+		map[string][]byte{},
+		map[string][]byte{"KEY": []byte("theirs")},
+	)
+	if !reflect.DeepEqual(conflicts, []string{"KEY"}) {
+		t.Errorf("Expected delete/modify conflict on KEY, got %v", conflicts)
+	}
+}
+
+func TestMergeEnvFiles(t *testing.T) {
+	tmpDir := createTestDir(t)
+	keyPath, cfg := setupTestConfig(t, tmpDir)
+
+	identity, err := NewIdentityFromKey(keyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	filePath, err := cfg.GetEnvFile("default")
+	if err != nil {
+		t.Fatalf("GetEnvFile failed: %v", err)
+	}
+
+	encryptVersion := func(name string, vars map[string][]byte) string {
+		t.Helper()
+
+		if err := SaveAllEnvVars(identity, cfg, "default", vars); err != nil {
+			t.Fatalf("SaveAllEnvVars failed: %v", err)
+		}
+
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			t.Fatalf("Failed to read encrypted file: %v", err)
+		}
+
+		return writeTestFile(t, tmpDir, name, data)
+	}
+
+	basePath := encryptVersion("base", map[string][]byte{"A": []byte("1"), "B": []byte("2")})
+	oursPath := encryptVersion("ours", map[string][]byte{"A": []byte("10"), "B": []byte("2")})
+	theirsPath := encryptVersion("theirs", map[string][]byte{"A": []byte("1"), "B": []byte("20"), "C": []byte("3")})
+
+	conflicts, err := MergeEnvFiles(identity, cfg, "default", basePath, oursPath, theirsPath)
+	if err != nil {
+		t.Fatalf("MergeEnvFiles failed: %v", err)
+	}
+
+	if len(conflicts) != 0 {
+		t.Errorf("Expected no conflicts, got %v", conflicts)
+	}
+
+	data, err := os.ReadFile(oursPath)
+	if err != nil {
+		t.Fatalf("Failed to read merged file: %v", err)
+	}
+
+	merged, cleanup, _, err := decryptEnvVars(identity, "merged", data)
+	if err != nil {
+		t.Fatalf("Failed to decrypt merged file: %v", err)
+	}
+	defer cleanup()
+
+	if string(merged["A"]) != "10" || string(merged["B"]) != "20" || string(merged["C"]) != "3" {
+		t.Errorf("Unexpected merge result: A=%s B=%s C=%s", merged["A"], merged["B"], merged["C"])
+	}
+
+	// Git passes an empty file when there is no common ancestor
+	emptyBase := writeTestFile(t, tmpDir, "empty", nil)
+
+	conflicts, err = MergeEnvFiles(identity, cfg, "default", emptyBase, oursPath, theirsPath)
+	if err != nil {
+		t.Fatalf("MergeEnvFiles with empty base failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(conflicts, []string{"A"}) {
+		t.Errorf("Expected conflict on A without a base, got %v", conflicts)
+	}
+}
+
+func TestMergeEnvFilesSignedEmptyBase(t *testing.T) {
+	tmpDir := createTestDir(t)
+	keyPath, cfg := setupTestConfig(t, tmpDir)
+
+	identity, err := NewIdentityFromKey(keyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	cfg.Signers = []string{"test-user"}
+	cfg.SignaturePolicy = config.SignaturePolicyRefuse
+
+	filePath, err := cfg.GetEnvFile("default")
+	if err != nil {
+		t.Fatalf("GetEnvFile failed: %v", err)
+	}
+
+	if err := SaveAllEnvVars(identity, cfg, "default", map[string][]byte{"A": []byte("1")}); err != nil {
+		t.Fatalf("SaveAllEnvVars failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read encrypted file: %v", err)
+	}
+
+	// Both branches added the file, so git has no base and passes an empty one
+	oursPath := writeTestFile(t, tmpDir, "ours", data)
+	theirsPath := writeTestFile(t, tmpDir, "theirs", data)
+	emptyBase := writeTestFile(t, tmpDir, "empty", nil)
+
+	conflicts, err := MergeEnvFiles(identity, cfg, "default", emptyBase, oursPath, theirsPath)
+	if err != nil {
+		t.Fatalf("MergeEnvFiles with empty base and signers failed: %v", err)
+	}
+
+	if len(conflicts) != 0 {
+		t.Errorf("Expected no conflicts, got %v", conflicts)
+	}
+}
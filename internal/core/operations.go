@@ -2,6 +2,7 @@
 package core
 
 import (
+	"errors"
 	"fmt"
 
 	"filippo.io/age"
@@ -10,8 +11,112 @@ import (
 	kerrors "github.com/thunderbottom/kiln/internal/errors"
 )
 
+// ErrVarExists is returned when a copy or move would replace an existing variable.
+var ErrVarExists = errors.New("variable already exists")
+
+// VarInfo describes an environment variable without exposing its value.
+type VarInfo struct {
+	File   string `json:"file"`
+	Key    string `json:"key"`
+	Length int    `json:"length"`
+	Hash   string `json:"hash"`
+	// Layer is the file the variable is inherited from, set only when listing a merged view
+	Layer string `json:"layer,omitempty"`
+}
+
 // GetAllEnvVars decrypts, gets, and returns environment variables for a given file and identity.
+// Variables of the files it extends are merged underneath, the file itself winning; each layer
+// is decrypted under its own access list and interpolated if its configuration asks for it.
+// ${file:KEY} references in values of layers that enable them are then resolved.
 func GetAllEnvVars(identity *Identity, cfg *config.Config, fileName string) (map[string][]byte, func(), error) {
+	variables, sources, cleanup, err := loadLayers(identity, cfg, fileName, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resolved, resolveCleanup, err := resolveReferences(identity, cfg, fileName, variables, sources)
+	if err != nil {
+		cleanup()
+
+		return nil, nil, err
+	}
+
+	return resolved, func() {
+		resolveCleanup()
+		cleanup()
+	}, nil
+}
+
+// GetUnresolvedEnvVars returns the merged variables of a file as GetAllEnvVars does, leaving
+// values as they are stored: neither interpolated nor with ${file:KEY} references resolved.
+func GetUnresolvedEnvVars(identity *Identity, cfg *config.Config, fileName string) (map[string][]byte, func(), error) {
+	variables, _, cleanup, err := loadLayers(identity, cfg, fileName, false)
+
+	return variables, cleanup, err
+}
+
+// GetLayeredEnvVars returns the unresolved merged variables of a file along with the name of
+// the layer each variable was taken from.
+func GetLayeredEnvVars(identity *Identity, cfg *config.Config, fileName string) (map[string][]byte, map[string]string, func(), error) {
+	return loadLayers(identity, cfg, fileName, false)
+}
+
+// loadLayers decrypts and merges the layers of a file, interpolating the layers that enable it
+// when interpolate is set. Interpolated values of layers that enable references keep $ escaped
+// and references unresolved, for resolveReferences to finish.
+func loadLayers(identity *Identity, cfg *config.Config, fileName string, interpolate bool) (map[string][]byte, map[string]string, func(), error) {
+	if _, err := cfg.GetEnvFile(fileName); err != nil {
+		return nil, nil, nil, kerrors.ConfigError(fmt.Sprintf("file '%s' not configured", fileName), "check kiln.toml file definitions")
+	}
+
+	layers, err := cfg.FileLayers(fileName)
+	if err != nil {
+		return nil, nil, nil, kerrors.ConfigError(err.Error(), "check extends in kiln.toml file definitions")
+	}
+
+	variables := make(map[string][]byte)
+	sources := make(map[string]string)
+	cleanups := make([]func(), 0, len(layers))
+
+	cleanup := func() {
+		for _, layerCleanup := range cleanups {
+			layerCleanup()
+		}
+	}
+
+	for _, layer := range layers {
+		layerVars, layerCleanup, err := GetFileEnvVars(identity, cfg, layer)
+		if err != nil {
+			cleanup()
+
+			return nil, nil, nil, err
+		}
+
+		cleanups = append(cleanups, layerCleanup)
+
+		if interpolate && cfg.Files[layer].Interpolate {
+			layerVars, layerCleanup, err = interpolateEnvVars(layerVars, cfg.Files[layer].References)
+			if err != nil {
+				cleanup()
+
+				return nil, nil, nil, kerrors.ValidationError("interpolation", fmt.Sprintf("file '%s': %v", layer, err))
+			}
+
+			cleanups = append(cleanups, layerCleanup)
+		}
+
+		for key, value := range layerVars {
+			variables[key] = value
+			sources[key] = layer
+		}
+	}
+
+	return variables, sources, cleanup, nil
+}
+
+// GetFileEnvVars decrypts and returns only the variables stored in the named file, ignoring
+// the files it extends. Operations that write a file start from this view.
+func GetFileEnvVars(identity *Identity, cfg *config.Config, fileName string) (map[string][]byte, func(), error) {
 	filePath, err := cfg.GetEnvFile(fileName)
 	if err != nil {
 		return nil, nil, kerrors.ConfigError(fmt.Sprintf("file '%s' not configured", fileName), "check kiln.toml file definitions")
@@ -26,28 +131,127 @@ func GetAllEnvVars(identity *Identity, cfg *config.Config, fileName string) (map
 		return nil, nil, kerrors.SecurityError(fmt.Sprintf("access denied for '%s'", fileName), "check file permissions in kiln.toml")
 	}
 
-	recipients, err := ParseRecipients(recipientKeys)
-	if err != nil {
+	if _, err := ParseRecipients(recipientKeys); err != nil {
 		return nil, nil, kerrors.ConfigError(fmt.Sprintf("invalid recipients for '%s'", fileName), "verify public keys in configuration")
 	}
 
-	crypto := NewAgeManager(recipients, []age.Identity{identity.AgeIdentity()})
-
 	encryptedData, err := ReadFile(filePath)
 	if err != nil {
 		return nil, nil, kerrors.FileAccessError("read", fileName, err)
 	}
 
+	variables, cleanup, signature, err := decryptEnvVars(identity, fileName, encryptedData)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := checkSignature(cfg, fileName, fileName, signature); err != nil {
+		cleanup()
+
+		return nil, nil, err
+	}
+
+	return variables, cleanup, nil
+}
+
+// GetEnvVarsAtRevision decrypts and returns the variables of a file as committed at a git revision.
+// The ciphertext is read from git into memory and decrypted with the given identity; plaintext
+// never touches disk. A file that does not exist at the revision yields an empty map.
+func GetEnvVarsAtRevision(identity *Identity, cfg *config.Config, fileName, rev string) (map[string][]byte, func(), error) {
+	filePath, err := cfg.GetEnvFile(fileName)
+	if err != nil {
+		return nil, nil, kerrors.ConfigError(fmt.Sprintf("file '%s' not configured", fileName), "check kiln.toml file definitions")
+	}
+
+	encryptedData, err := ReadFileAtRevision(filePath, rev)
+	if err != nil {
+		return nil, nil, kerrors.OperationError("read", fmt.Sprintf("'%s' at revision '%s'", fileName, rev), err)
+	}
+
+	if encryptedData == nil {
+		return make(map[string][]byte), func() {}, nil
+	}
+
+	// Signatures are not checked: earlier revisions may predate signing or the current signers
+	variables, cleanup, _, err := decryptEnvVars(identity, fmt.Sprintf("%s@%s", fileName, rev), encryptedData)
+
+	return variables, cleanup, err
+}
+
+// DecryptEnvFile decrypts an encrypted environment file outside the configuration, such as
+// the temporary copies git hands to merge and diff drivers. The label is used in error
+// messages. An empty file, as git passes for a missing merge base, yields an empty map.
+func DecryptEnvFile(identity *Identity, label, path string) (map[string][]byte, func(), error) {
+	variables, cleanup, _, err := decryptEnvFile(identity, label, path)
+
+	return variables, cleanup, err
+}
+
+// DecryptSignedEnvFile decrypts an encrypted environment file like DecryptEnvFile, and applies
+// the signature policy of cfg to it as the content of the configured file fileName. An empty
+// file stands for a missing version and has no signature to check.
+func DecryptSignedEnvFile(identity *Identity, cfg *config.Config, fileName, label, path string) (map[string][]byte, func(), error) {
+	encryptedData, err := ReadFile(path)
+	if err != nil {
+		return nil, nil, kerrors.FileAccessError("read", label, err)
+	}
+
+	if len(encryptedData) == 0 {
+		return make(map[string][]byte), func() {}, nil
+	}
+
+	variables, cleanup, signature, err := decryptEnvVars(identity, label, encryptedData)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := checkSignature(cfg, fileName, label, signature); err != nil {
+		cleanup()
+
+		return nil, nil, err
+	}
+
+	return variables, cleanup, nil
+}
+
+func decryptEnvFile(identity *Identity, label, path string) (map[string][]byte, func(), *fileSignature, error) {
+	encryptedData, err := ReadFile(path)
+	if err != nil {
+		return nil, nil, nil, kerrors.FileAccessError("read", label, err)
+	}
+
+	if len(encryptedData) == 0 {
+		return make(map[string][]byte), func() {}, nil, nil
+	}
+
+	return decryptEnvVars(identity, label, encryptedData)
+}
+
+// decryptEnvVars decrypts and parses in-memory ciphertext, using label in error messages. The
+// signature the content ends with, if any, is returned for the caller to check.
+func decryptEnvVars(identity *Identity, label string, encryptedData []byte) (map[string][]byte, func(), *fileSignature, error) {
+	if IsValuesFormat(encryptedData) {
+		content, signature := splitSignature(encryptedData)
+
+		variables, cleanup, err := decryptValues(identity, label, content)
+
+		return variables, cleanup, signature, err
+	}
+
+	crypto := NewAgeManager(nil, []age.Identity{identity.AgeIdentity()})
+
 	plaintext, err := crypto.Decrypt(encryptedData)
 	if err != nil {
-		return nil, nil, kerrors.SecurityError(fmt.Sprintf("cannot decrypt '%s'", fileName), "ensure your key has access to this file")
+		return nil, nil, nil, kerrors.SecurityError(fmt.Sprintf("cannot decrypt '%s'", label), "ensure your key has access to this file")
 	}
 
-	variables, err := ParseEnv(plaintext)
+	content, signature := splitSignature(plaintext)
+
+	variables, err := ParseEnv(content)
 	if err != nil {
 		WipeData(plaintext)
 
-		return nil, nil, kerrors.ValidationError("environment format", fmt.Sprintf("file '%s' contains invalid format", fileName))
+		return nil, nil, nil, kerrors.ValidationError("environment format", fmt.Sprintf("file '%s' contains invalid format", label))
 	}
 
 	cleanup := func() {
@@ -58,7 +262,7 @@ func GetAllEnvVars(identity *Identity, cfg *config.Config, fileName string) (map
 		}
 	}
 
-	return variables, cleanup, nil
+	return variables, cleanup, signature, nil
 }
 
 // SaveAllEnvVars encrypts and saves environment variables to the specified file.
@@ -68,32 +272,94 @@ func SaveAllEnvVars(identity *Identity, cfg *config.Config, fileName string, var
 		return fmt.Errorf("file '%s' not configured", fileName)
 	}
 
+	var previous []byte
+	if cfg.FileFormat(fileName) == config.FormatValues && FileExists(filePath) {
+		// Unchanged values keep their ciphertext; an unreadable file is simply rewritten
+		previous, _ = ReadFile(filePath)
+	}
+
+	encryptedData, err := encryptEnvVars(identity, cfg, fileName, variables, previous)
+	if err != nil {
+		return err
+	}
+
+	return WriteFile(filePath, encryptedData)
+}
+
+// encryptEnvVars formats and encrypts variables for the recipients of the named file, in the
+// format the file is configured for. previous is the current content of the file, if any.
+func encryptEnvVars(identity *Identity, cfg *config.Config, fileName string, variables map[string][]byte, previous []byte) ([]byte, error) {
 	recipientKeys, err := cfg.ResolveFileAccess(fileName)
 	if err != nil {
-		return fmt.Errorf("access error for '%s': %w", fileName, err)
+		return nil, fmt.Errorf("access error for '%s': %w", fileName, err)
 	}
 
-	recipients, err := ParseRecipients(recipientKeys)
+	if cfg.FileFormat(fileName) == config.FormatValues {
+		encryptedData, err := encryptValues(identity, recipientKeys, variables, previous)
+		if err != nil {
+			return nil, fmt.Errorf("cannot encrypt '%s': %w", fileName, err)
+		}
+
+		// The values format is signed outside the MAC, over the whole file
+		signedData, err := signFileContent(identity, cfg, fileName, encryptedData)
+		if err != nil {
+			return nil, fmt.Errorf("cannot sign '%s': %w", fileName, err)
+		}
+
+		return signedData, nil
+	}
+
+	recipients, err := parseManifestRecipients(recipientKeys)
 	if err != nil {
-		return fmt.Errorf("invalid recipients for '%s': %w", fileName, err)
+		return nil, fmt.Errorf("invalid recipients for '%s': %w", fileName, err)
 	}
 
 	crypto := NewAgeManager(recipients, []age.Identity{identity.AgeIdentity()})
 
 	content := FormatEnv(variables)
+	if len(content) == 0 {
+		// An empty variable set still needs a payload for age to encrypt
+		content = []byte("\n")
+	}
 	defer WipeData(content)
 
-	encryptedData, err := crypto.Encrypt(content)
+	// Whole files are signed inside the encryption, so the signature covers the plaintext
+	signedContent, err := signFileContent(identity, cfg, fileName, content)
 	if err != nil {
-		return fmt.Errorf("cannot encrypt '%s': %w", fileName, err)
+		return nil, fmt.Errorf("cannot sign '%s': %w", fileName, err)
 	}
 
-	return WriteFile(filePath, encryptedData)
+	if len(signedContent) != len(content) {
+		defer WipeData(signedContent)
+	}
+
+	encrypt := crypto.Encrypt
+	if cfg.FileArmor(fileName) {
+		encrypt = crypto.EncryptArmored
+	}
+
+	encryptedData, err := encrypt(signedContent)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encrypt '%s': %w", fileName, err)
+	}
+
+	return encryptedData, nil
 }
 
 // GetEnvVar retrieves a single environment variable from the specified file.
 func GetEnvVar(identity *Identity, cfg *config.Config, fileName, key string) ([]byte, func(), error) {
-	variables, cleanup, err := GetAllEnvVars(identity, cfg, fileName)
+	return getEnvVar(GetAllEnvVars, identity, cfg, fileName, key)
+}
+
+// GetUnresolvedEnvVar retrieves a single environment variable as it is stored, without
+// interpolation or reference resolution, from the merged view of the specified file.
+func GetUnresolvedEnvVar(identity *Identity, cfg *config.Config, fileName, key string) ([]byte, func(), error) {
+	return getEnvVar(GetUnresolvedEnvVars, identity, cfg, fileName, key)
+}
+
+// getEnvVar returns a copy of one variable of the view load returns
+func getEnvVar(load func(*Identity, *config.Config, string) (map[string][]byte, func(), error), identity *Identity, cfg *config.Config, fileName, key string) ([]byte, func(), error) {
+	variables, cleanup, err := load(identity, cfg, fileName)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -114,7 +380,7 @@ func GetEnvVar(identity *Identity, cfg *config.Config, fileName, key string) ([]
 
 // SetEnvVar sets a single environment variable in the specified file.
 func SetEnvVar(identity *Identity, cfg *config.Config, fileName, key string, value []byte) error {
-	variables, cleanup, err := GetAllEnvVars(identity, cfg, fileName)
+	variables, cleanup, err := GetFileEnvVars(identity, cfg, fileName)
 	if err != nil {
 		return err
 	}
@@ -127,12 +393,226 @@ func SetEnvVar(identity *Identity, cfg *config.Config, fileName, key string, val
 	return SaveAllEnvVars(identity, cfg, fileName, variables)
 }
 
+// UnsetEnvVars removes variables matching any of the given names or glob patterns from the specified file.
+// Returns the sorted list of removed keys. The file is only re-encrypted when at least one variable matched.
+func UnsetEnvVars(identity *Identity, cfg *config.Config, fileName string, patterns []string) ([]string, error) {
+	variables, cleanup, err := GetFileEnvVars(identity, cfg, fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	removed, err := MatchVarNames(variables, patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(removed) == 0 {
+		return removed, nil
+	}
+
+	for _, key := range removed {
+		WipeData(variables[key])
+		delete(variables, key)
+	}
+
+	if err := SaveAllEnvVars(identity, cfg, fileName, variables); err != nil {
+		return nil, err
+	}
+
+	return removed, nil
+}
+
+// CopyEnvVar copies a variable to a new key, either within one file or across files.
+// Each file is re-encrypted for its own recipients. An existing destination key is only
+// replaced when overwrite is set.
+func CopyEnvVar(identity *Identity, cfg *config.Config, fromFile, srcKey, toFile, dstKey string, overwrite bool) error {
+	return transferEnvVar(identity, cfg, fromFile, srcKey, toFile, dstKey, overwrite, false)
+}
+
+// MoveEnvVar moves or renames a variable, either within one file or across files.
+// For moves across files the destination is written before the source is removed,
+// so a failure part way through leaves a copy rather than losing the value.
+func MoveEnvVar(identity *Identity, cfg *config.Config, fromFile, srcKey, toFile, dstKey string, overwrite bool) error {
+	return transferEnvVar(identity, cfg, fromFile, srcKey, toFile, dstKey, overwrite, true)
+}
+
+// transferEnvVar implements CopyEnvVar and MoveEnvVar
+func transferEnvVar(identity *Identity, cfg *config.Config, fromFile, srcKey, toFile, dstKey string, overwrite, remove bool) error {
+	if fromFile == toFile && srcKey == dstKey {
+		return fmt.Errorf("source and destination are the same variable '%s' in '%s'", srcKey, fromFile)
+	}
+
+	srcVars, srcCleanup, err := GetFileEnvVars(identity, cfg, fromFile)
+	if err != nil {
+		return err
+	}
+	defer srcCleanup()
+
+	value, exists := srcVars[srcKey]
+	if !exists {
+		return fmt.Errorf("variable '%s' not found in '%s'", srcKey, fromFile)
+	}
+	// The value may leave the map on removal, so wipe it explicitly
+	defer WipeData(value)
+
+	dstVars := srcVars
+
+	if toFile != fromFile {
+		var dstCleanup func()
+
+		dstVars, dstCleanup, err = GetFileEnvVars(identity, cfg, toFile)
+		if err != nil {
+			return err
+		}
+		defer dstCleanup()
+	}
+
+	if existing, exists := dstVars[dstKey]; exists {
+		if !overwrite {
+			return fmt.Errorf("%w: '%s' in '%s'", ErrVarExists, dstKey, toFile)
+		}
+
+		WipeData(existing)
+	}
+
+	newValue := make([]byte, len(value))
+	copy(newValue, value)
+	dstVars[dstKey] = newValue
+
+	if remove && toFile == fromFile {
+		delete(dstVars, srcKey)
+	}
+
+	if err := SaveAllEnvVars(identity, cfg, toFile, dstVars); err != nil {
+		return err
+	}
+
+	if !remove || toFile == fromFile {
+		return nil
+	}
+
+	delete(srcVars, srcKey)
+
+	return SaveAllEnvVars(identity, cfg, fromFile, srcVars)
+}
+
+// ListEnvVars returns metadata for every variable in the specified file, sorted by key.
+func ListEnvVars(identity *Identity, cfg *config.Config, fileName string) ([]VarInfo, error) {
+	variables, cleanup, err := GetFileEnvVars(identity, cfg, fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	return varInfos(fileName, variables, nil), nil
+}
+
+// ListLayeredEnvVars returns metadata for the merged variables of a file, including those
+// inherited through extends, sorted by key. Layer names the file each variable comes from.
+func ListLayeredEnvVars(identity *Identity, cfg *config.Config, fileName string) ([]VarInfo, error) {
+	variables, sources, cleanup, err := GetLayeredEnvVars(identity, cfg, fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	return varInfos(fileName, variables, sources), nil
+}
+
+// varInfos builds sorted metadata for variables, taking layers from sources when given
+func varInfos(fileName string, variables map[string][]byte, sources map[string]string) []VarInfo {
+	keys := SortedKeys(variables)
+	infos := make([]VarInfo, 0, len(keys))
+
+	for _, key := range keys {
+		infos = append(infos, VarInfo{
+			File:   fileName,
+			Key:    key,
+			Length: len(variables[key]),
+			Hash:   ShortHash(variables[key]),
+			Layer:  sources[key],
+		})
+	}
+
+	return infos
+}
+
 // CheckEnvFile validates that a file can be decrypted
 func CheckEnvFile(identity *Identity, cfg *config.Config, fileName string) error {
-	_, cleanup, err := GetAllEnvVars(identity, cfg, fileName)
+	_, cleanup, err := GetFileEnvVars(identity, cfg, fileName)
 	if cleanup != nil {
 		defer cleanup()
 	}
 
 	return err
 }
+
+// FileRecipientsCurrent reports whether an existing file is encrypted for the recipients it
+// currently resolves to in the configuration. Only the age header, or the recipient list of a
+// values file, is read; see RecipientsMatch for what can be detected without decrypting.
+func FileRecipientsCurrent(cfg *config.Config, fileName string) (bool, error) {
+	filePath, err := cfg.GetEnvFile(fileName)
+	if err != nil {
+		return false, kerrors.ConfigError(fmt.Sprintf("file '%s' not configured", fileName), "check kiln.toml file definitions")
+	}
+
+	recipientKeys, err := cfg.ResolveFileAccess(fileName)
+	if err != nil {
+		return false, kerrors.SecurityError(fmt.Sprintf("access denied for '%s'", fileName), "check file permissions in kiln.toml")
+	}
+
+	encryptedData, err := ReadFile(filePath)
+	if err != nil {
+		return false, kerrors.FileAccessError("read", fileName, err)
+	}
+
+	match := RecipientsMatch
+	if IsValuesFormat(encryptedData) {
+		match = valuesRecipientsMatch
+	}
+
+	current, err := match(encryptedData, recipientKeys)
+	if err != nil {
+		return false, fmt.Errorf("inspect '%s': %w", fileName, err)
+	}
+
+	return current, nil
+}
+
+// FileFormatCurrent reports whether an existing file is stored in the format its configuration
+// asks for: a values file, or an ASCII-armored or binary age file as its armor setting says,
+// with a recipient manifest.
+func FileFormatCurrent(cfg *config.Config, fileName string) (bool, error) {
+	filePath, err := cfg.GetEnvFile(fileName)
+	if err != nil {
+		return false, kerrors.ConfigError(fmt.Sprintf("file '%s' not configured", fileName), "check kiln.toml file definitions")
+	}
+
+	encryptedData, err := ReadFile(filePath)
+	if err != nil {
+		return false, kerrors.FileAccessError("read", fileName, err)
+	}
+
+	if cfg.FileFormat(fileName) == config.FormatValues {
+		if !IsValuesFormat(encryptedData) {
+			return false, nil
+		}
+
+		file, err := parseValuesFile(encryptedData)
+		if err != nil {
+			return false, fmt.Errorf("inspect '%s': %w", fileName, err)
+		}
+
+		encryptedData = file.wrappedKey
+	} else if IsValuesFormat(encryptedData) || IsArmored(encryptedData) != cfg.FileArmor(fileName) {
+		return false, nil
+	}
+
+	manifest, err := HeaderManifest(encryptedData)
+	if err != nil {
+		return false, fmt.Errorf("inspect '%s': %w", fileName, err)
+	}
+
+	return manifest != nil, nil
+}
@@ -1,7 +1,11 @@
 package core
 
 import (
+	"errors"
+	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/thunderbottom/kiln/internal/config"
@@ -63,6 +67,107 @@ func TestGetAllEnvVars(t *testing.T) {
 	}
 }
 
+func TestGetAllEnvVarsExtends(t *testing.T) {
+	tmpDir := createTestDir(t)
+	keyPath, cfg := setupTestConfig(t, tmpDir)
+
+	identity, err := NewIdentityFromKey(keyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	cfg.Files["prod"] = config.FileConfig{
+		Filename: filepath.Join(tmpDir, "prod.env"),
+		Access:   []string{"*"},
+		Extends:  []string{"default"},
+	}
+
+	if err := SaveAllEnvVars(identity, cfg, "default", map[string][]byte{
+		"LOG_LEVEL": []byte("debug"),
+		"REGION":    []byte("eu-west-1"),
+	}); err != nil {
+		t.Fatalf("SaveAllEnvVars failed: %v", err)
+	}
+
+	if err := SetEnvVar(identity, cfg, "prod", "LOG_LEVEL", []byte("warn")); err != nil {
+		t.Fatalf("SetEnvVar failed: %v", err)
+	}
+
+	vars, sources, cleanup, err := GetLayeredEnvVars(identity, cfg, "prod")
+	if err != nil {
+		t.Fatalf("GetLayeredEnvVars failed: %v", err)
+	}
+	defer cleanup()
+
+	if string(vars["LOG_LEVEL"]) != "warn" || string(vars["REGION"]) != "eu-west-1" {
+		t.Errorf("Unexpected merged variables: LOG_LEVEL=%q REGION=%q", vars["LOG_LEVEL"], vars["REGION"])
+	}
+
+	if sources["LOG_LEVEL"] != "prod" || sources["REGION"] != "default" {
+		t.Errorf("Unexpected sources: %v", sources)
+	}
+
+	// Writes go to the named layer only
+	own, ownCleanup, err := GetFileEnvVars(identity, cfg, "prod")
+	if err != nil {
+		t.Fatalf("GetFileEnvVars failed: %v", err)
+	}
+	defer ownCleanup()
+
+	if len(own) != 1 || string(own["LOG_LEVEL"]) != "warn" {
+		t.Errorf("Expected prod to store only LOG_LEVEL, got %d variables", len(own))
+	}
+}
+
+func TestGetAllEnvVarsInterpolate(t *testing.T) {
+	tmpDir := createTestDir(t)
+	keyPath, cfg := setupTestConfig(t, tmpDir)
+
+	identity, err := NewIdentityFromKey(keyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	if err := SaveAllEnvVars(identity, cfg, "default", map[string][]byte{
+		"DB_USER": []byte("app"),
+		"DB_URL":  []byte("postgres://${DB_USER}@db"),
+	}); err != nil {
+		t.Fatalf("SaveAllEnvVars failed: %v", err)
+	}
+
+	for _, interpolate := range []bool{false, true} {
+		fileConfig := cfg.Files["default"]
+		fileConfig.Interpolate = interpolate
+		cfg.Files["default"] = fileConfig
+
+		vars, cleanup, err := GetAllEnvVars(identity, cfg, "default")
+		if err != nil {
+			t.Fatalf("GetAllEnvVars failed: %v", err)
+		}
+
+		want := "postgres://${DB_USER}@db"
+		if interpolate {
+			want = "postgres://app@db"
+		}
+
+		if got := string(vars["DB_URL"]); got != want {
+			t.Errorf("interpolate=%v: expected %q, got %q", interpolate, want, got)
+		}
+
+		cleanup()
+	}
+
+	raw, cleanup, err := GetUnresolvedEnvVars(identity, cfg, "default")
+	if err != nil {
+		t.Fatalf("GetUnresolvedEnvVars failed: %v", err)
+	}
+	defer cleanup()
+
+	if got := string(raw["DB_URL"]); got != "postgres://${DB_USER}@db" {
+		t.Errorf("Expected stored form, got %q", got)
+	}
+}
+
 func TestSaveAllEnvVars(t *testing.T) {
 	tmpDir := createTestDir(t)
 	keyPath, cfg := setupTestConfig(t, tmpDir)
@@ -207,6 +312,298 @@ func TestCheckEnvFile(t *testing.T) {
 	}
 }
 
+func TestUnsetEnvVars(t *testing.T) {
+	tmpDir := createTestDir(t)
+	keyPath, cfg := setupTestConfig(t, tmpDir)
+
+	identity, err := NewIdentityFromKey(keyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	testVars := map[string][]byte{
+		"LEGACY_HOST": []byte("old-host"),
+		"LEGACY_PORT": []byte("1234"),
+		"API_KEY":     []byte("secret-123"),
+		"DEBUG":       []byte("true"),
+	}
+
+	if err := SaveAllEnvVars(identity, cfg, "default", testVars); err != nil {
+		t.Fatalf("SaveAllEnvVars failed: %v", err)
+	}
+
+	removed, err := UnsetEnvVars(identity, cfg, "default", []string{"LEGACY_*", "DEBUG"})
+	if err != nil {
+		t.Fatalf("UnsetEnvVars failed: %v", err)
+	}
+
+	expected := []string{"DEBUG", "LEGACY_HOST", "LEGACY_PORT"}
+	if !reflect.DeepEqual(removed, expected) {
+		t.Errorf("Removed keys: expected %v, got %v", expected, removed)
+	}
+
+	vars, cleanup, err := GetAllEnvVars(identity, cfg, "default")
+	if err != nil {
+		t.Fatalf("GetAllEnvVars failed: %v", err)
+	}
+	defer cleanup()
+
+	if len(vars) != 1 || string(vars["API_KEY"]) != "secret-123" {
+		t.Errorf("Expected only API_KEY to remain, got %v", SortedKeys(vars))
+	}
+
+	// No matches leaves the file untouched
+	removed, err = UnsetEnvVars(identity, cfg, "default", []string{"MISSING_*"})
+	if err != nil {
+		t.Fatalf("UnsetEnvVars with no matches failed: %v", err)
+	}
+
+	if len(removed) != 0 {
+		t.Errorf("Expected no removed keys, got %v", removed)
+	}
+
+	// Removing the last variable leaves a decryptable empty file
+	if _, err := UnsetEnvVars(identity, cfg, "default", []string{"*"}); err != nil {
+		t.Fatalf("UnsetEnvVars for all variables failed: %v", err)
+	}
+
+	if err := CheckEnvFile(identity, cfg, "default"); err != nil {
+		t.Errorf("CheckEnvFile failed after removing all variables: %v", err)
+	}
+
+	if _, err := UnsetEnvVars(identity, cfg, "default", []string{"[invalid"}); err == nil {
+		t.Error("UnsetEnvVars should fail for malformed pattern")
+	}
+}
+
+func TestListEnvVars(t *testing.T) {
+	tmpDir := createTestDir(t)
+	keyPath, cfg := setupTestConfig(t, tmpDir)
+
+	identity, err := NewIdentityFromKey(keyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	testVars := map[string][]byte{
+		"ZEBRA":   []byte("same"),
+		"API_KEY": []byte("same"),
+		"PORT":    []byte("8080"),
+	}
+
+	if err := SaveAllEnvVars(identity, cfg, "default", testVars); err != nil {
+		t.Fatalf("SaveAllEnvVars failed: %v", err)
+	}
+
+	infos, err := ListEnvVars(identity, cfg, "default")
+	if err != nil {
+		t.Fatalf("ListEnvVars failed: %v", err)
+	}
+
+	if len(infos) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(infos))
+	}
+
+	if infos[0].Key != "API_KEY" || infos[2].Key != "ZEBRA" {
+		t.Errorf("Entries not sorted by key: %v", infos)
+	}
+
+	if infos[0].Hash != infos[2].Hash {
+		t.Error("Equal values should have equal hashes")
+	}
+
+	if infos[1].Hash == infos[0].Hash {
+		t.Error("Different values should have different hashes")
+	}
+
+	if infos[1].Length != 4 || infos[1].File != "default" {
+		t.Errorf("Unexpected metadata for PORT: %+v", infos[1])
+	}
+
+	for _, info := range infos {
+		if strings.Contains(info.Hash, "same") || strings.Contains(info.Hash, "8080") {
+			t.Errorf("Hash for %s leaks the value", info.Key)
+		}
+	}
+}
+
+func TestMoveCopyEnvVar(t *testing.T) {
+	tmpDir := createTestDir(t)
+	keyPath, cfg := setupTestConfig(t, tmpDir)
+
+	cfg.Files["staging"] = config.FileConfig{
+		Filename: filepath.Join(tmpDir, "staging.env"),
+		Access:   []string{"*"},
+	}
+
+	identity, err := NewIdentityFromKey(keyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	testVars := map[string][]byte{
+		"DB_HOST": []byte("db.internal"),
+		"API_KEY": []byte("secret-123"),
+	}
+
+	if err := SaveAllEnvVars(identity, cfg, "default", testVars); err != nil {
+		t.Fatalf("SaveAllEnvVars failed: %v", err)
+	}
+
+	// Rename within a file
+	if err := MoveEnvVar(identity, cfg, "default", "DB_HOST", "default", "DATABASE_HOST", false); err != nil {
+		t.Fatalf("MoveEnvVar rename failed: %v", err)
+	}
+
+	if _, _, err := GetEnvVar(identity, cfg, "default", "DB_HOST"); err == nil {
+		t.Error("Source variable should be gone after rename")
+	}
+
+	// Copy across files
+	if err := CopyEnvVar(identity, cfg, "default", "API_KEY", "staging", "API_KEY", false); err != nil {
+		t.Fatalf("CopyEnvVar failed: %v", err)
+	}
+
+	value, cleanup, err := GetEnvVar(identity, cfg, "staging", "API_KEY")
+	if err != nil {
+		t.Fatalf("GetEnvVar after copy failed: %v", err)
+	}
+
+	if string(value) != "secret-123" {
+		t.Errorf("Copied value: expected 'secret-123', got %q", value)
+	}
+
+	cleanup()
+
+	// Existing destination requires overwrite
+	err = MoveEnvVar(identity, cfg, "default", "API_KEY", "staging", "API_KEY", false)
+	if !errors.Is(err, ErrVarExists) {
+		t.Errorf("Expected ErrVarExists, got %v", err)
+	}
+
+	if err := MoveEnvVar(identity, cfg, "default", "API_KEY", "staging", "API_KEY", true); err != nil {
+		t.Fatalf("MoveEnvVar with overwrite failed: %v", err)
+	}
+
+	vars, varsCleanup, err := GetAllEnvVars(identity, cfg, "default")
+	if err != nil {
+		t.Fatalf("GetAllEnvVars failed: %v", err)
+	}
+	defer varsCleanup()
+
+	if _, exists := vars["API_KEY"]; exists || string(vars["DATABASE_HOST"]) != "db.internal" {
+		t.Errorf("Unexpected source file contents after move: %v", SortedKeys(vars))
+	}
+
+	// Missing source and no-op transfers fail
+	if err := CopyEnvVar(identity, cfg, "default", "MISSING", "staging", "MISSING", false); err == nil {
+		t.Error("CopyEnvVar should fail for missing source")
+	}
+
+	if err := MoveEnvVar(identity, cfg, "default", "DATABASE_HOST", "default", "DATABASE_HOST", true); err == nil {
+		t.Error("MoveEnvVar should fail when source and destination are identical")
+	}
+}
+
+func TestFileRecipientsCurrent(t *testing.T) {
+	tmpDir := createTestDir(t)
+	keyPath, cfg := setupTestConfig(t, tmpDir)
+
+	identity, err := NewIdentityFromKey(keyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	if err := SetEnvVar(identity, cfg, "default", "KEY", []byte("value")); err != nil {
+		t.Fatalf("SetEnvVar failed: %v", err)
+	}
+
+	current, err := FileRecipientsCurrent(cfg, "default")
+	if err != nil {
+		t.Fatalf("FileRecipientsCurrent failed: %v", err)
+	}
+
+	if !current {
+		t.Error("Freshly written file should be current")
+	}
+
+	// Granting access to another recipient makes the ciphertext stale
+	_, otherKey, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+
+	cfg.AddRecipient("other-user", otherKey)
+
+	current, err = FileRecipientsCurrent(cfg, "default")
+	if err != nil {
+		t.Fatalf("FileRecipientsCurrent failed: %v", err)
+	}
+
+	if current {
+		t.Error("File should be stale after adding a recipient")
+	}
+}
+
+func TestSaveAllEnvVarsArmor(t *testing.T) {
+	tmpDir := createTestDir(t)
+	keyPath, cfg := setupTestConfig(t, tmpDir)
+
+	identity, err := NewIdentityFromKey(keyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	if err := SetEnvVar(identity, cfg, "default", "KEY", []byte("value")); err != nil {
+		t.Fatalf("SetEnvVar failed: %v", err)
+	}
+
+	// Switching the global default leaves the binary file stale until it is rewritten
+	cfg.Armor = true
+
+	current, err := FileFormatCurrent(cfg, "default")
+	if err != nil || current {
+		t.Fatalf("Expected binary file to be stale, got %v, %v", current, err)
+	}
+
+	if err := SetEnvVar(identity, cfg, "default", "OTHER", []byte("other")); err != nil {
+		t.Fatalf("SetEnvVar failed: %v", err)
+	}
+
+	data, err := os.ReadFile(cfg.Files["default"].Filename)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	if !strings.HasPrefix(string(data), "-----BEGIN AGE ENCRYPTED FILE-----") || !IsArmored(data) {
+		t.Fatalf("Expected armored file, got %q", data)
+	}
+
+	value, cleanup, err := GetEnvVar(identity, cfg, "default", "KEY")
+	if err != nil {
+		t.Fatalf("GetEnvVar failed on armored file: %v", err)
+	}
+	defer cleanup()
+
+	if string(value) != "value" {
+		t.Errorf("Expected %q, got %q", "value", value)
+	}
+
+	if current, err := FileRecipientsCurrent(cfg, "default"); err != nil || !current {
+		t.Errorf("Expected armored file recipients to be current, got %v, %v", current, err)
+	}
+
+	// A per-file setting overrides the global default
+	binary := false
+	fileConfig := cfg.Files["default"]
+	fileConfig.Armor = &binary
+	cfg.Files["default"] = fileConfig
+
+	if current, err := FileFormatCurrent(cfg, "default"); err != nil || current {
+		t.Errorf("Expected armored file to be stale with armor = false, got %v, %v", current, err)
+	}
+}
+
 // Helper function to setup test configuration
 func setupTestConfig(t *testing.T, tmpDir string) (keyPath string, cfg *config.Config) {
 	t.Helper()
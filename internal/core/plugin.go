@@ -0,0 +1,137 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+
+	"filippo.io/age/plugin"
+	"golang.org/x/term"
+)
+
+// pluginIdentityPrefix starts the identity line of an age plugin identity file
+const pluginIdentityPrefix = "AGE-PLUGIN-"
+
+// promptInput buffers stdin across prompts, so a line read ahead by one prompt is not lost to
+// the next. The buffer is replaced if os.Stdin is.
+var promptInput struct {
+	sync.Mutex
+	source *os.File
+	reader *bufio.Reader
+}
+
+// pluginUI answers plugin requests on the terminal. Prompts and messages go to stderr so
+// they do not mix with the output of commands such as export.
+var pluginUI = &plugin.ClientUI{
+	DisplayMessage: func(name, message string) error {
+		fmt.Fprintf(os.Stderr, "%s plugin: %s\n", name, message)
+
+		return nil
+	},
+	RequestValue: func(name, prompt string, secret bool) (string, error) {
+		fmt.Fprintf(os.Stderr, "%s plugin: %s ", name, prompt)
+
+		value, err := readPromptValue(secret)
+		if err != nil {
+			return "", fmt.Errorf("read %s plugin input: %w", name, err)
+		}
+
+		return value, nil
+	},
+	Confirm: func(name, prompt, yes, no string) (bool, error) {
+		if no == "" {
+			fmt.Fprintf(os.Stderr, "%s plugin: %s [%s] ", name, prompt, yes)
+		} else {
+			fmt.Fprintf(os.Stderr, "%s plugin: %s [%s/%s] ", name, prompt, yes, no)
+		}
+
+		answer, err := readPromptValue(false)
+		if err != nil {
+			return false, fmt.Errorf("read %s plugin input: %w", name, err)
+		}
+
+		return no == "" || strings.EqualFold(strings.TrimSpace(answer), yes), nil
+	},
+	WaitTimer: func(name string) {
+		fmt.Fprintf(os.Stderr, "waiting for %s plugin, your key may need a touch\n", name)
+	},
+}
+
+// readPromptValue reads a line of input. Secret input is read without echo when stdin is a
+// terminal; otherwise a line is read from stdin, so values can be piped in non-interactive use.
+func readPromptValue(secret bool) (string, error) {
+	// Convert to int since syscall.Stdin is not int on Windows
+	//nolint:unconvert
+	fd := int(syscall.Stdin)
+
+	if secret && term.IsTerminal(fd) {
+		value, err := term.ReadPassword(fd)
+
+		fmt.Fprintln(os.Stderr)
+
+		return string(value), err
+	}
+
+	promptInput.Lock()
+	defer promptInput.Unlock()
+
+	if promptInput.source != os.Stdin {
+		promptInput.source = os.Stdin
+		promptInput.reader = bufio.NewReader(os.Stdin)
+	}
+
+	line, err := promptInput.reader.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// isPluginRecipient reports whether key is an age1<plugin>1... recipient handled by a plugin
+func isPluginRecipient(key string) bool {
+	_, _, err := plugin.ParseRecipient(key)
+
+	return err == nil
+}
+
+// pluginIdentityLine returns the AGE-PLUGIN- line of an identity file, if there is one
+func pluginIdentityLine(content string) (string, bool) {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, pluginIdentityPrefix) {
+			return line, true
+		}
+	}
+
+	return "", false
+}
+
+// pluginIdentityRecipient returns the recipient recorded in a plugin identity file. Plugins
+// such as age-plugin-yubikey and age-plugin-tpm write it as a "# Recipient: age1..." comment,
+// since the recipient cannot be derived from the identity without the hardware.
+func pluginIdentityRecipient(content string) (string, error) {
+	for _, line := range strings.Split(content, "\n") {
+		comment, isComment := strings.CutPrefix(strings.TrimSpace(line), "#")
+		if !isComment {
+			continue
+		}
+
+		label, value, found := strings.Cut(comment, ":")
+		if !found {
+			continue
+		}
+
+		label = strings.ToLower(strings.TrimSpace(label))
+		value = strings.TrimSpace(value)
+
+		if (label == "recipient" || label == "public key") && isPluginRecipient(value) {
+			return value, nil
+		}
+	}
+
+	return "", fmt.Errorf("plugin identity file has no '# Recipient: age1...' comment")
+}
@@ -0,0 +1,255 @@
+package core
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age/plugin"
+
+	"github.com/thunderbottom/kiln/internal/config"
+)
+
+// fakePluginName is served by the test binary itself when run as age-plugin-kilntest
+const (
+	fakePluginName = "kilntest"
+	fakePluginPIN  = "1234"
+)
+
+func TestMain(m *testing.M) {
+	if filepath.Base(os.Args[0]) == "age-plugin-"+fakePluginName {
+		if err := runFakePlugin(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+// pluginStanzaLine is a stanza of the age plugin protocol
+type pluginStanzaLine struct {
+	args []string
+	body []byte
+}
+
+func readPluginStanza(r *bufio.Reader) (pluginStanzaLine, error) {
+	header, err := r.ReadString('\n')
+	if err != nil {
+		return pluginStanzaLine{}, err
+	}
+
+	stanza := pluginStanzaLine{args: strings.Fields(strings.TrimPrefix(header, "-> "))}
+
+	var encoded strings.Builder
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return pluginStanzaLine{}, err
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		encoded.WriteString(line)
+
+		if len(line) < 64 {
+			break
+		}
+	}
+
+	stanza.body, err = base64.RawStdEncoding.DecodeString(encoded.String())
+
+	return stanza, err
+}
+
+func writePluginStanza(w io.Writer, body []byte, args ...string) {
+	fmt.Fprintf(w, "-> %s\n%s\n", strings.Join(args, " "), base64.RawStdEncoding.EncodeToString(body))
+}
+
+// runFakePlugin implements a minimal age plugin that "wraps" file keys by storing them as is,
+// and asks for a PIN through the client before unwrapping
+func runFakePlugin(args []string, stdin io.Reader, stdout io.Writer) error {
+	in := bufio.NewReader(stdin)
+
+	var received []pluginStanzaLine
+
+	for {
+		stanza, err := readPluginStanza(in)
+		if err != nil {
+			return err
+		}
+
+		if stanza.args[0] == "done" {
+			break
+		}
+
+		received = append(received, stanza)
+	}
+
+	switch {
+	case len(args) == 1 && args[0] == "--age-plugin=recipient-v1":
+		for _, stanza := range received {
+			if stanza.args[0] == "wrap-file-key" {
+				writePluginStanza(stdout, stanza.body, "recipient-stanza", "0", fakePluginName)
+
+				if _, err := readPluginStanza(in); err != nil {
+					return err
+				}
+			}
+		}
+	case len(args) == 1 && args[0] == "--age-plugin=identity-v1":
+		writePluginStanza(stdout, []byte("Enter PIN:"), "request-secret")
+
+		reply, err := readPluginStanza(in)
+		if err != nil {
+			return err
+		}
+
+		for _, stanza := range received {
+			if stanza.args[0] == "recipient-stanza" && stanza.args[2] == fakePluginName && string(reply.body) == fakePluginPIN {
+				writePluginStanza(stdout, stanza.body, "file-key", "0")
+
+				if _, err := readPluginStanza(in); err != nil {
+					return err
+				}
+
+				break
+			}
+		}
+	default:
+		return fmt.Errorf("unexpected arguments %v", args)
+	}
+
+	writePluginStanza(stdout, nil, "done")
+
+	return nil
+}
+
+// setupFakePlugin puts age-plugin-kilntest on PATH and answers its PIN prompt through stdin
+func setupFakePlugin(t *testing.T, tmpDir string) {
+	t.Helper()
+
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatalf("os.Executable failed: %v", err)
+	}
+
+	binDir := filepath.Join(tmpDir, "bin")
+	if err := os.Mkdir(binDir, 0o755); err != nil {
+		t.Fatalf("Mkdir failed: %v", err)
+	}
+
+	if err := os.Symlink(executable, filepath.Join(binDir, "age-plugin-"+fakePluginName)); err != nil {
+		t.Fatalf("Symlink failed: %v", err)
+	}
+
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Pipe failed: %v", err)
+	}
+
+	// One PIN per unwrap; the test decrypts once
+	fmt.Fprintln(writer, fakePluginPIN)
+	writer.Close()
+
+	stdin := os.Stdin
+	os.Stdin = reader
+
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		reader.Close()
+	})
+}
+
+func TestPluginRecipientAndIdentity(t *testing.T) {
+	tmpDir := createTestDir(t)
+	setupFakePlugin(t, tmpDir)
+
+	recipient := plugin.EncodeRecipient(fakePluginName, []byte("recipient"))
+	identityLine := plugin.EncodeIdentity(fakePluginName, []byte("identity"))
+
+	keyPath := filepath.Join(tmpDir, "plugin.key")
+	keyFile := fmt.Sprintf("# Serial: 42\n# Recipient: %s\n%s\n", recipient, identityLine)
+
+	if err := os.WriteFile(keyPath, []byte(keyFile), 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	if err := ValidatePublicKey(recipient); err != nil {
+		t.Errorf("ValidatePublicKey rejected plugin recipient: %v", err)
+	}
+
+	if keyType, _, err := PublicKeyInfo(recipient); err != nil || keyType != "age-plugin-"+fakePluginName {
+		t.Errorf("Unexpected PublicKeyInfo: %q, %v", keyType, err)
+	}
+
+	identity, err := NewIdentityFromKey(keyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	if identity.PublicKey() != recipient || identity.KeyType() != "age-plugin-"+fakePluginName {
+		t.Errorf("Unexpected identity: %s %s", identity.KeyType(), identity.PublicKey())
+	}
+
+	cfg := config.NewConfig()
+	cfg.AddRecipient("hardware", recipient)
+	cfg.Files["default"] = config.FileConfig{Filename: filepath.Join(tmpDir, ".kiln.env"), Access: []string{"*"}}
+
+	if err := SetEnvVar(identity, cfg, "default", "TOKEN", []byte("secret")); err != nil {
+		t.Fatalf("SetEnvVar failed: %v", err)
+	}
+
+	current, err := FileRecipientsCurrent(cfg, "default")
+	if err != nil || !current {
+		t.Errorf("Expected recipients to be current, got %v, %v", current, err)
+	}
+
+	value, cleanup, err := GetEnvVar(identity, cfg, "default", "TOKEN")
+	if err != nil {
+		t.Fatalf("GetEnvVar failed: %v", err)
+	}
+	defer cleanup()
+
+	if string(value) != "secret" {
+		t.Errorf("Expected %q, got %q", "secret", value)
+	}
+}
+
+func TestPluginPromptsShareInput(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Pipe failed: %v", err)
+	}
+
+	// Both answers arrive at once, as they do when piped in
+	fmt.Fprint(writer, fakePluginPIN+"\nyes\n")
+	writer.Close()
+
+	stdin := os.Stdin
+	os.Stdin = reader
+
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		reader.Close()
+	})
+
+	pin, err := pluginUI.RequestValue(fakePluginName, "Enter PIN:", true)
+	if err != nil || pin != fakePluginPIN {
+		t.Fatalf("Expected first prompt to read %q, got %q, %v", fakePluginPIN, pin, err)
+	}
+
+	confirmed, err := pluginUI.Confirm(fakePluginName, "Continue?", "yes", "no")
+	if err != nil || !confirmed {
+		t.Errorf("Expected second prompt to read the next line, got %v, %v", confirmed, err)
+	}
+}
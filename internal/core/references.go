@@ -0,0 +1,213 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/thunderbottom/kiln/internal/config"
+	kerrors "github.com/thunderbottom/kiln/internal/errors"
+)
+
+// referencePattern matches a reference to a variable in another file, written ${file:KEY}
+var referencePattern = regexp.MustCompile(`\$\{([^${}:/]+):([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// escapedReferencePattern matches $$ and references in the values of files that enable
+// references, where $$ stands for a literal $
+var escapedReferencePattern = regexp.MustCompile(`\$\$|` + referencePattern.String())
+
+// referenceResolver resolves ${file:KEY} references, caching each file's variables and
+// each resolved value so shared references are decrypted and expanded once
+type referenceResolver struct {
+	identity *Identity
+	cfg      *config.Config
+	files    map[string]map[string][]byte
+	sources  map[string]map[string]string
+	resolved map[string][]byte
+	cleanups []func()
+}
+
+// resolveReferences returns the variables of a file with every ${file:KEY} reference in their
+// values replaced by the referenced variable, itself resolved. sources names the layer each
+// variable comes from; only values from layers that enable references are resolved, and in them
+// $$ stands for a literal $, so $${file:KEY} stays literal. Values from interpolated layers are
+// expected with their $ escaped as loadLayers leaves them. Referenced files are read through
+// their merged and interpolated view, each under its own access list. The input map is not
+// modified; the returned cleanup wipes the values created by resolution and the referenced
+// files that were decrypted.
+func resolveReferences(identity *Identity, cfg *config.Config, fileName string, variables map[string][]byte, sources map[string]string) (map[string][]byte, func(), error) {
+	resolver := &referenceResolver{
+		identity: identity,
+		cfg:      cfg,
+		files:    map[string]map[string][]byte{fileName: variables},
+		sources:  map[string]map[string]string{fileName: sources},
+		resolved: make(map[string][]byte),
+	}
+
+	resolvedVars := make(map[string][]byte, len(variables))
+
+	for _, key := range SortedKeys(variables) {
+		value, err := resolver.resolve(fileName, key, variables[key], nil)
+		if err != nil {
+			resolver.cleanup()
+
+			return nil, nil, err
+		}
+
+		resolvedVars[key] = value
+	}
+
+	return resolvedVars, resolver.cleanup, nil
+}
+
+// resolve expands the references in the value of file:key. path holds the references being
+// expanded, outermost first, and is used to detect and report cycles.
+func (r *referenceResolver) resolve(fileName, key string, value []byte, path []string) ([]byte, error) {
+	ref := fileName + ":" + key
+
+	if resolved, exists := r.resolved[ref]; exists {
+		return resolved, nil
+	}
+
+	if start := slices.Index(path, ref); start >= 0 {
+		cycle := append(slices.Clone(path[start:]), ref)
+
+		return nil, fmt.Errorf("reference cycle: %s", strings.Join(cycle, " -> "))
+	}
+
+	var matches [][]int
+	if r.cfg.Files[r.sources[fileName][key]].References {
+		matches = escapedReferencePattern.FindAllSubmatchIndex(value, -1)
+	}
+
+	if len(matches) == 0 {
+		r.resolved[ref] = value
+
+		return value, nil
+	}
+
+	path = append(path, ref)
+	result := make([]byte, 0, len(value))
+	last := 0
+
+	for _, match := range matches {
+		if match[2] < 0 {
+			result = append(result, value[last:match[0]]...)
+			result = append(result, '$')
+			last = match[1]
+
+			continue
+		}
+
+		refFile, refKey := string(value[match[2]:match[3]]), string(value[match[4]:match[5]])
+
+		refValue, err := r.lookup(fileName, key, refFile, refKey)
+		if err != nil {
+			WipeData(result)
+
+			return nil, err
+		}
+
+		expanded, err := r.resolve(refFile, refKey, refValue, path)
+		if err != nil {
+			WipeData(result)
+
+			return nil, err
+		}
+
+		result = append(result, value[last:match[0]]...)
+		result = append(result, expanded...)
+		last = match[1]
+	}
+
+	result = append(result, value[last:]...)
+	r.resolved[ref] = result
+	r.cleanups = append(r.cleanups, func() { WipeData(result) })
+
+	return result, nil
+}
+
+// lookup returns the stored value of refFile:refKey, referenced from key in fileName
+func (r *referenceResolver) lookup(fileName, key, refFile, refKey string) ([]byte, error) {
+	variables, exists := r.files[refFile]
+	if !exists {
+		if _, configured := r.cfg.Files[refFile]; !configured {
+			return nil, kerrors.ConfigError(fmt.Sprintf("'%s' in '%s' references unknown file '%s'", key, fileName, refFile),
+				"check kiln.toml file definitions")
+		}
+
+		loaded, sources, cleanup, err := loadLayers(r.identity, r.cfg, refFile, true)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' in '%s' references '%s': %w", key, fileName, refFile, err)
+		}
+
+		r.cleanups = append(r.cleanups, cleanup)
+		r.files[refFile] = loaded
+		r.sources[refFile] = sources
+		variables = loaded
+	}
+
+	value, exists := variables[refKey]
+	if !exists {
+		return nil, fmt.Errorf("'%s' in '%s' references '%s:%s', which is not set", key, fileName, refFile, refKey)
+	}
+
+	return value, nil
+}
+
+func (r *referenceResolver) cleanup() {
+	for _, cleanup := range r.cleanups {
+		cleanup()
+	}
+}
+
+// FilesReferencing returns the files enabling references whose stored values reference a
+// variable of name with ${name:KEY}, and the files that could not be checked because identity
+// cannot decrypt them. Only existing files other than name are read; identity may be nil,
+// leaving all of them unchecked.
+func FilesReferencing(identity *Identity, cfg *config.Config, name string) ([]string, []string) {
+	var referencing, unchecked []string
+
+	for _, fileName := range cfg.FileNames() {
+		filePath, err := cfg.GetEnvFile(fileName)
+		if fileName == name || !cfg.Files[fileName].References || err != nil || !FileExists(filePath) {
+			continue
+		}
+
+		if identity == nil {
+			unchecked = append(unchecked, fileName)
+
+			continue
+		}
+
+		variables, cleanup, err := GetFileEnvVars(identity, cfg, fileName)
+		if err != nil {
+			unchecked = append(unchecked, fileName)
+
+			continue
+		}
+
+		if referencesFile(variables, name) {
+			referencing = append(referencing, fileName)
+		}
+
+		cleanup()
+	}
+
+	return referencing, unchecked
+}
+
+// referencesFile reports whether any of variables references a variable of name; $${name:KEY}
+// is an escaped literal and not a reference
+func referencesFile(variables map[string][]byte, name string) bool {
+	for _, value := range variables {
+		for _, match := range escapedReferencePattern.FindAllSubmatchIndex(value, -1) {
+			if match[2] >= 0 && string(value[match[2]:match[3]]) == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
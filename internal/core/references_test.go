@@ -0,0 +1,213 @@
+package core
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thunderbottom/kiln/internal/config"
+)
+
+func TestResolveReferences(t *testing.T) {
+	tmpDir := createTestDir(t)
+	keyPath, cfg := setupTestConfig(t, tmpDir)
+
+	identity, err := NewIdentityFromKey(keyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	cfg.Files["shared"] = config.FileConfig{Filename: filepath.Join(tmpDir, "shared.env"), Access: []string{"*"}, References: true}
+	cfg.Files["notes"] = config.FileConfig{Filename: filepath.Join(tmpDir, "notes.env"), Access: []string{"*"}}
+	enableReferences(cfg, "default")
+
+	if err := SaveAllEnvVars(identity, cfg, "shared", map[string][]byte{
+		"DB_HOST": []byte("db.internal"),
+		"DB_URL":  []byte("postgres://${shared:DB_HOST}:5432"),
+	}); err != nil {
+		t.Fatalf("SaveAllEnvVars failed: %v", err)
+	}
+
+	// Files that do not enable references keep them as written
+	if err := SaveAllEnvVars(identity, cfg, "notes", map[string][]byte{
+		"TEMPLATE": []byte("${shared:DB_HOST} and ${nowhere:KEY}"),
+	}); err != nil {
+		t.Fatalf("SaveAllEnvVars failed: %v", err)
+	}
+
+	notes, notesCleanup, err := GetAllEnvVars(identity, cfg, "notes")
+	if err != nil {
+		t.Fatalf("GetAllEnvVars failed: %v", err)
+	}
+	defer notesCleanup()
+
+	if got := string(notes["TEMPLATE"]); got != "${shared:DB_HOST} and ${nowhere:KEY}" {
+		t.Errorf("Expected references to be kept without references enabled, got %q", got)
+	}
+
+	if err := SaveAllEnvVars(identity, cfg, "default", map[string][]byte{
+		"DATABASE_URL": []byte("${shared:DB_URL}/app"),
+		"SHELL_STYLE":  []byte("${HOME:-/root}"),
+	}); err != nil {
+		t.Fatalf("SaveAllEnvVars failed: %v", err)
+	}
+
+	vars, cleanup, err := GetAllEnvVars(identity, cfg, "default")
+	if err != nil {
+		t.Fatalf("GetAllEnvVars failed: %v", err)
+	}
+	defer cleanup()
+
+	if got := string(vars["DATABASE_URL"]); got != "postgres://db.internal:5432/app" {
+		t.Errorf("Expected resolved DATABASE_URL, got %q", got)
+	}
+
+	if got := string(vars["SHELL_STYLE"]); got != "${HOME:-/root}" {
+		t.Errorf("Expected non-reference value to be kept, got %q", got)
+	}
+
+	raw, rawCleanup, err := GetUnresolvedEnvVars(identity, cfg, "default")
+	if err != nil {
+		t.Fatalf("GetUnresolvedEnvVars failed: %v", err)
+	}
+	defer rawCleanup()
+
+	if got := string(raw["DATABASE_URL"]); got != "${shared:DB_URL}/app" {
+		t.Errorf("Expected raw DATABASE_URL, got %q", got)
+	}
+
+	value, valueCleanup, err := GetUnresolvedEnvVar(identity, cfg, "default", "DATABASE_URL")
+	if err != nil {
+		t.Fatalf("GetUnresolvedEnvVar failed: %v", err)
+	}
+	defer valueCleanup()
+
+	if string(value) != "${shared:DB_URL}/app" {
+		t.Errorf("Expected stored DATABASE_URL, got %q", value)
+	}
+}
+
+func TestResolveReferencesEscapes(t *testing.T) {
+	tmpDir := createTestDir(t)
+	keyPath, cfg := setupTestConfig(t, tmpDir)
+
+	identity, err := NewIdentityFromKey(keyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	cfg.Files["shared"] = config.FileConfig{Filename: filepath.Join(tmpDir, "shared.env"), Access: []string{"*"}, Interpolate: true, References: true}
+	enableReferences(cfg, "default")
+
+	if err := SaveAllEnvVars(identity, cfg, "shared", map[string][]byte{
+		"DB_HOST": []byte("db.internal"),
+		"LITERAL": []byte("$${default:PLAIN}"),
+	}); err != nil {
+		t.Fatalf("SaveAllEnvVars failed: %v", err)
+	}
+
+	if err := SaveAllEnvVars(identity, cfg, "default", map[string][]byte{
+		"PLAIN": []byte("$${shared:DB_HOST}"),
+	}); err != nil {
+		t.Fatalf("SaveAllEnvVars failed: %v", err)
+	}
+
+	cfg.Files["app"] = config.FileConfig{Filename: filepath.Join(tmpDir, "app.env"), Access: []string{"*"}, Interpolate: true, References: true}
+
+	if err := SaveAllEnvVars(identity, cfg, "app", map[string][]byte{
+		"ESCAPED":  []byte("$${shared:DB_HOST}"),
+		"RESOLVED": []byte("${shared:DB_HOST}"),
+		"COPY":     []byte("${ESCAPED} on $$5 and $HOME"),
+		"DEFAULT":  []byte("${UNSET:-$5}"),
+		"NESTED":   []byte("${shared:LITERAL}"),
+	}); err != nil {
+		t.Fatalf("SaveAllEnvVars failed: %v", err)
+	}
+
+	vars, cleanup, err := GetAllEnvVars(identity, cfg, "app")
+	if err != nil {
+		t.Fatalf("GetAllEnvVars failed: %v", err)
+	}
+	defer cleanup()
+
+	want := map[string]string{
+		"ESCAPED":  "${shared:DB_HOST}",
+		"RESOLVED": "db.internal",
+		"COPY":     "${shared:DB_HOST} on $5 and $HOME",
+		"DEFAULT":  "$5",
+		"NESTED":   "${default:PLAIN}",
+	}
+
+	for key, value := range want {
+		if got := string(vars[key]); got != value {
+			t.Errorf("%s: expected %q, got %q", key, value, got)
+		}
+	}
+
+	// $$ escapes references in files that enable them without interpolation too
+	plain, plainCleanup, err := GetAllEnvVars(identity, cfg, "default")
+	if err != nil {
+		t.Fatalf("GetAllEnvVars failed: %v", err)
+	}
+	defer plainCleanup()
+
+	if got := string(plain["PLAIN"]); got != "${shared:DB_HOST}" {
+		t.Errorf("Expected escaped reference to stay literal, got %q", got)
+	}
+}
+
+func TestResolveReferencesErrors(t *testing.T) {
+	tmpDir := createTestDir(t)
+	keyPath, cfg := setupTestConfig(t, tmpDir)
+
+	identity, err := NewIdentityFromKey(keyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	_, otherKey, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+
+	cfg.AddRecipient("other", otherKey)
+	cfg.Files["private"] = config.FileConfig{Filename: filepath.Join(tmpDir, "private.env"), Access: []string{"other"}}
+	enableReferences(cfg, "default")
+
+	if err := SaveAllEnvVars(identity, cfg, "private", map[string][]byte{"TOKEN": []byte("secret")}); err != nil {
+		t.Fatalf("SaveAllEnvVars failed: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"cycle", "${default:B}", "reference cycle: default:A -> default:B -> default:A"},
+		{"missing variable", "${default:MISSING}", "references 'default:MISSING', which is not set"},
+		{"unknown file", "${nowhere:KEY}", "references unknown file 'nowhere'"},
+		{"no access", "${private:TOKEN}", "'A' in 'default' references 'private'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SaveAllEnvVars(identity, cfg, "default", map[string][]byte{
+				"A": []byte(tt.value),
+				"B": []byte("${default:A}"),
+			}); err != nil {
+				t.Fatalf("SaveAllEnvVars failed: %v", err)
+			}
+
+			_, _, err := GetAllEnvVars(identity, cfg, "default")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func enableReferences(cfg *config.Config, fileName string) {
+	fileConfig := cfg.Files[fileName]
+	fileConfig.References = true
+	cfg.Files[fileName] = fileConfig
+}
@@ -0,0 +1,414 @@
+package core
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"filippo.io/edwards25519"
+	"filippo.io/edwards25519/field"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/thunderbottom/kiln/internal/config"
+	kerrors "github.com/thunderbottom/kiln/internal/errors"
+)
+
+// Signed content ends with these three lines. The signature covers everything up to and
+// including the signer line, so it also binds the content to the name of the file it was
+// written as; in whole-file encryption they end the plaintext, in the values format they follow
+// the MAC.
+const (
+	signedFilePrefix = "#kiln:file "
+	signerPrefix     = "#kiln:signer "
+	signaturePrefix  = "#kiln:signature "
+)
+
+const (
+	// xeddsaContext separates signatures made with age keys from other uses of those keys
+	xeddsaContext = "kiln-signature-v1\x00"
+	// sshsigNamespace is the sshsig namespace of signatures made with SSH keys
+	sshsigNamespace = "kiln"
+	sshsigMagic     = "SSHSIG"
+)
+
+// errCannotSign is returned when an identity's key type cannot make signatures
+var errCannotSign = errors.New("key cannot sign")
+
+// messageSigner signs file content for an identity
+type messageSigner interface {
+	sign(message []byte) ([]byte, error)
+}
+
+// fileSignature is the signature found at the end of file content
+type fileSignature struct {
+	// file is the name of the file the content was signed as
+	file      string
+	signer    string
+	signature []byte
+	// signed holds the content covered by the signature
+	signed []byte
+}
+
+// signContent appends the file, signer and signature lines for identity to content, signing it as
+// the content of fileName
+func signContent(identity *Identity, fileName string, content []byte) ([]byte, error) {
+	if identity.signer == nil {
+		return nil, errCannotSign
+	}
+
+	// Room for the signature lines, so no partial copy of the plaintext is left behind by growing
+	signed := make([]byte, 0, len(content)+len(fileName)+2*len(identity.PublicKey())+4096)
+	signed = append(signed, content...)
+
+	if len(signed) > 0 && signed[len(signed)-1] != '\n' {
+		signed = append(signed, '\n')
+	}
+
+	signed = append(signed, signedFilePrefix+fileName+"\n"...)
+	signed = append(signed, signerPrefix+identity.PublicKey()+"\n"...)
+
+	signature, err := identity.signer.sign(signed)
+	if err != nil {
+		WipeData(signed)
+
+		return nil, fmt.Errorf("sign: %w", err)
+	}
+
+	return append(signed, signaturePrefix+base64.StdEncoding.EncodeToString(signature)+"\n"...), nil
+}
+
+// signFileContent signs content written to fileName when cfg has signers. Identities that
+// cannot sign, such as plugin keys, write the content unsigned after a warning.
+func signFileContent(identity *Identity, cfg *config.Config, fileName string, content []byte) ([]byte, error) {
+	if len(cfg.Signers) == 0 {
+		return content, nil
+	}
+
+	signed, err := signContent(identity, fileName, content)
+	if errors.Is(err, errCannotSign) {
+		fmt.Fprintf(os.Stderr, "warning: '%s' was written unsigned, %s keys cannot sign\n", fileName, identity.KeyType())
+
+		return content, nil
+	}
+
+	return signed, err
+}
+
+// splitSignature separates the signature lines that end data from the content before them.
+// Data without well-formed signature lines is returned whole, with a nil signature.
+func splitSignature(data []byte) ([]byte, *fileSignature) {
+	start := bytes.LastIndex(data, []byte("\n"+signedFilePrefix)) + 1
+	if start == 0 && !bytes.HasPrefix(data, []byte(signedFilePrefix)) {
+		return data, nil
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(data[start:]), "\n"), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], signerPrefix) || !strings.HasPrefix(lines[2], signaturePrefix) {
+		return data, nil
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(lines[2], signaturePrefix))
+	if err != nil {
+		return data, nil
+	}
+
+	return data[:start], &fileSignature{
+		file:      strings.TrimPrefix(lines[0], signedFilePrefix),
+		signer:    strings.TrimPrefix(lines[1], signerPrefix),
+		signature: signature,
+		signed:    data[:start+len(lines[0])+len(lines[1])+2],
+	}
+}
+
+// checkSignature applies the signature policy of cfg to the signature of fileName, read under
+// label. Without configured signers nothing is checked. Under the warn policy problems are
+// reported on stderr and the file is still read.
+func checkSignature(cfg *config.Config, fileName, label string, signature *fileSignature) error {
+	if len(cfg.Signers) == 0 {
+		return nil
+	}
+
+	err := verifySignature(cfg, fileName, signature)
+	if err == nil {
+		return nil
+	}
+
+	if cfg.SignaturePolicy == config.SignaturePolicyRefuse {
+		return kerrors.SecurityError(fmt.Sprintf("'%s' %v", label, err), "ask an allowed signer to rewrite the file, or restore it from version control")
+	}
+
+	fmt.Fprintf(os.Stderr, "warning: '%s' %v\n", label, err)
+
+	return nil
+}
+
+// verifySignature checks that the content of fileName is signed as fileName by one of the signers
+// allowed in cfg
+func verifySignature(cfg *config.Config, fileName string, signature *fileSignature) error {
+	if signature == nil {
+		return fmt.Errorf("is not signed")
+	}
+
+	signers, err := cfg.ResolveSigners()
+	if err != nil {
+		return fmt.Errorf("cannot be verified: %w", err)
+	}
+
+	signer := describeSigner(cfg, signature.signer)
+
+	if !slices.ContainsFunc(signers, func(key string) bool { return samePublicKey(key, signature.signer) }) {
+		return fmt.Errorf("is signed by %s, which is not an allowed signer", signer)
+	}
+
+	if err := verifyMessage(signature.signer, signature.signed, signature.signature); err != nil {
+		return fmt.Errorf("has an invalid signature from %s", signer)
+	}
+
+	// A validly signed copy of another file must not pass as this one
+	if signature.file != fileName {
+		return fmt.Errorf("is signed by %s as the content of '%s'", signer, signature.file)
+	}
+
+	return nil
+}
+
+// describeSigner names a signer by its recipient name, or by its key if it has none
+func describeSigner(cfg *config.Config, publicKey string) string {
+	for _, name := range slices.Sorted(maps.Keys(cfg.Recipients)) {
+		if samePublicKey(cfg.Recipients[name], publicKey) {
+			return fmt.Sprintf("'%s'", name)
+		}
+	}
+
+	return fmt.Sprintf("'%s'", publicKey)
+}
+
+// samePublicKey reports whether two public keys are the same key, ignoring SSH key comments
+func samePublicKey(a, b string) bool {
+	a, b = strings.TrimSpace(a), strings.TrimSpace(b)
+	if a == b {
+		return true
+	}
+
+	keyA, _, _, _, errA := ssh.ParseAuthorizedKey([]byte(a))
+	keyB, _, _, _, errB := ssh.ParseAuthorizedKey([]byte(b))
+
+	return errA == nil && errB == nil && bytes.Equal(keyA.Marshal(), keyB.Marshal())
+}
+
+// verifyMessage verifies a signature made by signContent for publicKey
+func verifyMessage(publicKey string, message, signature []byte) error {
+	publicKey = strings.TrimSpace(publicKey)
+
+	switch {
+	case isPluginRecipient(publicKey):
+		return fmt.Errorf("plugin keys cannot sign")
+	case strings.HasPrefix(publicKey, "age1"):
+		return xeddsaVerify(publicKey, message, signature)
+	default:
+		return sshsigVerify(publicKey, message, signature)
+	}
+}
+
+// xeddsaKey signs with an age X25519 key using XEdDSA, so signatures verify against the age
+// recipient itself and signers need no separate signing key
+type xeddsaKey struct {
+	secret []byte
+}
+
+// newXEdDSAKey decodes the secret of an AGE-SECRET-KEY-1... identity
+func newXEdDSAKey(encoded string) (*xeddsaKey, error) {
+	hrp, secret, err := bech32Decode(encoded)
+	if err != nil || hrp != "age-secret-key-" || len(secret) != 32 {
+		return nil, fmt.Errorf("malformed age secret key")
+	}
+
+	return &xeddsaKey{secret: secret}, nil
+}
+
+func (k *xeddsaKey) sign(message []byte) ([]byte, error) {
+	scalar, err := edwards25519.NewScalar().SetBytesWithClamping(k.secret)
+	if err != nil {
+		return nil, err
+	}
+
+	// The Edwards public key has its sign bit cleared, which may mean signing with -scalar
+	publicKey := new(edwards25519.Point).ScalarBaseMult(scalar).Bytes()
+	if publicKey[31]&0x80 != 0 {
+		scalar.Negate(scalar)
+		publicKey[31] &= 0x7f
+	}
+
+	var random [64]byte
+	if _, err := rand.Read(random[:]); err != nil {
+		return nil, err
+	}
+
+	prefix := bytes.Repeat([]byte{0xff}, 32)
+	prefix[0] = 0xfe
+
+	nonceHash := sha512.New()
+	nonceHash.Write(prefix)
+	nonceHash.Write(scalar.Bytes())
+	nonceHash.Write([]byte(xeddsaContext))
+	nonceHash.Write(message)
+	nonceHash.Write(random[:])
+
+	nonce, err := edwards25519.NewScalar().SetUniformBytes(nonceHash.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+
+	commitment := new(edwards25519.Point).ScalarBaseMult(nonce).Bytes()
+
+	challengeHash := sha512.New()
+	challengeHash.Write(commitment)
+	challengeHash.Write(publicKey)
+	challengeHash.Write([]byte(xeddsaContext))
+	challengeHash.Write(message)
+
+	challenge, err := edwards25519.NewScalar().SetUniformBytes(challengeHash.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+
+	response := edwards25519.NewScalar().MultiplyAdd(challenge, scalar, nonce)
+
+	return append(commitment, response.Bytes()...), nil
+}
+
+func (k *xeddsaKey) wipe() {
+	WipeData(k.secret)
+}
+
+// xeddsaVerify verifies an XEdDSA signature against an age1... recipient. The Montgomery
+// u-coordinate of the recipient maps to the Edwards public key with a cleared sign bit, against
+// which the signature is an ordinary Ed25519 signature.
+func xeddsaVerify(recipient string, message, signature []byte) error {
+	hrp, u, err := bech32Decode(recipient)
+	if err != nil || hrp != "age" || len(u) != 32 {
+		return fmt.Errorf("malformed age recipient")
+	}
+
+	montgomery, err := new(field.Element).SetBytes(u)
+	if err != nil {
+		return err
+	}
+
+	one := new(field.Element).One()
+	denominator := new(field.Element).Add(montgomery, one)
+
+	if denominator.Equal(new(field.Element).Zero()) == 1 {
+		return fmt.Errorf("invalid age recipient")
+	}
+
+	y := new(field.Element).Subtract(montgomery, one)
+	y.Multiply(y, new(field.Element).Invert(denominator))
+
+	signed := append([]byte(xeddsaContext), message...)
+	if !ed25519.Verify(y.Bytes(), signed, signature) {
+		return fmt.Errorf("signature mismatch")
+	}
+
+	return nil
+}
+
+// sshsigSigner signs with an SSH key in the sshsig format of 'ssh-keygen -Y sign'
+type sshsigSigner struct {
+	signer ssh.Signer
+}
+
+func (s *sshsigSigner) sign(message []byte) ([]byte, error) {
+	return sshsigSign(s.signer, message)
+}
+
+// sshsigSignedData is the blob an sshsig signature is made over
+func sshsigSignedData(message []byte) []byte {
+	hash := sha512.Sum512(message)
+
+	return append([]byte(sshsigMagic), ssh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          []byte
+	}{sshsigNamespace, "", "sha512", hash[:]})...)
+}
+
+// sshsigBlob is an sshsig signature after the magic preamble
+type sshsigBlob struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+func sshsigSign(signer ssh.Signer, message []byte) ([]byte, error) {
+	data := sshsigSignedData(message)
+
+	var (
+		signature *ssh.Signature
+		err       error
+	)
+
+	// RSA keys must not sign with SHA-1, which sshsig rejects
+	if algorithmSigner, ok := signer.(ssh.AlgorithmSigner); ok && signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		signature, err = algorithmSigner.SignWithAlgorithm(rand.Reader, data, ssh.KeyAlgoRSASHA512)
+	} else {
+		signature, err = signer.Sign(rand.Reader, data)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(sshsigMagic), ssh.Marshal(sshsigBlob{
+		Version:       1,
+		PublicKey:     signer.PublicKey().Marshal(),
+		Namespace:     sshsigNamespace,
+		HashAlgorithm: "sha512",
+		Signature:     ssh.Marshal(*signature),
+	})...), nil
+}
+
+func sshsigVerify(authorizedKey string, message, signature []byte) error {
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(authorizedKey))
+	if err != nil {
+		return fmt.Errorf("parse signer key: %w", err)
+	}
+
+	body, found := bytes.CutPrefix(signature, []byte(sshsigMagic))
+	if !found {
+		return fmt.Errorf("not an sshsig signature")
+	}
+
+	var blob sshsigBlob
+	if err := ssh.Unmarshal(body, &blob); err != nil {
+		return fmt.Errorf("malformed sshsig signature: %w", err)
+	}
+
+	if blob.Version != 1 || blob.Namespace != sshsigNamespace || blob.HashAlgorithm != "sha512" ||
+		!bytes.Equal(blob.PublicKey, publicKey.Marshal()) {
+		return fmt.Errorf("unexpected sshsig signature parameters")
+	}
+
+	var sig ssh.Signature
+	if err := ssh.Unmarshal(blob.Signature, &sig); err != nil {
+		return fmt.Errorf("malformed sshsig signature: %w", err)
+	}
+
+	if sig.Format == ssh.KeyAlgoRSA {
+		return fmt.Errorf("SHA-1 RSA signatures are not accepted")
+	}
+
+	return publicKey.Verify(sshsigSignedData(message), &sig)
+}
@@ -0,0 +1,202 @@
+package core
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/thunderbottom/kiln/internal/config"
+)
+
+// newTestSSHIdentity writes an unencrypted ed25519 SSH key pair to dir and loads it
+func newTestSSHIdentity(t *testing.T, dir string) *Identity {
+	t.Helper()
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+
+	block, err := ssh.MarshalPrivateKey(privateKey, "")
+	if err != nil {
+		t.Fatalf("MarshalPrivateKey failed: %v", err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		t.Fatalf("NewSignerFromKey failed: %v", err)
+	}
+
+	keyPath := filepath.Join(dir, "id_ed25519")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	if err := os.WriteFile(keyPath+".pub", ssh.MarshalAuthorizedKey(signer.PublicKey()), 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	identity, err := NewIdentityFromKey(keyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	return identity
+}
+
+func TestSignContent(t *testing.T) {
+	tmpDir := createTestDir(t)
+	keyPath, _ := setupTestConfig(t, tmpDir)
+
+	ageIdentity, err := NewIdentityFromKey(keyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	for _, identity := range []*Identity{ageIdentity, newTestSSHIdentity(t, tmpDir)} {
+		t.Run(identity.KeyType(), func(t *testing.T) {
+			signed, err := signContent(identity, "default", []byte("KEY=value\n"))
+			if err != nil {
+				t.Fatalf("signContent failed: %v", err)
+			}
+
+			content, signature := splitSignature(signed)
+			if string(content) != "KEY=value\n" || signature == nil || signature.file != "default" {
+				t.Fatalf("Unexpected split: %q, %v", content, signature)
+			}
+
+			if !samePublicKey(signature.signer, identity.PublicKey()) {
+				t.Errorf("Expected signer %q, got %q", identity.PublicKey(), signature.signer)
+			}
+
+			if err := verifyMessage(identity.PublicKey(), signature.signed, signature.signature); err != nil {
+				t.Errorf("verifyMessage failed: %v", err)
+			}
+
+			tampered := append([]byte("KEY=forged\n"), signature.signed[len(content):]...)
+			if err := verifyMessage(identity.PublicKey(), tampered, signature.signature); err == nil {
+				t.Error("Expected signature over other content to be rejected")
+			}
+		})
+	}
+}
+
+func TestSignaturePolicy(t *testing.T) {
+	tmpDir := createTestDir(t)
+	keyPath, cfg := setupTestConfig(t, tmpDir)
+
+	identity, err := NewIdentityFromKey(keyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	// A second recipient who can write the file but is not an allowed signer
+	otherDir := filepath.Join(tmpDir, "other")
+	if err := os.Mkdir(otherDir, 0o700); err != nil {
+		t.Fatalf("Mkdir failed: %v", err)
+	}
+
+	other := newTestSSHIdentity(t, otherDir)
+	cfg.AddRecipient("other-user", other.PublicKey())
+	cfg.Files["values"] = config.FileConfig{Filename: filepath.Join(tmpDir, "values.env"), Access: []string{"*"}, Format: config.FormatValues}
+
+	cfg.Signers = []string{"test-user"}
+	cfg.SignaturePolicy = config.SignaturePolicyRefuse
+
+	for _, fileName := range []string{"default", "values"} {
+		if err := SetEnvVar(identity, cfg, fileName, "KEY", []byte("value")); err != nil {
+			t.Fatalf("SetEnvVar(%s) failed: %v", fileName, err)
+		}
+
+		value, cleanup, err := GetEnvVar(other, cfg, fileName, "KEY")
+		if err != nil {
+			t.Fatalf("GetEnvVar(%s) failed on signed file: %v", fileName, err)
+		}
+
+		if string(value) != "value" {
+			t.Errorf("Expected %q, got %q", "value", value)
+		}
+
+		cleanup()
+
+		if err := SaveAllEnvVars(other, cfg, fileName, map[string][]byte{"KEY": []byte("forged")}); err != nil {
+			t.Fatalf("SaveAllEnvVars(%s) failed: %v", fileName, err)
+		}
+
+		_, _, err = GetEnvVar(identity, cfg, fileName, "KEY")
+		if err == nil || !strings.Contains(err.Error(), "not an allowed signer") {
+			t.Errorf("Expected file written by other-user to be refused, got %v", err)
+		}
+
+		cfg.SignaturePolicy = config.SignaturePolicyWarn
+
+		value, cleanup, err = GetEnvVar(identity, cfg, fileName, "KEY")
+		if err != nil {
+			t.Fatalf("Expected warn policy to read the file, got %v", err)
+		}
+
+		if string(value) != "forged" {
+			t.Errorf("Expected %q, got %q", "forged", value)
+		}
+
+		cleanup()
+
+		cfg.SignaturePolicy = config.SignaturePolicyRefuse
+	}
+
+	// A validly signed copy of another file is refused
+	cfg.Files["staging"] = config.FileConfig{Filename: filepath.Join(tmpDir, "staging.env"), Access: []string{"*"}}
+
+	if err := SetEnvVar(identity, cfg, "staging", "KEY", []byte("staging")); err != nil {
+		t.Fatalf("SetEnvVar failed: %v", err)
+	}
+
+	staging, err := os.ReadFile(cfg.Files["staging"].Filename)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	if err := os.WriteFile(cfg.Files["default"].Filename, staging, 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	if _, _, err := GetEnvVar(identity, cfg, "default", "KEY"); err == nil || !strings.Contains(err.Error(), "as the content of 'staging'") {
+		t.Errorf("Expected a copy of staging to be refused as default, got %v", err)
+	}
+
+	// Files written before signing was configured are unsigned
+	cfg.Signers = nil
+
+	if err := SetEnvVar(identity, cfg, "default", "KEY", []byte("value")); err != nil {
+		t.Fatalf("SetEnvVar failed: %v", err)
+	}
+
+	cfg.Signers = []string{"test-user"}
+
+	if _, _, err := GetEnvVar(identity, cfg, "default", "KEY"); err == nil || !strings.Contains(err.Error(), "is not signed") {
+		t.Errorf("Expected unsigned file to be refused, got %v", err)
+	}
+}
+
+func TestBech32Decode(t *testing.T) {
+	privateKey, publicKey, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+	defer WipeData(privateKey)
+
+	if hrp, data, err := bech32Decode(publicKey); err != nil || hrp != "age" || len(data) != 32 {
+		t.Errorf("Unexpected decode of %s: %q, %d bytes, %v", publicKey, hrp, len(data), err)
+	}
+
+	corrupted := publicKey[:len(publicKey)-1] + string(bech32Charset[(strings.IndexByte(bech32Charset, publicKey[len(publicKey)-1])+1)%32])
+	if _, _, err := bech32Decode(corrupted); err == nil {
+		t.Error("Expected checksum error")
+	}
+}
@@ -1,8 +1,12 @@
 package core
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
 	"sort"
@@ -88,6 +92,40 @@ func WipeData(data []byte) {
 	runtime.GC()
 }
 
+// ShredFile overwrites a file with random data before removing it. This does not guarantee the
+// data is unrecoverable on copy-on-write or journaling filesystems, SSDs, or from backups.
+func ShredFile(filename string) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+
+	noise := make([]byte, info.Size())
+	if _, err := rand.Read(noise); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(filename, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.WriteAt(noise, 0)
+	if err == nil {
+		err = file.Sync()
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(filename)
+}
+
 // SortedKeys returns sorted keys from environment variables map
 func SortedKeys(variables map[string][]byte) []string {
 	keys := make([]string, 0, len(variables))
@@ -99,3 +137,37 @@ func SortedKeys(variables map[string][]byte) []string {
 
 	return keys
 }
+
+// MatchVarNames returns the sorted keys of variables matching any of the given names or glob patterns
+func MatchVarNames(variables map[string][]byte, patterns []string) ([]string, error) {
+	matched := make(map[string]bool)
+
+	for _, pattern := range patterns {
+		// path.Match only reports malformed patterns when it reaches them, so check up front
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+
+		for key := range variables {
+			if ok, _ := path.Match(pattern, key); ok {
+				matched[key] = true
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(matched))
+	for key := range matched {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// ShortHash returns a truncated SHA-256 digest of a value, suitable for comparing values without revealing them
+func ShortHash(value []byte) string {
+	sum := sha256.Sum256(value)
+
+	return hex.EncodeToString(sum[:6])
+}
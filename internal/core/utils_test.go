@@ -52,6 +52,27 @@ func TestReadWriteFile(t *testing.T) {
 	}
 }
 
+func TestShredFile(t *testing.T) {
+	tmpDir := createTestDir(t)
+	testFile := filepath.Join(tmpDir, "secret.env")
+
+	if err := WriteFile(testFile, []byte("ciphertext")); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	if err := ShredFile(testFile); err != nil {
+		t.Fatalf("ShredFile failed: %v", err)
+	}
+
+	if FileExists(testFile) {
+		t.Error("Expected file to be removed")
+	}
+
+	if err := ShredFile(testFile); err == nil {
+		t.Error("Expected error shredding a missing file")
+	}
+}
+
 func TestWipeData(t *testing.T) {
 	data := []byte("sensitive data")
 	originalData := make([]byte, len(data))
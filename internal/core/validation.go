@@ -4,19 +4,38 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
 )
 
-var validVarNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+var (
+	validVarNameRegex    = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	validVarPatternRegex = regexp.MustCompile(`^([a-zA-Z0-9_*?]|\[[a-zA-Z0-9_^!-]+\])+$`)
+)
 
 // IsValidVarName validates environment variable names using uppercase letters, numbers, and underscores.
 func IsValidVarName(name string) bool {
 	return name != "" && validVarNameRegex.MatchString(name)
 }
 
+// IsValidVarPattern validates variable names or glob patterns such as 'LEGACY_*' used to select variables.
+func IsValidVarPattern(pattern string) bool {
+	if IsValidVarName(pattern) {
+		return true
+	}
+
+	if pattern == "" || !validVarPatternRegex.MatchString(pattern) {
+		return false
+	}
+
+	_, err := path.Match(pattern, "")
+
+	return err == nil
+}
+
 // IsValidFileName validates file names to prevent directory traversal attacks.
 func IsValidFileName(name string) bool {
 	if name == "" {
@@ -44,6 +63,15 @@ func IsValidFilePath(path string) bool {
 	return true
 }
 
+// IsValidGitRevision validates a git revision argument, rejecting values git would parse as options.
+func IsValidGitRevision(rev string) bool {
+	if rev == "" || strings.HasPrefix(rev, "-") || len(rev) > 256 {
+		return false
+	}
+
+	return !strings.ContainsAny(rev, " \t\n\r\x00")
+}
+
 // IsValidTimeout validates command execution timeout values
 func IsValidTimeout(timeout time.Duration) bool {
 	return timeout > 0 && timeout <= 24*time.Hour
@@ -28,6 +28,32 @@ func TestIsValidVarName(t *testing.T) {
 	}
 }
 
+func TestIsValidVarPattern(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  bool
+	}{
+		{"plain name", "DATABASE_URL", true},
+		{"prefix glob", "LEGACY_*", true},
+		{"single char glob", "API_KEY_?", true},
+		{"character class", "DB_[A-C]", true},
+		{"wildcard only", "*", true},
+		{"empty string", "", false},
+		{"unterminated class", "DB_[A", false},
+		{"path separator", "FOO/*", false},
+		{"dash outside class", "API-KEY", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsValidVarPattern(tt.input); got != tt.want {
+				t.Errorf("IsValidVarPattern(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
 func TestIsValidEnvValue(t *testing.T) {
 	tests := []struct {
 		name    string
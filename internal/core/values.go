@@ -0,0 +1,391 @@
+package core
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+
+	kerrors "github.com/thunderbottom/kiln/internal/errors"
+)
+
+// valuesHeader is the first line of a file stored in the values format. Keys and recipients are
+// plaintext; each value is encrypted separately under a data key that is age-encrypted for the
+// recipients, and an HMAC keyed from the data key covers everything above the last line:
+//
+//	#kiln:values:v1
+//	API_KEY=ENC[...]
+//	#kiln:recipient age1...
+//	#kiln:key
+//	-----BEGIN AGE ENCRYPTED FILE-----
+//	...
+//	-----END AGE ENCRYPTED FILE-----
+//	#kiln:mac ...
+const valuesHeader = "#kiln:values:v1"
+
+const (
+	valuesRecipientPrefix = "#kiln:recipient "
+	valuesKeyLine         = "#kiln:key"
+	valuesMACPrefix       = "#kiln:mac "
+	valuesDataKeySize     = 32
+)
+
+var (
+	errValuesKey = errors.New("cannot decrypt data key")
+	errValuesMAC = errors.New("MAC mismatch")
+)
+
+// valuesFile is the parsed, still encrypted form of a values file
+type valuesFile struct {
+	// values holds the encrypted value of each key as stored
+	values     map[string]string
+	recipients []string
+	// wrappedKey is the armored age encryption of the data key
+	wrappedKey []byte
+	mac        []byte
+	// signed holds the bytes covered by the MAC
+	signed []byte
+}
+
+// IsValuesFormat reports whether a file is stored in the values format rather than as one
+// age-encrypted blob
+func IsValuesFormat(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(valuesHeader+"\n"))
+}
+
+// parseValuesFile splits a values file into its parts without decrypting anything. A signature
+// at the end of the file is ignored.
+func parseValuesFile(data []byte) (*valuesFile, error) {
+	data, _ = splitSignature(data)
+
+	if !IsValuesFormat(data) {
+		return nil, fmt.Errorf("not a values file")
+	}
+
+	macStart := bytes.LastIndex(data, []byte("\n"+valuesMACPrefix)) + 1
+	if macStart == 0 {
+		return nil, fmt.Errorf("missing MAC")
+	}
+
+	mac, err := base64.RawStdEncoding.DecodeString(strings.TrimSuffix(string(data[macStart+len(valuesMACPrefix):]), "\n"))
+	if err != nil || len(mac) != sha256.Size {
+		return nil, fmt.Errorf("malformed MAC")
+	}
+
+	file := &valuesFile{values: make(map[string]string), mac: mac, signed: data[:macStart]}
+	lines := strings.Split(strings.TrimSuffix(string(file.signed), "\n"), "\n")
+
+	for i := 1; i < len(lines); i++ {
+		line := lines[i]
+
+		switch {
+		case strings.HasPrefix(line, valuesRecipientPrefix):
+			file.recipients = append(file.recipients, strings.TrimPrefix(line, valuesRecipientPrefix))
+		case line == valuesKeyLine:
+			if file.wrappedKey != nil {
+				return nil, fmt.Errorf("line %d: duplicate data key", i+1)
+			}
+
+			// The armored data key runs up to and including the armor footer
+			end := slices.Index(lines[i+1:], armor.Footer)
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated data key", i+1)
+			}
+
+			file.wrappedKey = []byte(strings.Join(lines[i+1:i+2+end], "\n") + "\n")
+			i += end + 1
+		default:
+			key, value, found := strings.Cut(line, "=")
+			if !found || !isEnvKey(key) {
+				return nil, fmt.Errorf("line %d: expected KEY=ENC[...]", i+1)
+			}
+
+			if _, exists := file.values[key]; exists {
+				return nil, fmt.Errorf("line %d: duplicate key '%s'", i+1, key)
+			}
+
+			file.values[key] = value
+		}
+	}
+
+	if file.wrappedKey == nil {
+		return nil, fmt.Errorf("missing data key")
+	}
+
+	return file, nil
+}
+
+// openValuesFile decrypts a values file with identity, verifying its MAC before any value is
+// decrypted. The caller must wipe the returned values and data key.
+func openValuesFile(identity *Identity, data []byte) (*valuesFile, map[string][]byte, []byte, error) {
+	file, err := parseValuesFile(data)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	dataKey, err := NewAgeManager(nil, []age.Identity{identity.AgeIdentity()}).Decrypt(file.wrappedKey)
+	if err != nil || len(dataKey) != valuesDataKeySize {
+		WipeData(dataKey)
+
+		return nil, nil, nil, errValuesKey
+	}
+
+	if !hmac.Equal(file.mac, valuesMAC(dataKey, file.signed)) {
+		WipeData(dataKey)
+
+		return nil, nil, nil, errValuesMAC
+	}
+
+	aead, err := valuesAEAD(dataKey)
+	if err != nil {
+		WipeData(dataKey)
+
+		return nil, nil, nil, err
+	}
+
+	variables := make(map[string][]byte, len(file.values))
+
+	for key, encoded := range file.values {
+		value, err := openValue(aead, key, encoded)
+		if err != nil {
+			WipeData(dataKey)
+
+			for _, value := range variables {
+				WipeData(value)
+			}
+
+			return nil, nil, nil, fmt.Errorf("value of '%s': %w", key, err)
+		}
+
+		variables[key] = value
+	}
+
+	return file, variables, dataKey, nil
+}
+
+// decryptValues decrypts a values file, using label in error messages
+func decryptValues(identity *Identity, label string, encryptedData []byte) (map[string][]byte, func(), error) {
+	_, variables, dataKey, err := openValuesFile(identity, encryptedData)
+	if err != nil {
+		switch {
+		case errors.Is(err, errValuesKey):
+			return nil, nil, kerrors.SecurityError(fmt.Sprintf("cannot decrypt '%s'", label), "ensure your key has access to this file")
+		case errors.Is(err, errValuesMAC):
+			return nil, nil, kerrors.SecurityError(fmt.Sprintf("'%s' failed its integrity check", label), "the file was changed outside kiln; restore it from version control")
+		default:
+			return nil, nil, kerrors.ValidationError("environment format", fmt.Sprintf("file '%s' contains invalid format: %v", label, err))
+		}
+	}
+
+	WipeData(dataKey)
+
+	cleanup := func() {
+		for _, value := range variables {
+			WipeData(value)
+		}
+	}
+
+	return variables, cleanup, nil
+}
+
+// encryptValues encrypts variables in the values format for recipientKeys. When previous is a
+// values file for the same recipients that identity can decrypt, its data key is kept and
+// unchanged values keep their ciphertext, so a change only touches the lines of the keys that
+// changed. Any change of recipients rotates the data key and re-encrypts every value.
+func encryptValues(identity *Identity, recipientKeys []string, variables map[string][]byte, previous []byte) ([]byte, error) {
+	recipientKeys = normalizeRecipients(recipientKeys)
+
+	var (
+		dataKey    []byte
+		wrappedKey []byte
+		reusable   map[string]string
+	)
+
+	if IsValuesFormat(previous) {
+		file, oldVariables, oldKey, err := openValuesFile(identity, previous)
+		if err == nil {
+			// Data keys wrapped without a recipient manifest are replaced to record one
+			if manifest, _ := HeaderManifest(file.wrappedKey); manifest != nil && slices.Equal(file.recipients, recipientKeys) {
+				dataKey, wrappedKey = oldKey, file.wrappedKey
+				reusable = make(map[string]string)
+
+				for key, value := range variables {
+					if oldValue, exists := oldVariables[key]; exists && bytes.Equal(oldValue, value) {
+						reusable[key] = file.values[key]
+					}
+				}
+			} else {
+				WipeData(oldKey)
+			}
+
+			for _, value := range oldVariables {
+				WipeData(value)
+			}
+		}
+	}
+
+	if dataKey == nil {
+		dataKey = make([]byte, valuesDataKeySize)
+		if _, err := rand.Read(dataKey); err != nil {
+			return nil, fmt.Errorf("generate data key: %w", err)
+		}
+
+		recipients, err := parseManifestRecipients(recipientKeys)
+		if err != nil {
+			WipeData(dataKey)
+
+			return nil, err
+		}
+
+		wrappedKey, err = NewAgeManager(recipients, nil).EncryptArmored(dataKey)
+		if err != nil {
+			WipeData(dataKey)
+
+			return nil, err
+		}
+	}
+	defer WipeData(dataKey)
+
+	aead, err := valuesAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+
+	buf.WriteString(valuesHeader + "\n")
+
+	for _, key := range SortedKeys(variables) {
+		encoded, reused := reusable[key]
+		if !reused {
+			if encoded, err = sealValue(aead, key, variables[key]); err != nil {
+				return nil, err
+			}
+		}
+
+		buf.WriteString(key + "=" + encoded + "\n")
+	}
+
+	for _, recipient := range recipientKeys {
+		buf.WriteString(valuesRecipientPrefix + recipient + "\n")
+	}
+
+	buf.WriteString(valuesKeyLine + "\n")
+	buf.Write(wrappedKey)
+	buf.WriteString(valuesMACPrefix + base64.RawStdEncoding.EncodeToString(valuesMAC(dataKey, buf.Bytes())) + "\n")
+
+	return buf.Bytes(), nil
+}
+
+// valuesRecipientsMatch reports whether a values file lists exactly publicKeys as its recipients
+func valuesRecipientsMatch(data []byte, publicKeys []string) (bool, error) {
+	file, err := parseValuesFile(data)
+	if err != nil {
+		return false, err
+	}
+
+	return slices.Equal(file.recipients, normalizeRecipients(publicKeys)), nil
+}
+
+// normalizeRecipients trims, sorts and deduplicates public keys
+func normalizeRecipients(publicKeys []string) []string {
+	normalized := make([]string, 0, len(publicKeys))
+
+	for _, key := range publicKeys {
+		if key = strings.TrimSpace(key); key != "" {
+			normalized = append(normalized, key)
+		}
+	}
+
+	slices.Sort(normalized)
+
+	return slices.Compact(normalized)
+}
+
+// sealValue encrypts a value with a random nonce, bound to its key name
+func sealValue(aead cipher.AEAD, key string, value []byte) (string, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("generate nonce: %w", err)
+	}
+
+	sealed := aead.Seal(nonce, nonce, value, []byte(key))
+
+	return "ENC[" + base64.RawStdEncoding.EncodeToString(sealed) + "]", nil
+}
+
+// openValue decrypts a value written by sealValue for the same key name
+func openValue(aead cipher.AEAD, key, encoded string) ([]byte, error) {
+	if !strings.HasPrefix(encoded, "ENC[") || !strings.HasSuffix(encoded, "]") {
+		return nil, fmt.Errorf("expected ENC[...]")
+	}
+
+	inner := encoded[len("ENC[") : len(encoded)-1]
+
+	sealed, err := base64.RawStdEncoding.DecodeString(inner)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("malformed ciphertext")
+	}
+
+	value, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("authentication failed")
+	}
+
+	return value, nil
+}
+
+// valuesAEAD returns the cipher values are encrypted with, keyed from the data key
+func valuesAEAD(dataKey []byte) (cipher.AEAD, error) {
+	key := deriveValuesKey(dataKey, "kiln values v1 encryption")
+	defer WipeData(key)
+
+	return chacha20poly1305.NewX(key)
+}
+
+// valuesMAC computes the MAC of a values file, keyed from the data key
+func valuesMAC(dataKey, signed []byte) []byte {
+	key := deriveValuesKey(dataKey, "kiln values v1 mac")
+	defer WipeData(key)
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(signed)
+
+	return mac.Sum(nil)
+}
+
+func deriveValuesKey(dataKey []byte, info string) []byte {
+	key := make([]byte, 32)
+
+	// HKDF-SHA256 output of 32 bytes cannot fail
+	_, _ = io.ReadFull(hkdf.New(sha256.New, dataKey, nil, []byte(info)), key)
+
+	return key
+}
+
+// isEnvKey reports whether key is a non-empty variable name as the env parser accepts it
+func isEnvKey(key string) bool {
+	if key == "" {
+		return false
+	}
+
+	for i := 0; i < len(key); i++ {
+		if !isEnvKeyChar(key[i]) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,206 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/thunderbottom/kiln/internal/config"
+)
+
+func TestValuesFormat(t *testing.T) {
+	tmpDir := createTestDir(t)
+	keyPath, cfg := setupTestConfig(t, tmpDir)
+
+	identity, err := NewIdentityFromKey(keyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	fileConfig := cfg.Files["default"]
+	fileConfig.Format = config.FormatValues
+	cfg.Files["default"] = fileConfig
+
+	variables := map[string][]byte{"API_KEY": []byte("secret"), "DB_URL": []byte("postgres://db\nline"), "EMPTY": {}}
+	if err := SaveAllEnvVars(identity, cfg, "default", variables); err != nil {
+		t.Fatalf("SaveAllEnvVars failed: %v", err)
+	}
+
+	first, err := ReadFile(fileConfig.Filename)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	if !IsValuesFormat(first) || !bytes.Contains(first, []byte("\nAPI_KEY=ENC[")) || bytes.Contains(first, []byte("secret")) {
+		t.Fatalf("Expected plaintext keys and encrypted values, got:\n%s", first)
+	}
+
+	loaded, cleanup, err := GetFileEnvVars(identity, cfg, "default")
+	if err != nil {
+		t.Fatalf("GetFileEnvVars failed: %v", err)
+	}
+	defer cleanup()
+
+	for key, want := range variables {
+		if !bytes.Equal(loaded[key], want) {
+			t.Errorf("%s: expected %q, got %q", key, want, loaded[key])
+		}
+	}
+
+	if err := SetEnvVar(identity, cfg, "default", "DB_URL", []byte("postgres://other")); err != nil {
+		t.Fatalf("SetEnvVar failed: %v", err)
+	}
+
+	second, err := ReadFile(fileConfig.Filename)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	// Only the changed value and the MAC differ
+	changed := changedLines(first, second)
+	if len(changed) != 2 || !strings.HasPrefix(changed[0], "DB_URL=") || !strings.HasPrefix(changed[1], valuesMACPrefix) {
+		t.Errorf("Expected only DB_URL and the MAC to change, got %q", changed)
+	}
+
+	current, err := FileRecipientsCurrent(cfg, "default")
+	if err != nil || !current {
+		t.Errorf("Expected recipients to be current, got %v, %v", current, err)
+	}
+
+	if current, err := FileFormatCurrent(cfg, "default"); err != nil || !current {
+		t.Errorf("Expected format to be current, got %v, %v", current, err)
+	}
+}
+
+func TestValuesFormatTampering(t *testing.T) {
+	tmpDir := createTestDir(t)
+	keyPath, cfg := setupTestConfig(t, tmpDir)
+
+	identity, err := NewIdentityFromKey(keyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	recipients, err := cfg.ResolveFileAccess("default")
+	if err != nil {
+		t.Fatalf("ResolveFileAccess failed: %v", err)
+	}
+
+	data, err := encryptValues(identity, recipients, map[string][]byte{"A": []byte("one"), "B": []byte("two")}, nil)
+	if err != nil {
+		t.Fatalf("encryptValues failed: %v", err)
+	}
+
+	lines := strings.Split(string(data), "\n")
+
+	tests := []struct {
+		name   string
+		modify func([]string) []string
+	}{
+		{"swapped values", func(lines []string) []string {
+			a, b := strings.TrimPrefix(lines[1], "A="), strings.TrimPrefix(lines[2], "B=")
+			lines[1], lines[2] = "A="+b, "B="+a
+
+			return lines
+		}},
+		{"removed key", func(lines []string) []string {
+			return append(lines[:2:2], lines[3:]...)
+		}},
+		{"removed recipient", func(lines []string) []string {
+			return append(lines[:3:3], lines[4:]...)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := []byte(strings.Join(tt.modify(append([]string(nil), lines...)), "\n"))
+
+			if _, _, _, err := decryptEnvVars(identity, "default", tampered); err == nil {
+				t.Error("Expected tampered file to be rejected")
+			}
+		})
+	}
+
+	variables, cleanup, _, err := decryptEnvVars(identity, "default", data)
+	if err != nil {
+		t.Fatalf("decryptEnvVars failed on untouched file: %v", err)
+	}
+	defer cleanup()
+
+	if string(variables["A"]) != "one" || string(variables["B"]) != "two" {
+		t.Errorf("Unexpected values: %q", variables)
+	}
+}
+
+func TestValuesFormatRecipientChange(t *testing.T) {
+	tmpDir := createTestDir(t)
+	keyPath, cfg := setupTestConfig(t, tmpDir)
+
+	identity, err := NewIdentityFromKey(keyPath)
+	if err != nil {
+		t.Fatalf("NewIdentityFromKey failed: %v", err)
+	}
+
+	fileConfig := cfg.Files["default"]
+	fileConfig.Format = config.FormatValues
+	cfg.Files["default"] = fileConfig
+
+	if err := SetEnvVar(identity, cfg, "default", "KEY", []byte("value")); err != nil {
+		t.Fatalf("SetEnvVar failed: %v", err)
+	}
+
+	before, err := ReadFile(fileConfig.Filename)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	_, otherKey, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+
+	cfg.AddRecipient("other-user", otherKey)
+
+	if current, err := FileRecipientsCurrent(cfg, "default"); err != nil || current {
+		t.Fatalf("Expected file to be stale after adding a recipient, got %v, %v", current, err)
+	}
+
+	variables, cleanup, err := GetFileEnvVars(identity, cfg, "default")
+	if err != nil {
+		t.Fatalf("GetFileEnvVars failed: %v", err)
+	}
+	defer cleanup()
+
+	if err := SaveAllEnvVars(identity, cfg, "default", variables); err != nil {
+		t.Fatalf("SaveAllEnvVars failed: %v", err)
+	}
+
+	after, err := ReadFile(fileConfig.Filename)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	// A new recipient set rotates the data key, so the unchanged value is re-encrypted
+	if changed := changedLines(before, after); len(changed) == 0 || !strings.HasPrefix(changed[0], "KEY=") {
+		t.Errorf("Expected KEY to be re-encrypted, got changes %q", changed)
+	}
+
+	if !bytes.Contains(after, []byte(valuesRecipientPrefix+otherKey+"\n")) {
+		t.Error("Expected new recipient to be listed")
+	}
+}
+
+// changedLines returns the lines of after that differ from the line at the same position in before
+func changedLines(before, after []byte) []string {
+	beforeLines := strings.Split(string(before), "\n")
+
+	var changed []string
+
+	for i, line := range strings.Split(string(after), "\n") {
+		if i >= len(beforeLines) || beforeLines[i] != line {
+			changed = append(changed, line)
+		}
+	}
+
+	return changed
+}
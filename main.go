@@ -19,20 +19,34 @@ var (
 
 // CLI represents the command-line interface structure for the kiln tool.
 type CLI struct {
-	Config  string `short:"c" help:"Configuration file path" default:"kiln.toml" type:"path" env:"KILN_CONFIG_FILE"`
+	Config  string `short:"c" help:"Configuration file path (default: kiln.toml in the current directory or its parents)" type:"path" env:"KILN_CONFIG_FILE"`
 	Key     string `short:"k" help:"Path to private key file" type:"path" env:"KILN_PRIVATE_KEY_FILE"`
 	Verbose bool   `short:"v" help:"Verbose output" default:"false"`
 
-	Init    commands.InitCmd   `cmd:"" help:"Initialize new kiln project"`
-	Edit    commands.EditCmd   `cmd:"" help:"Edit encrypted environment variables"`
-	Export  commands.ExportCmd `cmd:"" help:"Export environment variables"`
-	Run     commands.RunCmd    `cmd:"" help:"Run command with encrypted environment"`
-	Set     commands.SetCmd    `cmd:"" help:"Set an environment variable"`
-	Get     commands.GetCmd    `cmd:"" help:"Get an environment variable"`
-	Apply   commands.ApplyCmd  `cmd:"" help:"Apply variables to template files"`
-	Rekey   commands.RekeyCmd  `cmd:"" help:"Rotate encryption keys"`
-	Info    commands.InfoCmd   `cmd:"" help:"Show project and file information"`
-	Version kong.VersionFlag   `help:"Show version"`
+	Init        commands.InitCmd        `cmd:"" help:"Initialize new kiln project"`
+	Edit        commands.EditCmd        `cmd:"" help:"Edit encrypted environment variables"`
+	Export      commands.ExportCmd      `cmd:"" help:"Export environment variables"`
+	Run         commands.RunCmd         `cmd:"" help:"Run command with encrypted environment"`
+	Set         commands.SetCmd         `cmd:"" help:"Set an environment variable"`
+	Get         commands.GetCmd         `cmd:"" help:"Get an environment variable"`
+	Unset       commands.UnsetCmd       `cmd:"" help:"Remove environment variables"`
+	List        commands.ListCmd        `cmd:"" help:"List variable names and metadata without values"`
+	Mv          commands.MvCmd          `cmd:"" help:"Move or rename an environment variable"`
+	Cp          commands.CpCmd          `cmd:"" help:"Copy an environment variable"`
+	Diff        commands.DiffCmd        `cmd:"" help:"Compare variables between environment files or git revisions"`
+	Log         commands.LogCmd         `cmd:"" help:"Show variable change history from git"`
+	SetupGit    commands.SetupGitCmd    `cmd:"" help:"Configure git to merge and diff encrypted environment files"`
+	MergeDriver commands.MergeDriverCmd `cmd:"" help:"Merge encrypted environment files (invoked by git)"`
+	Textconv    commands.TextconvCmd    `cmd:"" help:"Render encrypted environment files for git diff (invoked by git)"`
+	Apply       commands.ApplyCmd       `cmd:"" help:"Apply variables to template files"`
+	Rekey       commands.RekeyCmd       `cmd:"" help:"Rotate encryption keys"`
+	Recipients  commands.RecipientsCmd  `cmd:"" help:"Manage recipients and their access"`
+	Groups      commands.GroupsCmd      `cmd:"" help:"Manage recipient groups"`
+	Files       commands.FilesCmd       `cmd:"" help:"Manage environment file definitions"`
+	Affected    commands.AffectedCmd    `cmd:"" help:"List files to rekey across projects after a shared recipients file changes"`
+	Info        commands.InfoCmd        `cmd:"" help:"Show project and file information"`
+	Verify      commands.VerifyCmd      `cmd:"" help:"Check that files are encrypted for the recipients their access lists resolve to"`
+	Version     kong.VersionFlag        `help:"Show version"`
 }
 
 func main() {
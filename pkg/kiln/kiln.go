@@ -197,6 +197,37 @@ func SetMultipleEnvironmentVars(identity *Identity, cfg *Config, file string, va
 	return nil
 }
 
+// UnsetEnvironmentVars removes variables from an encrypted file.
+// Each pattern is either an exact variable name or a glob pattern such as "LEGACY_*".
+// Returns the sorted list of removed variable names. The file is re-encrypted once,
+// and only when at least one variable matched.
+func UnsetEnvironmentVars(identity *Identity, cfg *Config, file string, patterns []string) ([]string, error) {
+	if err := validateInputs(identity, cfg, file); err != nil {
+		return nil, err
+	}
+
+	if !isValidFileName(file) {
+		return nil, fmt.Errorf("invalid file name '%s': cannot contain '..' or '/' characters", file)
+	}
+
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("no variable names provided")
+	}
+
+	for _, pattern := range patterns {
+		if !isValidVarPattern(pattern) {
+			return nil, fmt.Errorf("invalid variable name or pattern '%s'", pattern)
+		}
+	}
+
+	removed, err := core.UnsetEnvVars(identity, cfg, file, patterns)
+	if err != nil {
+		return nil, fmt.Errorf("unset variables in '%s': %w", file, err)
+	}
+
+	return removed, nil
+}
+
 // DiscoverPrivateKey attempts to find a compatible private key in standard locations.
 // Returns the path to the first usable private key found.
 // Useful for applications that want to auto-discover keys like the CLI tool does.
@@ -241,3 +272,8 @@ func isValidFileName(name string) bool {
 func isValidVarName(name string) bool {
 	return core.IsValidVarName(name)
 }
+
+// isValidVarPattern checks if a variable name or glob pattern is safe to match against.
+func isValidVarPattern(pattern string) bool {
+	return core.IsValidVarPattern(pattern)
+}
@@ -377,6 +377,47 @@ func TestSetMultipleEnvironmentVars(t *testing.T) {
 	}
 }
 
+// TestUnsetEnvironmentVars tests removing variables by name and glob pattern
+func TestUnsetEnvironmentVars(t *testing.T) {
+	tmpDir := createTestDir(t)
+
+	cfg, identity := setupTestEnvironment(t, tmpDir)
+	defer identity.Cleanup()
+
+	testVars := map[string][]byte{
+		"LEGACY_HOST": []byte("old-host"),
+		"LEGACY_PORT": []byte("1234"),
+		"API_KEY":     []byte("secret-api-key"),
+	}
+
+	if err := kiln.SetMultipleEnvironmentVars(identity, cfg, "default", testVars); err != nil {
+		t.Fatalf("SetMultipleEnvironmentVars failed: %v", err)
+	}
+
+	removed, err := kiln.UnsetEnvironmentVars(identity, cfg, "default", []string{"LEGACY_*"})
+	if err != nil {
+		t.Fatalf("UnsetEnvironmentVars failed: %v", err)
+	}
+
+	if len(removed) != 2 {
+		t.Errorf("Expected 2 removed variables, got %v", removed)
+	}
+
+	allVars, cleanup, err := kiln.GetAllEnvironmentVars(identity, cfg, "default")
+	if err != nil {
+		t.Fatalf("GetAllEnvironmentVars failed: %v", err)
+	}
+	defer cleanup()
+
+	if _, exists := allVars["API_KEY"]; !exists || len(allVars) != 1 {
+		t.Errorf("Expected only API_KEY to remain, got %d variables", len(allVars))
+	}
+
+	if _, err := kiln.UnsetEnvironmentVars(identity, cfg, "default", []string{"bad/pattern"}); err == nil {
+		t.Error("UnsetEnvironmentVars should reject invalid patterns")
+	}
+}
+
 // TestValidationErrors tests input validation
 func TestValidationErrors(t *testing.T) {
 	tmpDir := createTestDir(t)